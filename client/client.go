@@ -0,0 +1,180 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var (
+	ErrClientNotFound      = errors.New("client not found")
+	ErrClientExists        = errors.New("client exists")
+	ErrClientIDInvalid     = errors.New("invalid client id")
+	ErrSecretInvalid       = errors.New("invalid client secret")
+	ErrRedirectURIInvalid  = errors.New("invalid redirect uri")
+	ErrGrantTypeInvalid    = errors.New("invalid grant type")
+	ErrAudienceRequired    = errors.New("audience required")
+	ErrSecretNotApplicable = errors.New("public clients have no secret")
+	ErrScopeInvalid        = errors.New("invalid scope")
+)
+
+// Grant types a client may be allowed to use.
+const (
+	AuthorizationCode = "authorization_code"
+	RefreshToken      = "refresh_token"
+	ClientCredentials = "client_credentials"
+	DeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+var grantTypes = []string{AuthorizationCode, RefreshToken, ClientCredentials, DeviceCode}
+
+var (
+	idPattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}$`)
+	scopePattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,62}$`)
+)
+
+// reservedScopes are the roles of human users; a client holding them would
+// pass for one.
+var reservedScopes = []string{"admin", "user", "openid", "profile", "email"}
+
+// Client is an application allowed to obtain tokens. Public clients (no
+// secret) must use PKCE.
+type Client struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"secret_hash,omitempty"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Audience     string    `json:"audience"`         // the aud of every token issued to it
+	Scopes       []string  `json:"scopes,omitempty"` // granted to its client_credentials tokens
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+func (c *Client) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+func (c *Client) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// GrantScopes narrows the requested scopes to those the client holds; no
+// request means every scope it holds.
+func (c *Client) GrantScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return slices.Clone(c.Scopes), nil
+	}
+
+	for _, s := range requested {
+		if !slices.Contains(c.Scopes, s) {
+			return nil, ErrScopeInvalid
+		}
+	}
+
+	return requested, nil
+}
+
+// VerifySecret compares in constant time; public clients match only the
+// empty secret.
+func (c *Client) VerifySecret(secret string) bool {
+	if c.Public() {
+		return secret == ""
+	}
+
+	hash := HashSecret(secret)
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(c.SecretHash)) == 1
+}
+
+// Redacted returns a copy safe to hand out over the API.
+func (c *Client) Redacted() *Client {
+	redacted := *c
+	redacted.SecretHash = ""
+	return &redacted
+}
+
+func (c *Client) validate() error {
+	if !idPattern.MatchString(c.ID) {
+		return ErrClientIDInvalid
+	}
+
+	if c.Audience == "" {
+		return ErrAudienceRequired
+	}
+
+	for _, g := range c.GrantTypes {
+		if !slices.Contains(grantTypes, g) {
+			return ErrGrantTypeInvalid
+		}
+	}
+
+	for _, uri := range c.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return ErrRedirectURIInvalid
+		}
+	}
+
+	if c.AllowsGrant(AuthorizationCode) && len(c.RedirectURIs) == 0 {
+		return ErrRedirectURIInvalid
+	}
+
+	// Machine tokens are only as safe as the secret behind them.
+	if c.AllowsGrant(ClientCredentials) && c.Public() {
+		return ErrGrantTypeInvalid
+	}
+
+	for _, s := range c.Scopes {
+		if !scopePattern.MatchString(s) || slices.Contains(reservedScopes, s) {
+			return ErrScopeInvalid
+		}
+	}
+
+	return nil
+}
+
+// validRedirectURI wants an absolute https URL without fragment; plain http
+// is only accepted for loopback, as native apps need it.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+// GenerateSecret returns a secret and its hash. Secrets carry 256 bits of
+// entropy, so a plain SHA-256 is enough to store them.
+func GenerateSecret() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+	return secret, HashSecret(secret), nil
+}
+
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type EndpointSet struct {
+	Register     endpoint.Endpoint
+	Update       endpoint.Endpoint
+	RotateSecret endpoint.Endpoint
+	Delete       endpoint.Endpoint
+	Client       endpoint.Endpoint
+	Clients      endpoint.Endpoint
+}
+
+// SecretResponse carries a client secret; it is only ever shown once.
+type SecretResponse struct {
+	Client *Client `json:"client,omitempty"`
+	Secret string  `json:"secret,omitempty"`
+}
+
+func RegisterEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(ClientRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		c, secret, err := svc.Register(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SecretResponse{
+			Client: c.Redacted(),
+			Secret: secret,
+		}, nil
+	}
+}
+
+func UpdateEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(ClientRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		c, err := svc.Update(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.Redacted(), nil
+	}
+}
+
+func RotateSecretEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		secret, err := svc.RotateSecret(id)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SecretResponse{Secret: secret}, nil
+	}
+}
+
+func DeleteEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		err := svc.Delete(id)
+		return nil, err
+	}
+}
+
+func ClientEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		id, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		c, err := svc.Client(id)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.Redacted(), nil
+	}
+}
+
+func ClientsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		clients, err := svc.Clients()
+		if err != nil {
+			return nil, err
+		}
+
+		redacted := make([]*Client, len(clients))
+		for i, c := range clients {
+			redacted[i] = c.Redacted()
+		}
+
+		return redacted, nil
+	}
+}
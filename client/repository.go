@@ -0,0 +1,14 @@
+package client
+
+type Repository interface {
+	// Command
+	Store(c *Client) error
+	Delete(id string) error
+
+	// Query
+	Find(id string) (*Client, error)
+	List() ([]*Client, error)
+
+	// Close the repository
+	Close() error
+}
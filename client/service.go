@@ -0,0 +1,218 @@
+package client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/flarexio/identity/conf"
+)
+
+// ClientRequest describes a client to register or update. Public clients
+// get no secret.
+type ClientRequest struct {
+	ID           string
+	Name         string
+	RedirectURIs []string
+	GrantTypes   []string
+	Audience     string
+	Scopes       []string
+	Public       bool
+}
+
+type Service interface {
+	Register(req ClientRequest) (*Client, string, error)
+	Update(req ClientRequest) (*Client, error)
+	RotateSecret(id string) (string, error)
+	Delete(id string) error
+	Client(id string) (*Client, error)
+	Clients() ([]*Client, error)
+	Authenticate(id string, secret string) (*Client, error)
+	Seed(clients []conf.OIDCClient) error
+}
+
+func NewService(clients Repository) Service {
+	return &service{clients}
+}
+
+type service struct {
+	clients Repository
+}
+
+func (svc *service) Register(req ClientRequest) (*Client, string, error) {
+	if _, err := svc.clients.Find(req.ID); err == nil {
+		return nil, "", ErrClientExists
+	} else if !errors.Is(err, ErrClientNotFound) {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	c := &Client{
+		ID:           req.ID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Audience:     req.Audience,
+		Scopes:       req.Scopes,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if len(c.GrantTypes) == 0 {
+		c.GrantTypes = []string{AuthorizationCode, RefreshToken}
+	}
+
+	var secret string
+	if !req.Public {
+		s, hash, err := GenerateSecret()
+		if err != nil {
+			return nil, "", err
+		}
+
+		secret = s
+		c.SecretHash = hash
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, "", err
+	}
+
+	if err := svc.clients.Store(c); err != nil {
+		return nil, "", err
+	}
+
+	return c, secret, nil
+}
+
+// Update replaces everything but the secret; use RotateSecret for that.
+func (svc *service) Update(req ClientRequest) (*Client, error) {
+	c, err := svc.clients.Find(req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *c
+	updated.Name = req.Name
+	updated.RedirectURIs = req.RedirectURIs
+	updated.GrantTypes = req.GrantTypes
+	updated.Audience = req.Audience
+	updated.Scopes = req.Scopes
+	updated.UpdatedAt = time.Now()
+
+	if len(updated.GrantTypes) == 0 {
+		updated.GrantTypes = c.GrantTypes
+	}
+
+	if err := updated.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := svc.clients.Store(&updated); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (svc *service) RotateSecret(id string) (string, error) {
+	c, err := svc.clients.Find(id)
+	if err != nil {
+		return "", err
+	}
+
+	if c.Public() {
+		return "", ErrSecretNotApplicable
+	}
+
+	secret, hash, err := GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	updated := *c
+	updated.SecretHash = hash
+	updated.UpdatedAt = time.Now()
+
+	if err := svc.clients.Store(&updated); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+func (svc *service) Delete(id string) error {
+	if _, err := svc.clients.Find(id); err != nil {
+		return err
+	}
+
+	return svc.clients.Delete(id)
+}
+
+func (svc *service) Client(id string) (*Client, error) {
+	return svc.clients.Find(id)
+}
+
+func (svc *service) Clients() ([]*Client, error) {
+	return svc.clients.List()
+}
+
+func (svc *service) Authenticate(id string, secret string) (*Client, error) {
+	c, err := svc.clients.Find(id)
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			return nil, ErrSecretInvalid
+		}
+
+		return nil, err
+	}
+
+	if !c.VerifySecret(secret) {
+		return nil, ErrSecretInvalid
+	}
+
+	return c, nil
+}
+
+// Seed registers the clients from the config file that the registry does
+// not know yet; clients already registered are left as they are.
+func (svc *service) Seed(clients []conf.OIDCClient) error {
+	for _, cfg := range clients {
+		_, err := svc.clients.Find(cfg.ID)
+		if err == nil {
+			continue
+		}
+
+		if !errors.Is(err, ErrClientNotFound) {
+			return err
+		}
+
+		now := time.Now()
+		c := &Client{
+			ID:           cfg.ID,
+			Name:         cfg.Name,
+			RedirectURIs: cfg.RedirectURIs,
+			GrantTypes:   cfg.GrantTypes,
+			Audience:     cfg.Audience,
+			Scopes:       cfg.Scopes,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+
+		if len(c.GrantTypes) == 0 {
+			c.GrantTypes = []string{AuthorizationCode, RefreshToken}
+		}
+
+		if cfg.Secret != "" {
+			c.SecretHash = HashSecret(cfg.Secret)
+		}
+
+		if err := c.validate(); err != nil {
+			return err
+		}
+
+		if err := svc.clients.Store(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
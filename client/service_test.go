@@ -0,0 +1,158 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/inmem"
+)
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	repo, _ := inmem.NewClientRepository()
+	svc := client.NewService(repo)
+
+	c, secret, err := svc.Register(client.ClientRequest{
+		ID:           "mdm",
+		Name:         "MDM",
+		RedirectURIs: []string{"https://mdm.flarex.io/callback"},
+		Audience:     "mdm.flarex.io",
+	})
+
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.NotEmpty(secret)
+	assert.False(c.Public())
+	assert.Equal([]string{client.AuthorizationCode, client.RefreshToken}, c.GrantTypes)
+
+	_, err = svc.Authenticate("mdm", secret)
+	assert.NoError(err)
+
+	_, err = svc.Authenticate("mdm", "wrong")
+	assert.ErrorIs(err, client.ErrSecretInvalid)
+
+	_, err = svc.Authenticate("unknown", secret)
+	assert.ErrorIs(err, client.ErrSecretInvalid)
+
+	_, _, err = svc.Register(client.ClientRequest{
+		ID:           "mdm",
+		RedirectURIs: []string{"https://mdm.flarex.io/callback"},
+		Audience:     "mdm.flarex.io",
+	})
+	assert.ErrorIs(err, client.ErrClientExists)
+
+	rotated, err := svc.RotateSecret("mdm")
+	assert.NoError(err)
+
+	_, err = svc.Authenticate("mdm", secret)
+	assert.ErrorIs(err, client.ErrSecretInvalid)
+
+	_, err = svc.Authenticate("mdm", rotated)
+	assert.NoError(err)
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	repo, _ := inmem.NewClientRepository()
+	svc := client.NewService(repo)
+
+	valid := client.ClientRequest{
+		ID:           "wallet",
+		RedirectURIs: []string{"https://wallet.flarex.io/callback"},
+		Audience:     "wallet.flarex.io",
+		Public:       true,
+	}
+
+	req := valid
+	req.ID = "Wallet App"
+	_, _, err := svc.Register(req)
+	assert.ErrorIs(err, client.ErrClientIDInvalid)
+
+	req = valid
+	req.Audience = ""
+	_, _, err = svc.Register(req)
+	assert.ErrorIs(err, client.ErrAudienceRequired)
+
+	req = valid
+	req.GrantTypes = []string{"password"}
+	_, _, err = svc.Register(req)
+	assert.ErrorIs(err, client.ErrGrantTypeInvalid)
+
+	// Only clients with a secret may get tokens of their own.
+	req = valid
+	req.GrantTypes = []string{client.ClientCredentials}
+	_, _, err = svc.Register(req)
+	assert.ErrorIs(err, client.ErrGrantTypeInvalid)
+
+	for _, scope := range []string{"admin", "Users Read"} {
+		req = valid
+		req.Public = false
+		req.Scopes = []string{scope}
+		_, _, err = svc.Register(req)
+		assert.ErrorIs(err, client.ErrScopeInvalid, scope)
+	}
+
+	for _, uri := range []string{
+		"http://wallet.flarex.io/callback",
+		"https://wallet.flarex.io/callback#fragment",
+		"/callback",
+	} {
+		req = valid
+		req.RedirectURIs = []string{uri}
+		_, _, err = svc.Register(req)
+		assert.ErrorIs(err, client.ErrRedirectURIInvalid, uri)
+	}
+
+	// Native apps may redirect to loopback over plain http.
+	req = valid
+	req.RedirectURIs = []string{"http://127.0.0.1:8765/callback"}
+	c, secret, err := svc.Register(req)
+	assert.NoError(err)
+	assert.True(c.Public())
+	assert.Empty(secret)
+
+	_, err = svc.RotateSecret("wallet")
+	assert.ErrorIs(err, client.ErrSecretNotApplicable)
+}
+
+func TestSeed(t *testing.T) {
+	assert := assert.New(t)
+
+	repo, _ := inmem.NewClientRepository()
+	svc := client.NewService(repo)
+
+	clients := []conf.OIDCClient{
+		{
+			ID:           "mdm",
+			Secret:       "secret",
+			RedirectURIs: []string{"https://mdm.flarex.io/callback"},
+			Audience:     "mdm.flarex.io",
+		},
+	}
+
+	assert.NoError(svc.Seed(clients))
+
+	_, err := svc.Authenticate("mdm", "secret")
+	assert.NoError(err)
+
+	// Clients changed through the API survive a restart.
+	_, err = svc.Update(client.ClientRequest{
+		ID:           "mdm",
+		RedirectURIs: []string{"https://mdm.flarex.io/oauth2/callback"},
+		Audience:     "mdm.flarex.io",
+	})
+	assert.NoError(err)
+
+	assert.NoError(svc.Seed(clients))
+
+	c, _ := svc.Client("mdm")
+	assert.Equal([]string{"https://mdm.flarex.io/oauth2/callback"}, c.RedirectURIs)
+}
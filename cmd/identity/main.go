@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
 	"github.com/nats-io/nats.go/micro"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
@@ -26,12 +28,27 @@ import (
 	"github.com/flarexio/core/policy"
 	"github.com/flarexio/core/pubsub"
 	"github.com/flarexio/identity"
+	"github.com/flarexio/identity/client"
 	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/device"
+	"github.com/flarexio/identity/keyring"
+	"github.com/flarexio/identity/lockout"
+	"github.com/flarexio/identity/mail"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/otp"
 	"github.com/flarexio/identity/passkeys"
 	"github.com/flarexio/identity/persistence"
+	"github.com/flarexio/identity/persistence/db"
 	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/refresh"
+	"github.com/flarexio/identity/revocation"
 	"github.com/flarexio/identity/scep"
+	"github.com/flarexio/identity/token"
+	"github.com/flarexio/identity/totp"
+	"github.com/flarexio/identity/transport/facebook"
 	"github.com/flarexio/identity/transport/line"
+	"github.com/flarexio/identity/user"
+	"github.com/flarexio/identity/verification"
 
 	transHTTP "github.com/flarexio/identity/transport/http"
 	transPubSub "github.com/flarexio/identity/transport/pubsub"
@@ -84,6 +101,154 @@ var genkeyCmd = &cli.Command{
 	},
 }
 
+var rotatekeyCmd = &cli.Command{
+	Name:  "rotatekey",
+	Usage: "Rotate the JWT signing key, keeping retired keys for verification",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "retain",
+			Usage: "How long retired keys stay in the JWKS (default: the token timeout)",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if err := conf.LoadEnv(ctx); err != nil {
+			return err
+		}
+
+		cfg, err := conf.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(conf.Path, "keys.json")
+
+		keys, err := keyring.Load(path, cfg.JWT.Privkey)
+		if err != nil {
+			return err
+		}
+
+		key, err := keys.Rotate()
+		if err != nil {
+			return err
+		}
+
+		retain := ctx.Duration("retain")
+		if retain == 0 {
+			retain = cfg.JWT.Timeout
+		}
+
+		pruned := keys.Prune(time.Now().Add(-retain))
+
+		if err := keys.Save(path); err != nil {
+			return err
+		}
+
+		fmt.Printf("Active Key: %s\n", key.ID)
+		fmt.Printf("Pruned Keys: %d\n", pruned)
+		fmt.Println("Send SIGHUP to running instances to pick up the new key.")
+
+		return nil
+	},
+}
+
+var migrateCmd = &cli.Command{
+	Name:  "migrate",
+	Usage: "Manage the database schema",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "up",
+			Usage: "Apply all pending migrations",
+			Action: func(ctx *cli.Context) error {
+				m, err := openMigrator(ctx)
+				if err != nil {
+					return err
+				}
+				defer m.Close()
+
+				applied, err := m.Up()
+				for _, migration := range applied {
+					fmt.Printf("Applied: %d %s\n", migration.Version, migration.Name)
+				}
+
+				if err != nil {
+					return err
+				}
+
+				if len(applied) == 0 {
+					fmt.Println("Schema is up to date.")
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:  "down",
+			Usage: "Roll back the latest migrations",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "steps",
+					Usage: "How many migrations to roll back",
+					Value: 1,
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				m, err := openMigrator(ctx)
+				if err != nil {
+					return err
+				}
+				defer m.Close()
+
+				reverted, err := m.Down(ctx.Int("steps"))
+				for _, migration := range reverted {
+					fmt.Printf("Reverted: %d %s\n", migration.Version, migration.Name)
+				}
+
+				return err
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "Show which migrations are applied",
+			Action: func(ctx *cli.Context) error {
+				m, err := openMigrator(ctx)
+				if err != nil {
+					return err
+				}
+				defer m.Close()
+
+				statuses, err := m.Status()
+				if err != nil {
+					return err
+				}
+
+				for _, s := range statuses {
+					applied := "pending"
+					if s.Applied {
+						applied = s.AppliedAt.Format(time.RFC3339)
+					}
+
+					fmt.Printf("%4d  %-24s  %s\n", s.Version, s.Name, applied)
+				}
+
+				return nil
+			},
+		},
+	},
+}
+
+func openMigrator(ctx *cli.Context) (*db.Migrator, error) {
+	if err := conf.LoadEnv(ctx); err != nil {
+		return nil, err
+	}
+
+	cfg, err := conf.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return persistence.NewMigrator(cfg.Persistence)
+}
+
 func main() {
 	cli.VersionPrinter = func(cli *cli.Context) {
 		fmt.Println("Version: " + cli.App.Version)
@@ -95,7 +260,7 @@ func main() {
 		Name:     "identity",
 		Usage:    "Scalable and decentralized user identity management",
 		Version:  Version,
-		Commands: []*cli.Command{versionCmd, genkeyCmd},
+		Commands: []*cli.Command{versionCmd, genkeyCmd, rotatekeyCmd, migrateCmd},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "path",
@@ -120,6 +285,12 @@ func main() {
 				Value:   8443,
 				EnvVars: []string{"IDENTITY_MTLS_PORT"},
 			},
+			&cli.BoolFlag{
+				Name:    "mail-log",
+				Usage:   "Log mail, codes included, when no SMTP relay is configured (development only)",
+				Value:   false,
+				EnvVars: []string{"IDENTITY_MAIL_LOG"},
+			},
 			&cli.StringFlag{
 				Name:    "nats",
 				EnvVars: []string{"NATS_URL"},
@@ -178,20 +349,200 @@ func run(cli *cli.Context) error {
 		return err
 	}
 
-	svc := identity.NewService(repo, passkeysSvc, cfg.Providers)
+	otpStore, err := inmem.NewOTPStore()
+	if err != nil {
+		return err
+	}
+	defer otpStore.Close()
+
+	// Without an SMTP relay, mail only reaches the operator through the log.
+	// It carries codes and links that sign users in, so that takes asking.
+	var mailer mail.Sender
+	switch {
+	case cfg.Mail.SMTP.Host != "":
+		mailer = mail.NewSMTPSender(cfg.Mail)
+
+	case !cli.Bool("mail-log"):
+		return errors.New("mail.smtp.host required, or --mail-log for development")
+
+	default:
+		log.Warn("no smtp relay, mail goes to the log")
+
+		mailer = mail.SenderFunc(func(msg *mail.Message) error {
+			log.Info("mail sent",
+				zap.String("to", msg.To),
+				zap.String("subject", msg.Subject),
+				zap.String("body", msg.Body),
+			)
+			return nil
+		})
+	}
+
+	otpSender := otp.SenderFunc(func(to string, code string) error {
+		return mailer.Send(&mail.Message{
+			To:      to,
+			Subject: "Your verification code",
+			Body:    "Your verification code is " + code + ".\n",
+		})
+	})
+
+	otpSvc := otp.NewService(otpStore, otpSender, 0)
+
+	// Without keys.json the ring holds only jwt.privkey from the config.
+	keysPath := filepath.Join(conf.Path, "keys.json")
+	keys, err := keyring.Load(keysPath, cfg.JWT.Privkey)
+	if err != nil {
+		return err
+	}
+
+	verificationSvc := verification.NewService(keys, mailer, cfg.Mail.VerifyURL, 0)
+
+	totpSvc, err := totp.NewService(cfg.MFA)
+	if err != nil {
+		return err
+	}
+
+	tickets, err := inmem.NewTicketStore()
+	if err != nil {
+		return err
+	}
+	defer tickets.Close()
+
+	providers, err := identity.DefaultProviderRegistry(cfg.Providers, passkeysSvc)
+	if err != nil {
+		return err
+	}
+
+	sync := cfg.Providers.Sync
+	profilePolicy, err := user.NewProfilePolicy(sync.Name, sync.Email, sync.Avatar)
+	if err != nil {
+		return err
+	}
+
+	linkPolicy, err := user.ParseLinkPolicy(cfg.Providers.Linking)
+	if err != nil {
+		return err
+	}
+
+	reservations, err := persistence.NewReservationStore(cfg.Persistence)
+	if err != nil {
+		log.Error(err.Error(),
+			zap.String("infra", "persistence"),
+			zap.String("driver", cfg.Persistence.Driver.String()),
+		)
+		return err
+	}
+	defer reservations.Close()
+
+	search, err := persistence.NewSearchIndex(cfg.Persistence, repo)
+	if err != nil {
+		log.Error(err.Error(),
+			zap.String("infra", "persistence"),
+			zap.String("driver", cfg.Persistence.Driver.String()),
+		)
+		return err
+	}
+	defer search.Close()
+
+	lockoutStore, err := inmem.NewLockoutStore()
+	if err != nil {
+		return err
+	}
+	defer lockoutStore.Close()
+
+	lockouts := identity.Lockouts{
+		Users: lockout.NewService(lockoutStore, cfg.Lockout.User),
+		IPs:   lockout.NewService(lockoutStore, cfg.Lockout.IP),
+	}
+
+	svc := identity.NewService(repo, search, reservations, otpSvc, verificationSvc, totpSvc, tickets, passkeysSvc, providers, profilePolicy, linkPolicy, lockouts)
 	svc = identity.LoggingMiddleware(log)(svc)
 
+	// Refresh tokens are opaque and server-side; the endpoints stay nil
+	// when refreshing is disabled, so sign-in hands out access tokens only.
+	var refreshSvc refresh.Service
+	var issueRefresh, rotateRefresh, revokeRefresh endpoint.Endpoint
+	revokeSessions := make([]endpoint.Endpoint, 0)
+	if cfg.JWT.Refresh.Enabled {
+		refreshTokens, err := persistence.NewRefreshTokenStore(cfg.Persistence)
+		if err != nil {
+			log.Error(err.Error(),
+				zap.String("infra", "persistence"),
+				zap.String("driver", cfg.Persistence.Driver.String()),
+			)
+			return err
+		}
+		defer refreshTokens.Close()
+
+		refreshSvc = refresh.NewService(refreshTokens, cfg.JWT.Refresh.Maximum)
+
+		issueRefresh = refresh.IssueEndpoint(refreshSvc)
+		rotateRefresh = refresh.RotateEndpoint(refreshSvc)
+		revokeRefresh = refresh.RevokeEndpoint(refreshSvc)
+		revokeSessions = append(revokeSessions, refresh.RevokeAllEndpoint(refreshSvc))
+	}
+
+	clientRepo, err := persistence.NewClientRepository(cfg.Persistence)
+	if err != nil {
+		log.Error(err.Error(),
+			zap.String("infra", "persistence"),
+			zap.String("driver", cfg.Persistence.Driver.String()),
+		)
+		return err
+	}
+	defer clientRepo.Close()
+
+	clientSvc := client.NewService(clientRepo)
+	if err := clientSvc.Seed(cfg.OIDC.Clients); err != nil {
+		return err
+	}
+
+	// The denylist lives with the other persistence, so it outlives a
+	// restart, and instances sharing a database share it. Revocations are
+	// still published for instances keeping a store of their own.
+	revocationStore, err := persistence.NewRevocationStore(cfg.Persistence)
+	if err != nil {
+		log.Error(err.Error(),
+			zap.String("infra", "persistence"),
+			zap.String("driver", cfg.Persistence.Driver.String()),
+		)
+		return err
+	}
+	defer revocationStore.Close()
+
+	revocations := revocation.NewService(revocationStore, cfg.JWT.Timeout)
+	revokeSessions = append(revokeSessions, revocation.RevokeAllEndpoint(revocations))
+
+	// Introspection and revocation verify tokens as ParseToken does.
+	tokenSvc := token.NewService(transHTTP.VerifyToken, clientSvc, revocations, refreshSvc)
+	introspect := token.IntrospectEndpoint(tokenSvc)
+	revokeToken := token.RevokeEndpoint(tokenSvc)
+
 	// Add Endpoints
 	endpoints := identity.EndpointSet{
-		// Register:         identity.RegisterEndpoint(svc),
-		SignIn:              identity.SignInEndpoint(svc),
-		OTPVerify:           identity.OTPVerifyEndpoint(svc),
-		AddSocialAccount:    identity.AddSocialAccountEndpoint(svc),
-		RemoveSocialAccount: identity.RemoveSocialAccountEndpoint(svc),
-		RegisterPasskey:     identity.RegisterPasskeyEndpoint(svc),
-		User:                identity.UserEndpoint(svc),
-		UserBySocialID:      identity.UserBySocialIDEndpoint(svc),
-		DeleteUser:          identity.DeleteUserEndpoint(svc),
+		Register:                 identity.RegisterEndpoint(svc),
+		SignIn:                   identity.SignInEndpoint(svc),
+		VerifySecondFactor:       identity.VerifySecondFactorEndpoint(svc),
+		CompleteLink:             identity.CompleteLinkEndpoint(svc),
+		EnrollTOTP:               identity.EnrollTOTPEndpoint(svc),
+		ConfirmTOTP:              identity.ConfirmTOTPEndpoint(svc),
+		DisableTOTP:              identity.DisableTOTPEndpoint(svc),
+		SendOTP:                  identity.SendOTPEndpoint(svc),
+		OTPVerify:                identity.OTPVerifyEndpoint(svc),
+		AddSocialAccount:         identity.AddSocialAccountEndpoint(svc),
+		RemoveSocialAccount:      identity.RemoveSocialAccountEndpoint(svc),
+		RegisterPasskey:          identity.RegisterPasskeyEndpoint(svc),
+		UpdateUser:               identity.UpdateUserEndpoint(svc),
+		VerifyEmail:              identity.VerifyEmailEndpoint(svc),
+		SendEmailVerification:    identity.SendEmailVerificationEndpoint(svc),
+		ConfirmEmailVerification: identity.ConfirmEmailVerificationEndpoint(svc),
+		User:                     identity.UserEndpoint(svc),
+		Users:                    identity.UsersEndpoint(svc),
+		SearchUsers:              identity.SearchUsersEndpoint(svc),
+		UserBySocialAccount:      identity.UserBySocialAccountEndpoint(svc),
+		LockUser:                 identity.LockUserEndpoint(svc),
+		UnlockUser:               identity.UnlockUserEndpoint(svc),
+		DeleteUser:               identity.DeleteUserEndpoint(svc),
 	}
 
 	// Add Transports
@@ -247,26 +598,14 @@ func run(cli *cli.Context) error {
 
 	events.ReplaceGlobals(ps)
 
-	// Add PubSub Transport
+	// SUB identity.revocations
 	{
-		srv, err := ps.AddService(micro.Config{
-			Name:        "identity",
-			Version:     Version,
-			Description: "Scalable and decentralized user identity management",
-			Metadata: map[string]string{
-				"id": cfg.Name,
-			},
-		})
+		endpoint := revocation.ApplyEndpoint(revocations)
+		handler := transPubSub.RevocationHandler(endpoint)
 
-		if err != nil {
+		if err := ps.Subscribe(revocation.Topic, handler); err != nil {
 			return err
 		}
-
-		root := srv.AddGroup("identity")
-
-		// SUB identity.signin
-		signInHandler := transPubSub.SignInHandler(endpoints.SignIn)
-		root.AddEndpoint("signin", signInHandler)
 	}
 
 	// Add HTTP Transport
@@ -275,6 +614,9 @@ func run(cli *cli.Context) error {
 	// GET /.well-known/jwks.json
 	r.GET("/.well-known/jwks.json", transHTTP.JWKHandler)
 
+	// GET /.well-known/openid-configuration
+	r.GET("/.well-known/openid-configuration", transHTTP.DiscoveryHandler)
+
 	// GET /.well-known/webauthn
 	r.GET("/.well-known/webauthn", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"origins": cfg.Providers.Passkeys.Origins})
@@ -283,9 +625,12 @@ func run(cli *cli.Context) error {
 	transHTTP.Init(
 		cfg.BaseURL,          // issuer
 		cfg.JWT.Audiences[0], // audience
-		cfg.JWT.Privkey,      // ed25519 private key
+		keys,                 // ed25519 signing keys
 	)
 
+	transHTTP.SetDenylist(revocations)
+	transHTTP.SetClients(clientSvc)
+
 	permissionsPath := filepath.Join(conf.Path, "permissions.json")
 	policy, err := policy.NewRegoPolicy(ctx, permissionsPath)
 	if err != nil {
@@ -293,6 +638,41 @@ func run(cli *cli.Context) error {
 	}
 
 	auth := transHTTP.Authorizator(policy)
+	tokenAuth := transHTTP.TokenAuthorizator(policy)
+
+	// Add PubSub Transport
+	{
+		srv, err := ps.AddService(micro.Config{
+			Name:        "identity",
+			Version:     Version,
+			Description: "Scalable and decentralized user identity management",
+			Metadata: map[string]string{
+				"id": cfg.Name,
+			},
+		})
+
+		if err != nil {
+			return err
+		}
+
+		root := srv.AddGroup("identity")
+
+		// SUB identity.signin
+		signInHandler := transPubSub.SignInHandler(endpoints.SignIn)
+		root.AddEndpoint("signin", signInHandler)
+
+		// SUB identity.introspect
+		root.AddEndpoint("introspect", transPubSub.IntrospectHandler(introspect))
+
+		// SUB identity.revoke
+		root.AddEndpoint("revoke", transPubSub.RevokeHandler(revokeToken))
+
+		users := root.AddGroup("users")
+
+		// SUB identity.users.search
+		users.AddEndpoint("search", transPubSub.SearchUsersHandler(endpoints.SearchUsers,
+			tokenAuth("identity::users.search", transHTTP.Admin)))
+	}
 
 	if provider := cfg.Providers.LINE; provider.Channel.ID != "" {
 		line.SetConfig(provider)
@@ -310,17 +690,118 @@ func run(cli *cli.Context) error {
 			line.LoginAuthURLHandler(line.LinkAccount))
 	}
 
+	if provider := cfg.Providers.Facebook; provider.App.ID != "" {
+		facebook.SetConfig(provider)
+
+		// GET /auth/facebook
+		r.GET("/auth/facebook", facebook.LoginAuthURLHandler(facebook.SignIn))
+
+		// GET /auth/facebook/callback
+		r.GET("/auth/facebook/callback",
+			facebook.AuthCallback(endpoints.SignIn, endpoints.AddSocialAccount))
+
+		// GET /auth/facebook/link/:user
+		r.GET("/auth/facebook/link/:user",
+			auth("identity::users.update", transHTTP.Owner),
+			facebook.LoginAuthURLHandler(facebook.LinkAccount))
+	}
+
+	codes, err := inmem.NewAuthorizationCodeStore()
+	if err != nil {
+		return err
+	}
+	defer codes.Close()
+
+	oidcSvc := oidc.NewService(codes, clientSvc)
+
+	deviceAuthorizations, err := inmem.NewDeviceAuthorizationStore()
+	if err != nil {
+		return err
+	}
+	defer deviceAuthorizations.Close()
+
+	deviceSvc := device.NewService(deviceAuthorizations, clientSvc, 0)
+
+	oauth2 := r.Group("/oauth2")
+	{
+		// GET /oauth2/authorize
+		{
+			endpoint := oidc.ValidateEndpoint(oidcSvc)
+			oauth2.GET("/authorize", transHTTP.AuthorizeHandler(endpoint))
+		}
+
+		// POST /oauth2/authorize
+		{
+			endpoint := oidc.AuthorizeEndpoint(oidcSvc)
+			oauth2.POST("/authorize", transHTTP.AuthorizeCodeHandler(endpoint))
+		}
+
+		// POST /oauth2/token
+		oauth2.POST("/token", transHTTP.TokenHandler(
+			oidc.ExchangeEndpoint(oidcSvc),
+			oidc.AuthenticateClientEndpoint(oidcSvc),
+			oidc.ClientCredentialsEndpoint(oidcSvc),
+			device.PollEndpoint(deviceSvc),
+			endpoints.User,
+			issueRefresh,
+			rotateRefresh,
+		))
+
+		// POST /oauth2/device_authorization
+		{
+			endpoint := device.AuthorizeEndpoint(deviceSvc)
+			oauth2.POST("/device_authorization", transHTTP.DeviceAuthorizationHandler(endpoint))
+		}
+
+		// GET /oauth2/device/:code
+		{
+			endpoint := device.LookupEndpoint(deviceSvc)
+			oauth2.GET("/device/:code", transHTTP.DeviceHandler(endpoint))
+		}
+
+		// POST /oauth2/device
+		{
+			endpoint := device.DecideEndpoint(deviceSvc)
+			oauth2.POST("/device", transHTTP.DeviceDecisionHandler(endpoint))
+		}
+
+		// POST /oauth2/introspect
+		oauth2.POST("/introspect", transHTTP.IntrospectHandler(introspect))
+
+		// POST /oauth2/revoke
+		oauth2.POST("/revoke", transHTTP.RevokeHandler(revokeToken))
+
+		// GET, POST /oauth2/userinfo
+		oauth2.GET("/userinfo", transHTTP.UserInfoHandler(endpoints.User))
+		oauth2.POST("/userinfo", transHTTP.UserInfoHandler(endpoints.User))
+	}
+
 	apiV1 := r.Group("/identity/v1")
 	{
 		// PATCH /signin
-		apiV1.PATCH("/signin", transHTTP.SignInHandler(endpoints.SignIn))
+		apiV1.PATCH("/signin", transHTTP.SignInHandler(endpoints.SignIn, issueRefresh))
+
+		// PATCH /signin/mfa
+		apiV1.PATCH("/signin/mfa", transHTTP.VerifySecondFactorHandler(endpoints.VerifySecondFactor, issueRefresh))
+
+		// PATCH /signin/link
+		apiV1.PATCH("/signin/link", transHTTP.CompleteLinkHandler(endpoints.CompleteLink, issueRefresh))
+
+		// POST /signout
+		{
+			endpoint := revocation.RevokeEndpoint(revocations)
+			apiV1.POST("/signout", transHTTP.SignOutHandler(endpoint, revokeRefresh))
+		}
 
 		// POST /users
-		// apiV1.POST("/users", transHTTP.RegisterHandler(endpoints.Register))
+		apiV1.POST("/users", transHTTP.RegisterHandler(endpoints.Register))
+
+		// POST /users/:user/otp
+		apiV1.POST("/users/:user/otp",
+			transHTTP.SendOTPHandler(endpoints.SendOTP))
 
-		// PATCH /users/:user/verify
+		// POST /users/:user/verify
 		apiV1.POST("/users/:user/verify",
-			auth("identity::users.update", transHTTP.Owner),
 			transHTTP.OTPVerifyHandler(endpoints.OTPVerify))
 
 		// PUT /users/:user/socials
@@ -333,23 +814,123 @@ func run(cli *cli.Context) error {
 			auth("identity::users.update", transHTTP.Owner),
 			transHTTP.RemoveSocialAccountHandler(endpoints.RemoveSocialAccount))
 
+		// POST /users/:user/totp
+		apiV1.POST("/users/:user/totp",
+			auth("identity::users.update", transHTTP.Owner),
+			transHTTP.EnrollTOTPHandler(endpoints.EnrollTOTP))
+
+		// PUT /users/:user/totp
+		apiV1.PUT("/users/:user/totp",
+			auth("identity::users.update", transHTTP.Owner),
+			transHTTP.ConfirmTOTPHandler(endpoints.ConfirmTOTP))
+
+		// DELETE /users/:user/totp
+		apiV1.DELETE("/users/:user/totp",
+			auth("identity::users.update", transHTTP.Owner),
+			transHTTP.DisableTOTPHandler(endpoints.DisableTOTP))
+
 		// POST /users/:user/passkeys/register
 		apiV1.POST("/users/:user/passkeys/register",
 			auth("identity::users.update", transHTTP.Owner),
 			transHTTP.RegisterPasskeyHandler(endpoints.RegisterPasskey))
 
+		// GET /users
+		apiV1.GET("/users",
+			auth("identity::users.list", transHTTP.Admin),
+			transHTTP.UsersHandler(endpoints.Users))
+
+		// GET /users/search
+		apiV1.GET("/users/search",
+			auth("identity::users.search", transHTTP.Admin),
+			transHTTP.SearchUsersHandler(endpoints.SearchUsers))
+
 		// GET /users/:user
 		apiV1.GET("/users/:user",
 			auth("identity::users.get", transHTTP.Owner),
 			transHTTP.UserHandler(endpoints.User))
 
+		// PATCH /users/:user
+		apiV1.PATCH("/users/:user",
+			auth("identity::users.update", transHTTP.Owner),
+			transHTTP.UpdateUserHandler(endpoints.UpdateUser, revokeSessions...))
+
+		// POST /users/:user/email/verify
+		apiV1.POST("/users/:user/email/verify",
+			auth("identity::users.update", transHTTP.Owner),
+			transHTTP.VerifyEmailHandler(endpoints.VerifyEmail))
+
+		// POST /users/:user/email/verification
+		apiV1.POST("/users/:user/email/verification",
+			auth("identity::users.update", transHTTP.Owner),
+			transHTTP.SendEmailVerificationHandler(endpoints.SendEmailVerification))
+
+		// GET /email/verification
+		apiV1.GET("/email/verification",
+			transHTTP.ConfirmEmailVerificationHandler(endpoints.ConfirmEmailVerification))
+
 		// DELETE /users/:user
 		apiV1.DELETE("/users/:user",
 			auth("identity::users.delete", transHTTP.Owner),
-			transHTTP.DeleteUserHandler(endpoints.DeleteUser))
+			transHTTP.DeleteUserHandler(endpoints.DeleteUser, revokeSessions...))
+
+		// PUT /users/:user/lock
+		apiV1.PUT("/users/:user/lock",
+			auth("identity::users.lock", transHTTP.Admin),
+			transHTTP.LockUserHandler(endpoints.LockUser, revokeSessions...))
+
+		// DELETE /users/:user/lock
+		apiV1.DELETE("/users/:user/lock",
+			auth("identity::users.lock", transHTTP.Admin),
+			transHTTP.UnlockUserHandler(endpoints.UnlockUser))
+
+		// DELETE /users/:user/sessions
+		apiV1.DELETE("/users/:user/sessions",
+			auth("identity::users.revoke", transHTTP.Admin),
+			transHTTP.RevokeSessionsHandler(revokeSessions...))
 
 		// PATCH /token/refresh
-		apiV1.PATCH("/token/refresh", transHTTP.RefreshHandler)
+		if rotateRefresh != nil {
+			apiV1.PATCH("/token/refresh", transHTTP.RefreshHandler(rotateRefresh, endpoints.User))
+		}
+
+		clientEndpoints := client.EndpointSet{
+			Register:     client.RegisterEndpoint(clientSvc),
+			Update:       client.UpdateEndpoint(clientSvc),
+			RotateSecret: client.RotateSecretEndpoint(clientSvc),
+			Delete:       client.DeleteEndpoint(clientSvc),
+			Client:       client.ClientEndpoint(clientSvc),
+			Clients:      client.ClientsEndpoint(clientSvc),
+		}
+
+		// GET /clients
+		apiV1.GET("/clients",
+			auth("identity::clients.list", transHTTP.Admin),
+			transHTTP.ClientsHandler(clientEndpoints.Clients))
+
+		// POST /clients
+		apiV1.POST("/clients",
+			auth("identity::clients.create", transHTTP.Admin),
+			transHTTP.RegisterClientHandler(clientEndpoints.Register))
+
+		// GET /clients/:client
+		apiV1.GET("/clients/:client",
+			auth("identity::clients.get", transHTTP.Admin),
+			transHTTP.ClientHandler(clientEndpoints.Client))
+
+		// PUT /clients/:client
+		apiV1.PUT("/clients/:client",
+			auth("identity::clients.update", transHTTP.Admin),
+			transHTTP.UpdateClientHandler(clientEndpoints.Update))
+
+		// POST /clients/:client/secret
+		apiV1.POST("/clients/:client/secret",
+			auth("identity::clients.update", transHTTP.Admin),
+			transHTTP.ClientHandler(clientEndpoints.RotateSecret))
+
+		// DELETE /clients/:client
+		apiV1.DELETE("/clients/:client",
+			auth("identity::clients.delete", transHTTP.Admin),
+			transHTTP.ClientHandler(clientEndpoints.Delete))
 
 		// POST /passkeys/registration
 		{
@@ -364,7 +945,7 @@ func run(cli *cli.Context) error {
 	if cli.Bool("mtls-enabled") {
 		r := gin.Default()
 		r.GET("/.well-known/jwks.json", transHTTP.JWKHandler)
-		r.GET("/users/:subject", transHTTP.DirectUserBySocialIDHandler(endpoints.UserBySocialID))
+		r.GET("/users/:provider/:subject", transHTTP.DirectUserBySocialAccountHandler(endpoints.UserBySocialAccount))
 
 		challenges, err := inmem.NewChallengeStore()
 		if err != nil {
@@ -396,11 +977,24 @@ func run(cli *cli.Context) error {
 	}
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sign := range quit {
+		// SIGHUP picks up keys rotated by `identity rotatekey`.
+		if sign == syscall.SIGHUP {
+			if err := keys.Reload(keysPath); err != nil {
+				log.Error(err.Error(), zap.String("infra", "keyring"))
+				continue
+			}
+
+			log.Info("keys reloaded", zap.String("active", keys.Active().ID))
+			continue
+		}
 
-	sign := <-quit
+		log.Info("shutdown", zap.String("singal", sign.String()))
+		break
+	}
 
-	log.Info("shutdown", zap.String("singal", sign.String()))
 	return nil
 }
 
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,17 +14,33 @@ import (
 	"github.com/flarexio/core/pubsub"
 	"github.com/flarexio/identity"
 	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/keyring"
+	"github.com/flarexio/identity/lockout"
+	"github.com/flarexio/identity/mail"
+	"github.com/flarexio/identity/otp"
 	"github.com/flarexio/identity/passkeys"
 	"github.com/flarexio/identity/persistence"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/ticket"
+	"github.com/flarexio/identity/totp"
 	"github.com/flarexio/identity/user"
+	"github.com/flarexio/identity/verification"
+
+	transPubSub "github.com/flarexio/identity/transport/pubsub"
 )
 
 type identityTestSuite struct {
 	suite.Suite
-	cfg   *conf.Config
-	ps    pubsub.PubSub
-	svc   identity.Service
-	users user.Repository
+	cfg     *conf.Config
+	ps      pubsub.PubSub
+	svc     identity.Service
+	users   user.Repository
+	codes   chan string
+	mailer  *mail.InMemSender
+	tickets ticket.Store
+
+	// newService builds another service on the same stores but users.
+	newService func(users user.Repository, linking user.LinkPolicy) identity.Service
 }
 
 func (suite *identityTestSuite) SetupSuite() {
@@ -52,28 +71,191 @@ func (suite *identityTestSuite) SetupSuite() {
 		return
 	}
 
-	svc := identity.NewService(users, passkeysSvc, cfg.Providers)
+	otpStore, err := inmem.NewOTPStore()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	codes := make(chan string, 1)
+	otpSender := otp.SenderFunc(func(to string, code string) error {
+		codes <- code
+		return nil
+	})
+
+	otpSvc := otp.NewService(otpStore, otpSender, 0)
+
+	// The example privkey is a placeholder that cannot sign.
+	key, err := keyring.GenerateKey()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	mailer := mail.NewInMemSender()
+	verificationSvc := verification.NewService(keyring.New(key), mailer, cfg.Mail.VerifyURL, 0)
+
+	totpSvc, err := totp.NewService(cfg.MFA)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	tickets, err := inmem.NewTicketStore()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	providers, err := identity.DefaultProviderRegistry(cfg.Providers, passkeysSvc)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	// A provider an embedder could register: the credential is the subject.
+	custom := identity.SocialProviderFunc(func(ctx context.Context, credential string) (*identity.SocialIdentity, error) {
+		return &identity.SocialIdentity{
+			Subject: credential,
+			Email:   credential + "@example.com",
+			Picture: "https://example.com/" + credential + ".png",
+		}, nil
+	})
+
+	if err := providers.Register("custom", custom); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	// One that accepts no credential at all.
+	failing := identity.SocialProviderFunc(func(ctx context.Context, credential string) (*identity.SocialIdentity, error) {
+		return nil, errors.New("invalid credential")
+	})
+
+	if err := providers.Register("failing", failing); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	// One that vouches for the email it shares.
+	trusted := identity.SocialProviderFunc(func(ctx context.Context, credential string) (*identity.SocialIdentity, error) {
+		return &identity.SocialIdentity{
+			Subject:       credential,
+			Email:         credential + "@example.com",
+			EmailVerified: true,
+		}, nil
+	})
+
+	if err := providers.Register("trusted", trusted); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	sync := cfg.Providers.Sync
+	profilePolicy, err := user.NewProfilePolicy(sync.Name, sync.Email, sync.Avatar)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	reservations, err := inmem.NewReservationStore()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	linkPolicy, err := user.ParseLinkPolicy(cfg.Providers.Linking)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	search, err := persistence.NewSearchIndex(cfg.Persistence, users)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	lockoutStore, err := inmem.NewLockoutStore()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	lockouts := identity.Lockouts{
+		Users: lockout.NewService(lockoutStore, cfg.Lockout.User),
+		IPs:   lockout.NewService(lockoutStore, cfg.Lockout.IP),
+	}
+
+	newService := func(users user.Repository, linking user.LinkPolicy) identity.Service {
+		return identity.NewService(users, search, reservations, otpSvc, verificationSvc, totpSvc, tickets, passkeysSvc, providers, profilePolicy, linking, lockouts)
+	}
+
+	svc := newService(users, linkPolicy)
+
+	// Project events back into the repository, as the JetStream consumer does.
+	handler := transPubSub.EventHandler(identity.EventEndpoint(svc))
+	if err := ps.Subscribe("users.#", handler); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
 
 	suite.cfg = cfg
 	suite.ps = ps
 	suite.svc = svc
 	suite.users = users
+	suite.codes = codes
+	suite.mailer = mailer
+	suite.tickets = tickets
+	suite.newService = newService
 }
 
 func (suite *identityTestSuite) TestRegister() {
-	u, err := suite.svc.Register("user01", "User01", "user01@example.com")
-	if err != nil {
+	eventReceived := make(chan *pubsub.Message, 1)
+	if err := suite.ps.Subscribe("users.#.registered", func(ctx context.Context, msg *pubsub.Message) error {
+		eventReceived <- msg
+		return nil
+	}); err != nil {
 		suite.Fail(err.Error())
 		return
 	}
 
-	u.Register()
+	u, err := suite.svc.Register(" User01 ", "User01", "User01@Example.com")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
 
 	suite.Equal("user01", u.Username)
 	suite.Equal("user01@example.com", u.Email)
 	suite.Equal(user.Registered, u.Status)
 
-	suite.Equal(user.UserRegistered.String(), u.Events()[0].EventName())
+	select {
+	case msg := <-eventReceived:
+		suite.Contains(msg.Topic, "users."+u.ID.String()+".registered")
+	case <-time.After(5 * time.Second):
+		suite.Fail("expected user.registered event")
+		return
+	}
+
+	suite.Eventually(func() bool {
+		_, err := suite.users.FindByUsername("user01")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.Register("user01", "User01", "user01@example.com")
+	suite.ErrorIs(err, user.ErrUserExists)
+}
+
+func (suite *identityTestSuite) TestRegisterInvalid() {
+	_, err := suite.svc.Register("admin", "Admin", "admin@example.com")
+	suite.ErrorIs(err, user.ErrUsernameReserved)
+
+	_, err = suite.svc.Register("x", "X", "x@example.com")
+	suite.ErrorIs(err, user.ErrUsernameInvalid)
+
+	_, err = suite.svc.Register("user03", "User03", "User03 <user03@example.com>")
+	suite.ErrorIs(err, user.ErrEmailInvalid)
 }
 
 func (suite *identityTestSuite) TestRegisterAndVerify() {
@@ -83,17 +265,14 @@ func (suite *identityTestSuite) TestRegisterAndVerify() {
 		return
 	}
 
-	u.Register()
-
 	suite.Equal("user02", u.Username)
 	suite.Equal("user02@example.com", u.Email)
 	suite.Equal(user.Registered, u.Status)
-	suite.Equal(user.UserRegistered.String(), u.Events()[0].EventName())
 
-	if err := suite.users.Store(u); err != nil {
-		suite.Fail(err.Error())
-		return
-	}
+	suite.Eventually(func() bool {
+		_, err := suite.users.FindByUsername("user02")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
 
 	eventReceived := make(chan *pubsub.Message, 1)
 	if err := suite.ps.Subscribe("users.#.activated", func(ctx context.Context, msg *pubsub.Message) error {
@@ -104,7 +283,23 @@ func (suite *identityTestSuite) TestRegisterAndVerify() {
 		return
 	}
 
-	u, err = suite.svc.OTPVerify("TODO", u.Username)
+	if err := suite.svc.SendOTP(u.Username); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	var code string
+	select {
+	case code = <-suite.codes:
+	case <-time.After(5 * time.Second):
+		suite.Fail("expected otp to be sent")
+		return
+	}
+
+	_, err = suite.svc.OTPVerify("000000x", u.Username)
+	suite.ErrorIs(err, otp.ErrCodeInvalid)
+
+	u, err = suite.svc.OTPVerify(code, u.Username)
 	if err != nil {
 		suite.Fail(err.Error())
 		return
@@ -122,6 +317,731 @@ func (suite *identityTestSuite) TestRegisterAndVerify() {
 	}
 }
 
+func (suite *identityTestSuite) TestTOTP() {
+	u := user.NewUser("user04", "User04", "user04@example.com")
+	u.Register()
+	u.Activate()
+	if err := suite.users.Store(u); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	key, err := suite.svc.EnrollTOTP(u.Username)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Contains(key.URI, "otpauth://totp/")
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.TOTP != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.ConfirmTOTP(u.Username, "000000x")
+	suite.ErrorIs(err, totp.ErrCodeInvalid)
+
+	code, _ := totp.Code(key.Secret, time.Now())
+	recoveryCodes, err := suite.svc.ConfirmTOTP(u.Username, code)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Len(recoveryCodes, 10)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.TOTPEnabled()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A sign-in that passed its first factor hands out a ticket like this one.
+	t, _ := ticket.Generate()
+	suite.tickets.Save(t, u.ID.String(), time.Minute)
+
+	signedIn, err := suite.svc.VerifySecondFactor(t, code)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(u.ID, signedIn.ID)
+
+	// Tickets are one-time.
+	_, err = suite.svc.VerifySecondFactor(t, code)
+	suite.ErrorIs(err, ticket.ErrTicketInvalid)
+
+	t, _ = ticket.Generate()
+	suite.tickets.Save(t, u.ID.String(), time.Minute)
+
+	_, err = suite.svc.VerifySecondFactor(t, recoveryCodes[0])
+	suite.NoError(err)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && len(found.TOTP.RecoveryCodes) == 9
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t, _ = ticket.Generate()
+	suite.tickets.Save(t, u.ID.String(), time.Minute)
+
+	_, err = suite.svc.VerifySecondFactor(t, recoveryCodes[0])
+	suite.ErrorIs(err, identity.ErrSecondFactorInvalid)
+}
+
+func (suite *identityTestSuite) TestSignInWithCustomProvider() {
+	ctx := context.Background()
+	u, err := suite.svc.SignIn(ctx, "user05", "custom")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal("user05", u.Username)
+	suite.Equal("user05", u.Name)
+	suite.Equal(user.Activated, u.Status)
+	suite.True(u.HasSocialAccount("custom", "user05"))
+
+	existing := user.NewUser("user06", "User06", "user06@flarex.io")
+	existing.Register()
+	existing.Activate()
+	existing.AddSocialAccount("custom", "user06")
+	if err := suite.users.Store(existing); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	// Signing in with a linked account finds its user.
+	u, err = suite.svc.SignIn(ctx, "user06", "custom")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(existing.ID, u.ID)
+
+	// The provider's profile is merged in: the name is kept, the avatar
+	// taken, and the email left alone.
+	suite.Equal("User06", u.Name)
+	suite.Equal("user06@flarex.io", u.Email)
+	suite.Equal("https://example.com/user06.png", u.Avatar)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(existing.ID)
+		return err == nil && found.Avatar == "https://example.com/user06.png"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.AddSocialAccount(ctx, "user06", "custom", "user06")
+	suite.ErrorIs(err, user.ErrSocialAccountExists)
+
+	_, err = suite.svc.SignIn(ctx, "user06", "unknown")
+	suite.ErrorIs(err, identity.ErrProviderNotSupported)
+}
+
+func (suite *identityTestSuite) TestUpdateUser() {
+	u, err := suite.svc.Register("user07", "User07", "user07@example.com")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Eventually(func() bool {
+		_, err := suite.users.FindByUsername("user07")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	name := "User Seven"
+	avatar := "https://example.com/user07.png"
+
+	updated, err := suite.svc.UpdateUser("user07", identity.UserChanges{
+		Name:   &name,
+		Avatar: &avatar,
+	})
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal("User Seven", updated.Name)
+	suite.Equal(avatar, updated.Avatar)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.Name == "User Seven"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	invalid := "http://example.com/user07.png"
+	_, err = suite.svc.UpdateUser("user07", identity.UserChanges{Avatar: &invalid})
+	suite.ErrorIs(err, user.ErrAvatarInvalid)
+
+	// Renaming holds the former username back from everybody else.
+	username := "user07.renamed"
+	_, err = suite.svc.UpdateUser("user07", identity.UserChanges{Username: &username})
+	suite.NoError(err)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.FindByUsername("user07.renamed")
+		return err == nil && found.ID == u.ID
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.users.FindByUsername("user07")
+	suite.ErrorIs(err, user.ErrUserNotFound)
+
+	_, err = suite.svc.Register("user07", "User07", "someone@example.com")
+	suite.ErrorIs(err, user.ErrUsernameReserved)
+
+	taken := "user08"
+	suite.svc.Register(taken, "User08", "user08@example.com")
+	suite.Eventually(func() bool {
+		_, err := suite.users.FindByUsername(taken)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.UpdateUser("user07.renamed", identity.UserChanges{Username: &taken})
+	suite.ErrorIs(err, user.ErrUserExists)
+
+	// The email changes only once the new address is verified.
+	email := "User07@Another.com"
+	updated, err = suite.svc.UpdateUser("user07.renamed", identity.UserChanges{Email: &email})
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal("user07@example.com", updated.Email)
+	suite.Equal("user07@another.com", updated.PendingEmail)
+
+	var code string
+	select {
+	case code = <-suite.codes:
+	case <-time.After(5 * time.Second):
+		suite.Fail("expected email change code")
+		return
+	}
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.PendingEmail == "user07@another.com"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.VerifyEmail("user07.renamed", "000000x")
+	suite.ErrorIs(err, otp.ErrCodeInvalid)
+
+	verified, err := suite.svc.VerifyEmail("user07.renamed", code)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal("user07@another.com", verified.Email)
+	suite.Empty(verified.PendingEmail)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.Email == "user07@another.com" && found.PendingEmail == ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.VerifyEmail("user07.renamed", code)
+	suite.ErrorIs(err, user.ErrEmailChangeNotRequested)
+
+	// The former owner may take the name back.
+	username = "user07"
+	_, err = suite.svc.UpdateUser("user07.renamed", identity.UserChanges{Username: &username})
+	suite.NoError(err)
+}
+
+func (suite *identityTestSuite) TestEmailVerification() {
+	u, err := suite.svc.Register("user09", "User09", "user09@example.com")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.False(u.EmailVerified)
+
+	suite.Eventually(func() bool {
+		_, err := suite.users.FindByUsername("user09")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	if err := suite.svc.SendEmailVerification("user09"); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	messages := suite.mailer.Messages("user09@example.com")
+	if !suite.Len(messages, 1) {
+		return
+	}
+
+	var token string
+	for _, line := range strings.Split(messages[0].Body, "\n") {
+		if link, err := url.Parse(line); err == nil && link.Query().Has("token") {
+			token = link.Query().Get("token")
+		}
+	}
+
+	_, err = suite.svc.ConfirmEmailVerification(token + "x")
+	suite.ErrorIs(err, verification.ErrTokenInvalid)
+
+	verified, err := suite.svc.ConfirmEmailVerification(token)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.True(verified.EmailVerified)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.EmailVerified
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = suite.svc.SendEmailVerification("user09")
+	suite.ErrorIs(err, user.ErrEmailAlreadyVerified)
+
+	_, err = suite.svc.ConfirmEmailVerification(token)
+	suite.ErrorIs(err, user.ErrEmailAlreadyVerified)
+
+	// Users of a provider that vouches for their email start out verified.
+	u, err = suite.svc.SignIn(context.Background(), "user10", "trusted")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.True(u.EmailVerified)
+
+	u, err = suite.svc.SignIn(context.Background(), "user11", "custom")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.False(u.EmailVerified)
+}
+
+func (suite *identityTestSuite) TestLinkByVerifiedEmail() {
+	ctx := context.Background()
+
+	existing := user.NewUser("user12", "User12", "user12@example.com")
+	existing.Register()
+	existing.Activate()
+	existing.VerifyEmail()
+	existing.AddSocialAccount("custom", "user12.old")
+	if err := suite.users.Store(existing); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	svc := suite.newService(suite.users, user.LinkVerified)
+
+	// Both sides vouch for the email: linked.
+	u, err := svc.SignIn(ctx, "user12", "trusted")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(existing.ID, u.ID)
+	suite.True(u.HasSocialAccount("trusted", "user12"))
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.FindBySocialAccount("trusted", "user12")
+		return err == nil && found.ID == existing.ID
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The provider does not: a user of its own.
+	u, err = svc.SignIn(ctx, "user12", "custom")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.NotEqual(existing.ID, u.ID)
+	suite.NotEqual("user12", u.Username)
+}
+
+func (suite *identityTestSuite) TestLinkByVerifiedEmailCase() {
+	ctx := context.Background()
+
+	existing := user.NewUser("user25", "User25", "user25@example.com")
+	existing.Register()
+	existing.Activate()
+	existing.VerifyEmail()
+	if err := suite.users.Store(existing); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	svc := suite.newService(suite.users, user.LinkVerified)
+
+	// Providers may not share the email as it was registered.
+	u, err := svc.SignIn(ctx, "User25", "trusted")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(existing.ID, u.ID)
+	suite.True(u.HasSocialAccount("trusted", "User25"))
+}
+
+func (suite *identityTestSuite) TestLinkByPrompt() {
+	ctx := context.Background()
+
+	existing := user.NewUser("user13", "User13", "user13@example.com")
+	existing.Register()
+	existing.Activate()
+	existing.AddSocialAccount("custom", "user13.old")
+	if err := suite.users.Store(existing); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	another := user.NewUser("user14", "User14", "user14@example.com")
+	another.Register()
+	another.Activate()
+	another.AddSocialAccount("custom", "user14.old")
+	if err := suite.users.Store(another); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	signIn := func() string {
+		_, err := suite.svc.SignIn(ctx, "user13", "trusted")
+
+		var linkErr *identity.LinkRequiredError
+		if !errors.As(err, &linkErr) {
+			suite.Fail("expected link required", err)
+			return ""
+		}
+
+		return linkErr.Ticket
+	}
+
+	t := signIn()
+
+	// Only a sign-in to the existing account proves it is theirs.
+	_, err := suite.svc.CompleteLink(ctx, t, "nobody", "custom", "")
+	suite.ErrorIs(err, identity.ErrLinkInvalid)
+
+	_, err = suite.svc.CompleteLink(ctx, t, "user14.old", "custom", "")
+	suite.ErrorIs(err, identity.ErrLinkInvalid)
+
+	// A failed proof burns the ticket.
+	_, err = suite.svc.CompleteLink(ctx, t, "user13.old", "custom", "")
+	suite.ErrorIs(err, ticket.ErrTicketInvalid)
+
+	t = signIn()
+
+	u, err := suite.svc.CompleteLink(ctx, t, "user13.old", "custom", "")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(existing.ID, u.ID)
+	suite.True(u.HasSocialAccount("trusted", "user13"))
+
+	suite.Eventually(func() bool {
+		found, err := suite.svc.SignIn(ctx, "user13", "trusted")
+		return err == nil && found.ID == existing.ID
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (suite *identityTestSuite) TestLockUser() {
+	ctx := context.Background()
+
+	u := user.NewUser("user15", "User15", "user15@example.com")
+	u.Register()
+	u.Activate()
+	u.AddSocialAccount("custom", "user15")
+	if err := suite.users.Store(u); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	locked, err := suite.svc.LockUser("user15", "abuse")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(user.Locked, locked.Status)
+
+	suite.Eventually(func() bool {
+		found, err := suite.users.Find(u.ID)
+		return err == nil && found.Status == user.Locked
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = suite.svc.SignIn(ctx, "user15", "custom")
+	suite.ErrorIs(err, user.ErrUserLocked)
+
+	_, err = suite.svc.LockUser("user15", "abuse")
+	suite.ErrorIs(err, user.ErrUserLocked)
+
+	// Verifying an email code does not lift the lock.
+	_, err = suite.svc.OTPVerify("000000", "user15")
+	suite.ErrorIs(err, user.ErrUserLocked)
+
+	unlocked, err := suite.svc.UnlockUser("user15")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(user.Activated, unlocked.Status)
+
+	suite.Eventually(func() bool {
+		_, err := suite.svc.SignIn(ctx, "user15", "custom")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Users never activated get no tokens either.
+	registered := user.NewUser("user16", "User16", "user16@example.com")
+	registered.Register()
+	registered.AddSocialAccount("custom", "user16")
+	if err := suite.users.Store(registered); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	_, err = suite.svc.SignIn(ctx, "user16", "custom")
+	suite.ErrorIs(err, user.ErrUserNotActivated)
+}
+
+func (suite *identityTestSuite) TestLockoutByClientIP() {
+	ctx := context.WithValue(context.Background(), user.ClientIP, "192.0.2.1")
+
+	for range suite.cfg.Lockout.IP.Threshold {
+		_, err := suite.svc.SignIn(ctx, "credential", "failing")
+		suite.ErrorIs(err, identity.ErrCredentialInvalid)
+	}
+
+	// Even a valid credential has to wait.
+	_, err := suite.svc.SignIn(ctx, "user17", "custom")
+	suite.ErrorIs(err, lockout.ErrLockedOut)
+
+	ctx = context.WithValue(context.Background(), user.ClientIP, "192.0.2.2")
+	_, err = suite.svc.SignIn(ctx, "user17", "custom")
+	suite.NoError(err)
+}
+
+func (suite *identityTestSuite) TestLockoutByUser() {
+	u, err := suite.svc.Register("user18", "User18", "user18@example.com")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Eventually(func() bool {
+		_, err := suite.users.FindByUsername("user18")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	if err := suite.svc.SendOTP(u.Username); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	code := <-suite.codes
+
+	for range suite.cfg.Lockout.User.Threshold {
+		_, err := suite.svc.OTPVerify("000000x", u.Username)
+		suite.ErrorIs(err, otp.ErrCodeInvalid)
+	}
+
+	_, err = suite.svc.OTPVerify(code, u.Username)
+	suite.ErrorIs(err, lockout.ErrLockedOut)
+
+	// An admin may lift it early.
+	_, err = suite.svc.UnlockUser(u.Username)
+	suite.NoError(err)
+
+	if err := suite.svc.SendOTP(u.Username); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	_, err = suite.svc.OTPVerify(<-suite.codes, u.Username)
+	suite.NoError(err)
+}
+
+func (suite *identityTestSuite) TestUsers() {
+	for _, name := range []string{"user19", "user20"} {
+		u := user.NewUser(name, name, name+"@query.example.com")
+		if err := suite.users.Store(u); err != nil {
+			suite.Fail(err.Error())
+			return
+		}
+	}
+
+	// Emails are matched as stored: in lower case.
+	page, err := suite.svc.Users(&user.Query{EmailPrefix: "USER19@QUERY"})
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Len(page.Users, 1)
+	suite.Equal("user19", page.Users[0].Username)
+
+	page, err = suite.svc.Users(&user.Query{UsernamePrefix: "user", Limit: 1, Sort: user.SortNewest})
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Len(page.Users, 1)
+	suite.Equal("user20", page.Users[0].Username)
+	suite.NotEmpty(page.NextCursor)
+}
+
+func (suite *identityTestSuite) TestSearchUsers() {
+	u, err := suite.svc.Register("user21", "Marguerite Duras", "user21@search.example.com")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	// The index follows the projection.
+	suite.Eventually(func() bool {
+		users, err := suite.svc.SearchUsers("margu dur", 0)
+		return err == nil && len(users) == 1 && users[0].ID == u.ID
+	}, 5*time.Second, 10*time.Millisecond)
+
+	users, err := suite.svc.SearchUsers("search.example", 0)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Len(users, 1)
+	suite.Equal("user21", users[0].Username)
+
+	_, err = suite.svc.SearchUsers(" @ ", 0)
+	suite.ErrorIs(err, user.ErrSearchQueryEmpty)
+
+	if err := suite.svc.DeleteUser("user21"); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Eventually(func() bool {
+		users, err := suite.svc.SearchUsers("margu", 0)
+		return err == nil && len(users) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// racingRepository lets somebody else store the user first, once, as
+// another instance consuming the same stream would.
+type racingRepository struct {
+	user.Repository
+	raced bool
+}
+
+func (repo *racingRepository) Store(u *user.User) error {
+	if !repo.raced {
+		repo.raced = true
+
+		other, err := repo.Find(u.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := repo.Repository.Store(other); err != nil {
+			return err
+		}
+	}
+
+	return repo.Repository.Store(u)
+}
+
+func (suite *identityTestSuite) TestProjectionRetry() {
+	u := user.NewUser("user22", "User22", "user22@example.com")
+	if err := suite.users.Store(u); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	users := &racingRepository{Repository: suite.users}
+
+	handler, err := suite.newService(users, user.LinkVerified).Handler()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	e := user.NewUserLockedEvent(u, "retry").(*user.UserLockedEvent)
+
+	// The first attempt loses the race; the second starts over from the
+	// version stored meanwhile.
+	err = handler.UserLockedHandler(e)
+	suite.NoError(err)
+	suite.True(users.raced)
+
+	found, err := suite.users.Find(u.ID)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.Equal(user.Locked, found.Status)
+	suite.Equal(3, found.Version)
+}
+
+func (suite *identityTestSuite) TestRegisteredRedelivery() {
+	// Stored, but the index never heard of it.
+	u := user.NewUser("user24", "User24", "user24@redelivery.example.com")
+	u.Register()
+
+	e := u.Events()[0].(*user.UserRegisteredEvent)
+
+	if err := suite.users.Store(u); err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	handler, err := suite.svc.Handler()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.NoError(handler.UserRegisteredHandler(e))
+
+	users, err := suite.svc.SearchUsers("redelivery.example", 0)
+	suite.NoError(err)
+	suite.Len(users, 1)
+}
+
+func (suite *identityTestSuite) TestSignInUsername() {
+	ctx := context.Background()
+
+	// A reserved local part does not make its owner "admin".
+	u, err := suite.svc.SignIn(ctx, "admin", "trusted")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.NotEqual("admin", u.Username)
+	suite.True(strings.HasPrefix(u.Username, "admin."))
+	suite.NoError(user.ValidateUsername(u.Username))
+
+	// Nor does one outside the username rules make an invalid username.
+	u, err = suite.svc.SignIn(ctx, "User23+Tag", "trusted")
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.True(strings.HasPrefix(u.Username, "user."))
+	suite.NoError(user.ValidateUsername(u.Username))
+}
+
 func (suite *identityTestSuite) TestSignInWithGoogle() {
 	token := suite.cfg.Test.Tokens.Google
 	if token == "YOUR_GOOGLE_JWT_TOKEN" {
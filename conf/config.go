@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -65,6 +66,18 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if cfg.OIDC.Issuer == "" {
+		cfg.OIDC.Issuer = "https://" + cfg.BaseURL
+	}
+
+	if cfg.OIDC.DeviceURL == "" {
+		cfg.OIDC.DeviceURL = cfg.OIDC.Issuer + "/device"
+	}
+
+	if cfg.Mail.VerifyURL == "" {
+		cfg.Mail.VerifyURL = cfg.OIDC.Issuer + "/identity/v1/email/verification"
+	}
+
 	return cfg, nil
 }
 
@@ -73,18 +86,55 @@ type Config struct {
 	BaseURL     string      `yaml:"baseUrl"`
 	JWT         JWT         `yaml:"jwt"`
 	SCEP        SCEP        `yaml:"scep"`
+	MFA         MFA         `yaml:"mfa"`
+	Lockout     Lockout     `yaml:"lockout"`
+	OIDC        OIDC        `yaml:"oidc"`
+	Mail        Mail        `yaml:"mail"`
 	Persistence Persistence `yaml:"persistence"`
 	EventBus    EventBus    `yaml:"eventBus"`
 	Providers   Providers   `yaml:"providers"`
 	Test        Test        `yaml:"test"`
 }
 
+// OIDC configures the OpenID Connect provider.
+type OIDC struct {
+	Issuer    string       `yaml:"issuer"`    // https URL; defaults to https://<baseUrl>
+	LoginURL  string       `yaml:"loginUrl"`  // where /oauth2/authorize sends the browser to sign in
+	DeviceURL string       `yaml:"deviceUrl"` // verification page of the device flow; defaults to <issuer>/device
+	Clients   []OIDCClient `yaml:"clients"`   // seeded into the client registry at startup
+}
+
+type OIDCClient struct {
+	ID           string   `yaml:"id"`
+	Name         string   `yaml:"name"`
+	Secret       string   `yaml:"secret"` // empty for public clients, which must use PKCE
+	RedirectURIs []string `yaml:"redirectUris"`
+	GrantTypes   []string `yaml:"grantTypes"` // defaults to authorization_code and refresh_token
+	Audience     string   `yaml:"audience"`
+	Scopes       []string `yaml:"scopes"` // roles of its client_credentials tokens
+}
+
+// Mail configures outgoing email; without an SMTP host, mail only reaches
+// the log.
+type Mail struct {
+	From      string `yaml:"from"`
+	SMTP      SMTP   `yaml:"smtp"`
+	VerifyURL string `yaml:"verifyUrl"` // where verification links point; defaults to <issuer>/identity/v1/email/verification
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // defaults to 587
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
 type JWT struct {
 	Privkey ed25519.PrivateKey
 	Timeout time.Duration
 	Refresh struct {
 		Enabled bool
-		Maximum time.Duration
+		Maximum time.Duration // lifetime of a refresh token
 	}
 	Audiences []string
 	Admins    []string // usernames granted the "admin" role in their token
@@ -185,12 +235,100 @@ func (cfg *SCEP) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// Lockout sets how failed attempts lock users and client IPs out; zero
+// values take the defaults of the lockout package.
+type Lockout struct {
+	User LockoutPolicy `yaml:"user"`
+	IP   LockoutPolicy `yaml:"ip"`
+}
+
+type LockoutPolicy struct {
+	Threshold   int           // failed attempts that start a lockout
+	Window      time.Duration // failures are forgotten after this long without one
+	Duration    time.Duration // of the first lockout; doubled for each one after
+	MaxDuration time.Duration
+}
+
+func (cfg *LockoutPolicy) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Threshold   int    `yaml:"threshold"`
+		Window      string `yaml:"window"`
+		Duration    string `yaml:"duration"`
+		MaxDuration string `yaml:"maxDuration"`
+	}
+
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	cfg.Threshold = raw.Threshold
+
+	for _, d := range []struct {
+		raw string
+		dst *time.Duration
+	}{
+		{raw.Window, &cfg.Window},
+		{raw.Duration, &cfg.Duration},
+		{raw.MaxDuration, &cfg.MaxDuration},
+	} {
+		if d.raw == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.raw)
+		if err != nil {
+			return err
+		}
+
+		*d.dst = duration
+	}
+
+	return nil
+}
+
+// MFA holds the authenticator-app (TOTP) second factor settings.
+type MFA struct {
+	Issuer        string // shown by authenticator apps
+	EncryptionKey []byte // AES key sealing TOTP secrets at rest (empty = TOTP disabled)
+}
+
+func (cfg *MFA) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Issuer        string `yaml:"issuer"`
+		EncryptionKey string `yaml:"encryptionKey"`
+	}
+
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	cfg.Issuer = raw.Issuer
+
+	if raw.EncryptionKey == "" {
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw.EncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	if len(key) != 32 {
+		return errors.New("mfa: encryptionKey must be 32 bytes")
+	}
+
+	cfg.EncryptionKey = key
+	return nil
+}
+
 type PersistenceDriver int
 
 const (
 	SQLite PersistenceDriver = iota
 	BadgerDB
 	InMem
+	Postgres
+	MySQL
 )
 
 func ParsePersistenceDriver(driver string) (PersistenceDriver, error) {
@@ -201,6 +339,10 @@ func ParsePersistenceDriver(driver string) (PersistenceDriver, error) {
 		return BadgerDB, nil
 	case "inmem":
 		return InMem, nil
+	case "postgres":
+		return Postgres, nil
+	case "mysql":
+		return MySQL, nil
 	default:
 		return -1, errors.New("driver not supported")
 	}
@@ -214,6 +356,10 @@ func (driver PersistenceDriver) String() string {
 		return "badger"
 	case InMem:
 		return "inmem"
+	case Postgres:
+		return "postgres"
+	case MySQL:
+		return "mysql"
 	default:
 		return "unknwon"
 	}
@@ -227,17 +373,75 @@ type Persistence struct {
 	Username string
 	Password string
 	InMem    bool
+	TLS      PersistenceTLS
+	Pool     PersistencePool
+}
+
+// PersistenceTLS secures the connection to a database server. Modes follow
+// PostgreSQL's sslmode: disable, require, verify-ca and verify-full.
+type PersistenceTLS struct {
+	Mode     string `yaml:"mode"`
+	CAFile   string `yaml:"caFile"`
+	CertFile string `yaml:"certFile"` // client certificate, optional
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// PersistencePool sizes the connection pool; zero keeps the driver default.
+type PersistencePool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (cfg *PersistencePool) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		MaxOpenConns    int    `yaml:"maxOpenConns"`
+		MaxIdleConns    int    `yaml:"maxIdleConns"`
+		ConnMaxLifetime string `yaml:"connMaxLifetime"`
+		ConnMaxIdleTime string `yaml:"connMaxIdleTime"`
+	}
+
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	cfg.MaxOpenConns = raw.MaxOpenConns
+	cfg.MaxIdleConns = raw.MaxIdleConns
+
+	for _, d := range []struct {
+		raw string
+		dst *time.Duration
+	}{
+		{raw.ConnMaxLifetime, &cfg.ConnMaxLifetime},
+		{raw.ConnMaxIdleTime, &cfg.ConnMaxIdleTime},
+	} {
+		if d.raw == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.raw)
+		if err != nil {
+			return err
+		}
+
+		*d.dst = duration
+	}
+
+	return nil
 }
 
 func (p *Persistence) UnmarshalYAML(value *yaml.Node) error {
 	var raw struct {
-		Driver   string `yaml:"driver"`
-		Name     string `yaml:"name"`
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		Username string `yaml:"username"`
-		Password string `yaml:"password"`
-		InMem    bool   `yaml:"inmem"`
+		Driver   string          `yaml:"driver"`
+		Name     string          `yaml:"name"`
+		Host     string          `yaml:"host"`
+		Port     int             `yaml:"port"`
+		Username string          `yaml:"username"`
+		Password string          `yaml:"password"`
+		InMem    bool            `yaml:"inmem"`
+		TLS      PersistenceTLS  `yaml:"tls"`
+		Pool     PersistencePool `yaml:"pool"`
 	}
 
 	if err := value.Decode(&raw); err != nil {
@@ -252,15 +456,23 @@ func (p *Persistence) UnmarshalYAML(value *yaml.Node) error {
 	p.Driver = driver
 	p.Name = raw.Name
 
+	// Files live next to the config; servers default to this machine.
 	p.Host = raw.Host
 	if raw.Host == "" {
-		p.Host = Path
+		switch driver {
+		case Postgres, MySQL:
+			p.Host = "localhost"
+		default:
+			p.Host = Path
+		}
 	}
 
 	p.Port = raw.Port
 	p.Username = raw.Username
 	p.Password = raw.Password
 	p.InMem = raw.InMem
+	p.TLS = raw.TLS
+	p.Pool = raw.Pool
 
 	return nil
 }
@@ -316,7 +528,19 @@ func (e *EventBus) UnmarshalYAML(value *yaml.Node) error {
 type Providers struct {
 	Google   GoogleProvider   `yaml:"google"`
 	LINE     LineProvider     `yaml:"line"`
+	Facebook FacebookProvider `yaml:"facebook"`
 	Passkeys PasskeysProvider `yaml:"passkeys"`
+	OIDC     []OIDCProvider   `yaml:"oidc"`
+	Sync     ProfileSync      `yaml:"sync"`
+	Linking  string           `yaml:"linking"` // never (the default), verified or prompt
+}
+
+// ProfileSync sets, per field, how the profile a provider sends at sign-in
+// is merged into the user's: always, ifEmpty (the default) or never.
+type ProfileSync struct {
+	Name   string `yaml:"name"`
+	Email  string `yaml:"email"`
+	Avatar string `yaml:"avatar"`
 }
 
 type GoogleProvider struct {
@@ -328,6 +552,31 @@ type LineProvider struct {
 	RedirectURI string   `yaml:"redirectURI"`
 }
 
+type FacebookProvider struct {
+	App         OAuthAPI `yaml:"app"`
+	RedirectURI string   `yaml:"redirectURI"`
+	GraphURL    string   `yaml:"graphURL"`  // defaults to the Graph API version the login dialog uses
+	DialogURL   string   `yaml:"dialogURL"` // defaults to the Facebook Login dialog
+}
+
+// Graph returns the Graph API base URL, without a trailing slash.
+func (p FacebookProvider) Graph() string {
+	if p.GraphURL == "" {
+		return "https://graph.facebook.com/v21.0"
+	}
+
+	return strings.TrimSuffix(p.GraphURL, "/")
+}
+
+// Dialog returns the URL of the Facebook Login dialog.
+func (p FacebookProvider) Dialog() string {
+	if p.DialogURL == "" {
+		return "https://www.facebook.com/v21.0/dialog/oauth"
+	}
+
+	return p.DialogURL
+}
+
 type PasskeysProvider struct {
 	BaseURL     string   `yaml:"baseURL"`
 	TenantID    string   `yaml:"tenantID"`
@@ -336,6 +585,27 @@ type PasskeysProvider struct {
 	Audience    string   `yaml:"audience"`
 }
 
+// OIDCProvider is any OpenID Connect provider whose ID tokens users sign in
+// with, e.g. Microsoft, Apple or a local Keycloak.
+type OIDCProvider struct {
+	Name         string       `yaml:"name"` // the social provider it signs in as; built-in names cannot be reused
+	Issuer       string       `yaml:"issuer"`
+	Client       OAuthAPI     `yaml:"client"`       // the secret verifies HS256 ID tokens
+	DiscoveryURL string       `yaml:"discoveryUrl"` // defaults to <issuer>/.well-known/openid-configuration
+	Algorithms   []string     `yaml:"algorithms"`   // the ID token may be signed with; defaults to RS256 and ES256
+	Claims       ClaimMapping `yaml:"claims"`
+}
+
+// ClaimMapping names the ID token claims a provider keeps the user's
+// details in; empty fields fall back to the standard claim names.
+type ClaimMapping struct {
+	Subject       string `yaml:"subject"`
+	Email         string `yaml:"email"`
+	EmailVerified string `yaml:"emailVerified"`
+	Name          string `yaml:"name"`
+	Picture       string `yaml:"picture"`
+}
+
 type OAuthAPI struct {
 	ID     string `yaml:"id"`
 	Secret string `yaml:"secret"`
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -29,6 +30,59 @@ func TestLoadConfig(t *testing.T) {
 	assert.True(cfg.JWT.Refresh.Enabled)
 	assert.Equal(1*time.Hour+30*time.Minute, cfg.JWT.Refresh.Maximum)
 
+	assert.Equal("FlareX", cfg.MFA.Issuer)
+	assert.Len(cfg.MFA.EncryptionKey, 32)
+
+	assert.Equal("https://identity.flarex.io", cfg.OIDC.Issuer)
+	assert.Equal("https://identity.flarex.io/device", cfg.OIDC.DeviceURL)
+	assert.Equal("https://identity.flarex.io/identity/v1/email/verification", cfg.Mail.VerifyURL)
+	assert.Equal(5, cfg.Lockout.User.Threshold)
+	assert.Equal(20, cfg.Lockout.IP.Threshold)
+	assert.Equal(time.Hour, cfg.Lockout.IP.MaxDuration)
+	assert.Len(cfg.OIDC.Clients, 3)
+	assert.Equal("wallet", cfg.OIDC.Clients[0].ID)
+	assert.Equal("wallet.flarex.io", cfg.OIDC.Clients[0].Audience)
+	assert.Equal([]string{"users.read"}, cfg.OIDC.Clients[2].Scopes)
+
+	assert.Equal("facebook_app_id", cfg.Providers.Facebook.App.ID)
+	assert.Equal("https://graph.facebook.com/v21.0", cfg.Providers.Facebook.Graph())
+
+	assert.Equal("always", cfg.Providers.Sync.Avatar)
+	assert.Equal("prompt", cfg.Providers.Linking)
+
+	assert.Len(cfg.Providers.OIDC, 1)
+	assert.Equal("keycloak", cfg.Providers.OIDC[0].Name)
+	assert.Equal("avatar_url", cfg.Providers.OIDC[0].Claims.Picture)
+
 	assert.Equal(BadgerDB, cfg.Persistence.Driver)
 	assert.Equal("users", cfg.Persistence.Name)
 }
+
+func TestPersistence(t *testing.T) {
+	assert := assert.New(t)
+
+	raw := `
+driver: postgres
+name: identity
+username: identity
+tls:
+  mode: verify-full
+  caFile: /etc/identity/db-ca.pem
+pool:
+  maxOpenConns: 20
+  connMaxLifetime: 30m
+`
+
+	var p Persistence
+	if err := yaml.Unmarshal([]byte(raw), &p); err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal(Postgres, p.Driver)
+	assert.Equal("localhost", p.Host)
+	assert.Equal("verify-full", p.TLS.Mode)
+	assert.Equal("/etc/identity/db-ca.pem", p.TLS.CAFile)
+	assert.Equal(20, p.Pool.MaxOpenConns)
+	assert.Equal(30*time.Minute, p.Pool.ConnMaxLifetime)
+}
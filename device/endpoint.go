@@ -0,0 +1,64 @@
+package device
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/flarexio/identity/oidc"
+)
+
+func AuthorizeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(AuthorizeRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Authorize(req)
+	}
+}
+
+func LookupEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		userCode, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		return svc.Lookup(userCode)
+	}
+}
+
+type DecideRequest struct {
+	UserCode string
+	Subject  string
+	Approve  bool
+}
+
+func DecideEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(DecideRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		if req.Approve {
+			return nil, svc.Approve(req.UserCode, req.Subject)
+		}
+
+		return nil, svc.Deny(req.UserCode, req.Subject)
+	}
+}
+
+func PollEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(oidc.TokenRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Poll(req)
+	}
+}
@@ -0,0 +1,49 @@
+package device
+
+import "time"
+
+type Status int
+
+const (
+	Pending Status = iota
+	Approved
+	Denied
+)
+
+// Authorization is a pending device authorization request (RFC 8628). The
+// device polls with DeviceCode while a user approves UserCode elsewhere.
+type Authorization struct {
+	DeviceCode   string
+	UserCode     string // normalized: no dash, upper case
+	ClientID     string
+	Scope        []string
+	Status       Status
+	Subject      string // username of the user who approved or denied
+	Interval     time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+}
+
+// Store keeps pending device authorizations. Decide and Poll must be atomic,
+// and a decided authorization is handed to its device only once.
+type Store interface {
+	// Command
+
+	Save(a *Authorization) error
+
+	// Decide records the user's answer on a pending authorization.
+	Decide(userCode string, subject string, status Status) error
+
+	// Poll records a poll by clientID and returns the authorization as it
+	// was before; decided authorizations are removed. A poll sooner than
+	// the interval raises it by SlowDownStep. Polls by another client are
+	// neither recorded nor consume the authorization.
+	Poll(deviceCode string, clientID string) (*Authorization, error)
+
+	// Query
+
+	FindByUserCode(userCode string) (*Authorization, error)
+
+	// Close the store
+	Close() error
+}
@@ -0,0 +1,218 @@
+package device
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/oidc"
+)
+
+var (
+	// ErrDeviceCodeInvalid collapses unknown/expired into one error.
+	ErrDeviceCodeInvalid = errors.New("device code invalid")
+
+	// ErrUserCodeInvalid collapses unknown/expired/already decided.
+	ErrUserCodeInvalid = errors.New("user code invalid")
+)
+
+const (
+	defaultTTL      = 10 * time.Minute
+	defaultInterval = 5 * time.Second
+)
+
+// SlowDownStep is what the interval grows by when a device polls too fast;
+// the device adds it as well (RFC 8628, section 3.5).
+const SlowDownStep = 5 * time.Second
+
+// userCodeChars leaves out vowels, so codes do not spell words, and digits,
+// so they are easy to type on a phone (RFC 8628, section 6.1).
+const userCodeChars = "BCDFGHJKLMNPQRSTVWXZ"
+
+type AuthorizeRequest struct {
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	Scope        string `form:"scope"`
+}
+
+// Service implements the device authorization grant. Signing the tokens is
+// left to the transport, as for the authorization code flow.
+type Service interface {
+	Authorize(req AuthorizeRequest) (*Authorization, error)
+	Lookup(userCode string) (*Authorization, error)
+	Approve(userCode string, subject string) error
+	Deny(userCode string, subject string) error
+	Poll(req oidc.TokenRequest) (*Authorization, error)
+}
+
+func NewService(store Store, clients client.Service, ttl time.Duration) Service {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &service{store, clients, ttl}
+}
+
+type service struct {
+	store   Store
+	clients client.Service
+	ttl     time.Duration
+}
+
+func (svc *service) Authorize(req AuthorizeRequest) (*Authorization, error) {
+	c, err := oidc.Authenticate(svc.clients, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.AllowsGrant(client.DeviceCode) {
+		return nil, oidc.ErrUnauthorizedClient
+	}
+
+	scope := strings.Fields(req.Scope)
+	if err := oidc.ValidateScope(scope); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authorization{
+		DeviceCode: base64.RawURLEncoding.EncodeToString(buf),
+		UserCode:   userCode,
+		ClientID:   c.ID,
+		Scope:      scope,
+		Status:     Pending,
+		Interval:   defaultInterval,
+		ExpiresAt:  time.Now().Add(svc.ttl),
+	}
+
+	if err := svc.store.Save(a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Lookup lets the verification page show the user what they are about to
+// approve.
+func (svc *service) Lookup(userCode string) (*Authorization, error) {
+	a, err := svc.store.FindByUserCode(NormalizeUserCode(userCode))
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Status != Pending || time.Now().After(a.ExpiresAt) {
+		return nil, ErrUserCodeInvalid
+	}
+
+	return a, nil
+}
+
+func (svc *service) Approve(userCode string, subject string) error {
+	return svc.decide(userCode, subject, Approved)
+}
+
+func (svc *service) Deny(userCode string, subject string) error {
+	return svc.decide(userCode, subject, Denied)
+}
+
+func (svc *service) decide(userCode string, subject string, status Status) error {
+	if subject == "" {
+		return errors.New("subject required")
+	}
+
+	return svc.store.Decide(NormalizeUserCode(userCode), subject, status)
+}
+
+// Poll answers the device with an OAuth error until the user decides; only
+// an approved authorization is returned.
+func (svc *service) Poll(req oidc.TokenRequest) (*Authorization, error) {
+	if req.GrantType != client.DeviceCode {
+		return nil, oidc.ErrUnsupportedGrantType
+	}
+
+	c, err := oidc.Authenticate(svc.clients, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := svc.store.Poll(req.DeviceCode, c.ID)
+	if err != nil {
+		if errors.Is(err, ErrDeviceCodeInvalid) {
+			return nil, oidc.ErrExpiredToken
+		}
+
+		return nil, err
+	}
+
+	if a.ClientID != c.ID {
+		return nil, oidc.ErrInvalidGrant
+	}
+
+	switch a.Status {
+	case Approved:
+		return a, nil
+
+	case Denied:
+		return nil, oidc.ErrAccessDenied
+
+	default:
+		if time.Since(a.LastPolledAt) < a.Interval {
+			return nil, oidc.ErrSlowDown
+		}
+
+		return nil, oidc.ErrAuthorizationPending
+	}
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, 8)
+	buf := make([]byte, 16)
+
+	for len(code) < cap(code) {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		// Bytes past the largest multiple of len(userCodeChars) would skew
+		// the distribution, so they are dropped.
+		for _, b := range buf {
+			if int(b) >= 256-256%len(userCodeChars) {
+				continue
+			}
+
+			code = append(code, userCodeChars[int(b)%len(userCodeChars)])
+			if len(code) == cap(code) {
+				break
+			}
+		}
+	}
+
+	return string(code), nil
+}
+
+// NormalizeUserCode accepts a user code however it was typed in.
+func NormalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.ReplaceAll(userCode, "-", "")
+	return strings.ReplaceAll(userCode, " ", "")
+}
+
+// FormatUserCode splits a user code in two for display, e.g. WDJB-MJHT.
+func FormatUserCode(userCode string) string {
+	if len(userCode) != 8 {
+		return userCode
+	}
+
+	return userCode[:4] + "-" + userCode[4:]
+}
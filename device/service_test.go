@@ -0,0 +1,229 @@
+package device_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/device"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/persistence/inmem"
+)
+
+var clients = []conf.OIDCClient{
+	{
+		ID:         "mdm",
+		Secret:     "secret",
+		GrantTypes: []string{client.DeviceCode},
+		Audience:   "mdm.flarex.io",
+	},
+	{
+		ID:           "wallet",
+		Audience:     "wallet.flarex.io",
+		RedirectURIs: []string{"https://wallet.flarex.io/callback"},
+	},
+}
+
+func newService(t *testing.T) device.Service {
+	store, _ := inmem.NewDeviceAuthorizationStore()
+	t.Cleanup(func() { store.Close() })
+
+	repo, _ := inmem.NewClientRepository()
+	clientSvc := client.NewService(repo)
+	if err := clientSvc.Seed(clients); err != nil {
+		t.Fatal(err)
+	}
+
+	return device.NewService(store, clientSvc, 0)
+}
+
+func poll(a *device.Authorization) oidc.TokenRequest {
+	return oidc.TokenRequest{
+		GrantType:    client.DeviceCode,
+		DeviceCode:   a.DeviceCode,
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	a, err := svc.Authorize(device.AuthorizeRequest{
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+		Scope:        "openid",
+	})
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Len(a.UserCode, 8)
+	assert.NotEmpty(a.DeviceCode)
+
+	_, err = svc.Poll(poll(a))
+	assert.ErrorIs(err, oidc.ErrAuthorizationPending)
+
+	// Polling faster than the interval is pushed back.
+	_, err = svc.Poll(poll(a))
+	assert.ErrorIs(err, oidc.ErrSlowDown)
+
+	// Users type the code however they like.
+	typed := strings.ToLower(device.FormatUserCode(a.UserCode))
+
+	found, err := svc.Lookup(typed)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("mdm", found.ClientID)
+	assert.Equal([]string{"openid"}, found.Scope)
+
+	err = svc.Approve(typed, "user01")
+	assert.NoError(err)
+
+	// A code is decided once.
+	err = svc.Deny(typed, "user01")
+	assert.ErrorIs(err, device.ErrUserCodeInvalid)
+
+	approved, err := svc.Poll(poll(a))
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("user01", approved.Subject)
+	assert.Equal("mdm", approved.ClientID)
+
+	// The device code is one-time.
+	_, err = svc.Poll(poll(a))
+	assert.ErrorIs(err, oidc.ErrExpiredToken)
+}
+
+func TestDeviceFlowDenied(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	a, _ := svc.Authorize(device.AuthorizeRequest{
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	})
+
+	err := svc.Deny(a.UserCode, "user01")
+	assert.NoError(err)
+
+	_, err = svc.Poll(poll(a))
+	assert.ErrorIs(err, oidc.ErrAccessDenied)
+}
+
+func TestDeviceFlowInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	_, err := svc.Authorize(device.AuthorizeRequest{ClientID: "wallet"})
+	assert.ErrorIs(err, oidc.ErrUnauthorizedClient)
+
+	_, err = svc.Authorize(device.AuthorizeRequest{ClientID: "mdm", ClientSecret: "wrong"})
+	assert.ErrorIs(err, oidc.ErrInvalidClient)
+
+	_, err = svc.Authorize(device.AuthorizeRequest{ClientID: "mdm", ClientSecret: "secret", Scope: "openid admin"})
+	assert.ErrorIs(err, oidc.ErrInvalidScope)
+
+	a, _ := svc.Authorize(device.AuthorizeRequest{
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	})
+
+	req := poll(a)
+	req.DeviceCode = "unknown"
+	_, err = svc.Poll(req)
+	assert.ErrorIs(err, oidc.ErrExpiredToken)
+
+	_, err = svc.Lookup("BCDF-GHJK")
+	assert.ErrorIs(err, device.ErrUserCodeInvalid)
+
+	// Codes run out.
+	store, _ := inmem.NewDeviceAuthorizationStore()
+	defer store.Close()
+
+	store.Save(&device.Authorization{
+		DeviceCode: "expired",
+		UserCode:   "BCDFGHJK",
+		ClientID:   "mdm",
+		ExpiresAt:  time.Now().Add(-time.Second),
+	})
+
+	_, err = store.Poll("expired", "mdm")
+	assert.ErrorIs(err, device.ErrDeviceCodeInvalid)
+}
+
+func TestDeviceFlowOtherClient(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	a, _ := svc.Authorize(device.AuthorizeRequest{
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	})
+
+	err := svc.Approve(a.UserCode, "user01")
+	assert.NoError(err)
+
+	// Another client holding the device code gets nothing, and takes
+	// nothing from the device.
+	_, err = svc.Poll(oidc.TokenRequest{
+		GrantType:  client.DeviceCode,
+		DeviceCode: a.DeviceCode,
+		ClientID:   "wallet",
+	})
+	assert.ErrorIs(err, oidc.ErrInvalidGrant)
+
+	approved, err := svc.Poll(poll(a))
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("user01", approved.Subject)
+}
+
+func TestSlowDown(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewDeviceAuthorizationStore()
+	defer store.Close()
+
+	store.Save(&device.Authorization{
+		DeviceCode: "device",
+		UserCode:   "BCDFGHJK",
+		ClientID:   "mdm",
+		Interval:   5 * time.Second,
+		ExpiresAt:  time.Now().Add(time.Minute),
+	})
+
+	store.Poll("device", "mdm")
+
+	// Every poll too soon keeps the device waiting longer.
+	for _, interval := range []time.Duration{10 * time.Second, 15 * time.Second} {
+		store.Poll("device", "mdm")
+
+		a, err := store.FindByUserCode("BCDFGHJK")
+		if err != nil {
+			assert.Fail(err.Error())
+			return
+		}
+
+		assert.Equal(interval, a.Interval)
+	}
+}
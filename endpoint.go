@@ -11,15 +11,29 @@ import (
 )
 
 type EndpointSet struct {
-	Register            endpoint.Endpoint
-	SignIn              endpoint.Endpoint
-	OTPVerify           endpoint.Endpoint
-	AddSocialAccount    endpoint.Endpoint
-	RemoveSocialAccount endpoint.Endpoint
-	RegisterPasskey     endpoint.Endpoint
-	User                endpoint.Endpoint
-	UserBySocialID      endpoint.Endpoint
-	DeleteUser          endpoint.Endpoint
+	Register                 endpoint.Endpoint
+	SignIn                   endpoint.Endpoint
+	VerifySecondFactor       endpoint.Endpoint
+	CompleteLink             endpoint.Endpoint
+	EnrollTOTP               endpoint.Endpoint
+	ConfirmTOTP              endpoint.Endpoint
+	DisableTOTP              endpoint.Endpoint
+	SendOTP                  endpoint.Endpoint
+	OTPVerify                endpoint.Endpoint
+	AddSocialAccount         endpoint.Endpoint
+	RemoveSocialAccount      endpoint.Endpoint
+	RegisterPasskey          endpoint.Endpoint
+	UpdateUser               endpoint.Endpoint
+	VerifyEmail              endpoint.Endpoint
+	SendEmailVerification    endpoint.Endpoint
+	ConfirmEmailVerification endpoint.Endpoint
+	User                     endpoint.Endpoint
+	Users                    endpoint.Endpoint
+	SearchUsers              endpoint.Endpoint
+	UserBySocialAccount      endpoint.Endpoint
+	LockUser                 endpoint.Endpoint
+	UnlockUser               endpoint.Endpoint
+	DeleteUser               endpoint.Endpoint
 }
 
 type RegisterRequest struct {
@@ -39,6 +53,17 @@ func RegisterEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
+func SendOTPEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		username, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return nil, svc.SendOTP(username)
+	}
+}
+
 type OTPVerifyRequest struct {
 	OTP      string
 	Username string
@@ -58,18 +83,35 @@ func OTPVerifyEndpoint(svc Service) endpoint.Endpoint {
 type SignInRequest struct {
 	Credential string
 	Provider   user.SocialProvider
+	ClientID   string // optional; scopes the token to a registered public client
 }
 
+// SignInResponse carries either a user (and, once the transport signs it,
+// a token) or, for users with TOTP enabled, only a SecondFactor challenge,
+// or, for accounts to be linked first, only a LinkRequired challenge.
 type SignInResponse struct {
-	User  *user.User `json:"user"`
-	Token *Token     `json:"token"`
+	User         *user.User    `json:"user"`
+	Token        *Token        `json:"token"`
+	SecondFactor *SecondFactor `json:"second_factor,omitempty"`
+	LinkRequired *LinkRequired `json:"link_required,omitempty"`
 }
 
-type Token struct {
-	Token     string    `json:"token"`
+type SecondFactor struct {
+	Ticket    string    `json:"ticket"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+type LinkRequired struct {
+	Ticket    string    `json:"ticket"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
 
+type Token struct {
+	Token        string    `json:"token"`
+	ExpiredAt    time.Time `json:"expired_at"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+}
+
 func SignInEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request any) (response any, err error) {
 		req, ok := request.(SignInRequest)
@@ -78,6 +120,84 @@ func SignInEndpoint(svc Service) endpoint.Endpoint {
 		}
 
 		u, err := svc.SignIn(ctx, req.Credential, req.Provider)
+		if err != nil {
+			var mfaErr *SecondFactorRequiredError
+			if errors.As(err, &mfaErr) {
+				resp := SignInResponse{
+					SecondFactor: &SecondFactor{
+						Ticket:    mfaErr.Ticket,
+						ExpiredAt: mfaErr.ExpiredAt,
+					},
+				}
+
+				return resp, nil
+			}
+
+			var linkErr *LinkRequiredError
+			if errors.As(err, &linkErr) {
+				resp := SignInResponse{
+					LinkRequired: &LinkRequired{
+						Ticket:    linkErr.Ticket,
+						ExpiredAt: linkErr.ExpiredAt,
+					},
+				}
+
+				return resp, nil
+			}
+
+			return nil, err
+		}
+
+		resp := SignInResponse{
+			User: u,
+		}
+
+		return resp, nil
+	}
+}
+
+type VerifySecondFactorRequest struct {
+	Ticket   string
+	Code     string
+	ClientID string
+}
+
+func VerifySecondFactorEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(VerifySecondFactorRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		u, err := svc.VerifySecondFactor(req.Ticket, req.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := SignInResponse{
+			User: u,
+		}
+
+		return resp, nil
+	}
+}
+
+type CompleteLinkRequest struct {
+	Ticket     string
+	Credential string
+	Provider   user.SocialProvider
+	Code       string // TOTP or recovery code, for users with TOTP enabled
+	ClientID   string
+}
+
+func CompleteLinkEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(CompleteLinkRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		u, err := svc.CompleteLink(ctx, req.Ticket, req.Credential, req.Provider, req.Code)
 		if err != nil {
 			return nil, err
 		}
@@ -90,6 +210,57 @@ func SignInEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
+func EnrollTOTPEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		username, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.EnrollTOTP(username)
+	}
+}
+
+type TOTPRequest struct {
+	Code     string
+	Username string
+}
+
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func ConfirmTOTPEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(TOTPRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		codes, err := svc.ConfirmTOTP(req.Username, req.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := ConfirmTOTPResponse{
+			RecoveryCodes: codes,
+		}
+
+		return resp, nil
+	}
+}
+
+func DisableTOTPEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(TOTPRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return nil, svc.DisableTOTP(req.Username, req.Code)
+	}
+}
+
 type AddSocialAccountRequest struct {
 	Credential string
 	Provider   user.SocialProvider
@@ -103,7 +274,7 @@ func AddSocialAccountEndpoint(svc Service) endpoint.Endpoint {
 			return nil, errors.New("invalid request")
 		}
 
-		return svc.AddSocialAccount(req.Credential, req.Provider, req.Username)
+		return svc.AddSocialAccount(ctx, req.Credential, req.Provider, req.Username)
 	}
 }
 
@@ -146,14 +317,127 @@ func UserEndpoint(svc Service) endpoint.Endpoint {
 	}
 }
 
-func UserBySocialIDEndpoint(svc Service) endpoint.Endpoint {
+func UsersEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		q, ok := request.(*user.Query)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Users(q)
+	}
+}
+
+type SearchUsersRequest struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+func SearchUsersEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(SearchUsersRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.SearchUsers(req.Query, req.Limit)
+	}
+}
+
+type UserBySocialAccountRequest struct {
+	Provider user.SocialProvider
+	SocialID user.SocialID
+}
+
+type UpdateUserRequest struct {
+	Username string
+	Changes  UserChanges
+}
+
+func UpdateUserEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(UpdateUserRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.UpdateUser(req.Username, req.Changes)
+	}
+}
+
+type VerifyEmailRequest struct {
+	OTP      string
+	Username string
+}
+
+func VerifyEmailEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(VerifyEmailRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.VerifyEmail(req.Username, req.OTP)
+	}
+}
+
+func SendEmailVerificationEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		username, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return nil, svc.SendEmailVerification(username)
+	}
+}
+
+func ConfirmEmailVerificationEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		token, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.ConfirmEmailVerification(token)
+	}
+}
+
+func UserBySocialAccountEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(UserBySocialAccountRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.UserBySocialAccount(req.Provider, req.SocialID)
+	}
+}
+
+type LockUserRequest struct {
+	Username string
+	Reason   string
+}
+
+func LockUserEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (response any, err error) {
+		req, ok := request.(LockUserRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.LockUser(req.Username, req.Reason)
+	}
+}
+
+func UnlockUserEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request any) (response any, err error) {
-		socialID, ok := request.(user.SocialID)
+		username, ok := request.(string)
 		if !ok {
 			return nil, errors.New("invalid request")
 		}
 
-		return svc.UserBySocialID(socialID)
+		return svc.UnlockUser(username)
 	}
 }
 
@@ -186,6 +470,28 @@ func EventEndpoint(svc Service) endpoint.Endpoint {
 			err = handler.UserSocialAccountRemovedHandler(e)
 		case *user.UserDeletedEvent:
 			err = handler.UserDeletedHandler(e)
+		case *user.UserTOTPEnrolledEvent:
+			err = handler.UserTOTPEnrolledHandler(e)
+		case *user.UserTOTPConfirmedEvent:
+			err = handler.UserTOTPConfirmedHandler(e)
+		case *user.UserTOTPDisabledEvent:
+			err = handler.UserTOTPDisabledHandler(e)
+		case *user.UserRecoveryCodeUsedEvent:
+			err = handler.UserRecoveryCodeUsedHandler(e)
+		case *user.UserProfileUpdatedEvent:
+			err = handler.UserProfileUpdatedHandler(e)
+		case *user.UserRenamedEvent:
+			err = handler.UserRenamedHandler(e)
+		case *user.UserEmailChangeRequestedEvent:
+			err = handler.UserEmailChangeRequestedHandler(e)
+		case *user.UserEmailChangedEvent:
+			err = handler.UserEmailChangedHandler(e)
+		case *user.UserEmailVerifiedEvent:
+			err = handler.UserEmailVerifiedHandler(e)
+		case *user.UserLockedEvent:
+			err = handler.UserLockedHandler(e)
+		case *user.UserUnlockedEvent:
+			err = handler.UserUnlockedHandler(e)
 		default:
 			err = errors.New("invalid request")
 		}
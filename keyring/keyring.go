@@ -0,0 +1,191 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// Key is one ed25519 signing key. Once retired it only verifies tokens
+// signed before the rotation.
+type Key struct {
+	ID        string             `json:"kid"`
+	Privkey   ed25519.PrivateKey `json:"privkey"`
+	CreatedAt time.Time          `json:"created_at"`
+	RetiredAt time.Time          `json:"retired_at,omitzero"`
+}
+
+func NewKey(priv ed25519.PrivateKey) *Key {
+	return &Key{
+		ID:        KeyID(priv.Public().(ed25519.PublicKey)),
+		Privkey:   priv,
+		CreatedAt: time.Now(),
+	}
+}
+
+func GenerateKey() (*Key, error) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(priv), nil
+}
+
+func (k *Key) Public() ed25519.PublicKey {
+	return k.Privkey.Public().(ed25519.PublicKey)
+}
+
+func (k *Key) Retired() bool {
+	return !k.RetiredAt.IsZero()
+}
+
+// KeyID derives the kid from the public key, so the same key always gets
+// the same kid on every instance.
+func KeyID(pub ed25519.PublicKey) string {
+	hash := sha256.Sum256(pub)
+	return base64.RawURLEncoding.EncodeToString(hash[:16])
+}
+
+// KeyRing holds the active signing key first, followed by retired keys,
+// newest first.
+type KeyRing struct {
+	keys []*Key
+	sync.RWMutex
+}
+
+func New(active *Key, retired ...*Key) *KeyRing {
+	keys := append([]*Key{active}, retired...)
+	return &KeyRing{keys: keys}
+}
+
+// Load reads the key ring at path. A missing file yields a ring holding
+// only the fallback key, so deployments without rotation keep working.
+func Load(path string, fallback ed25519.PrivateKey) (*KeyRing, error) {
+	keys, err := readKeys(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return New(NewKey(fallback)), nil
+		}
+
+		return nil, err
+	}
+
+	return &KeyRing{keys: keys}, nil
+}
+
+// Reload swaps in the keys at path, for instances picking up a rotation.
+func (r *KeyRing) Reload(path string) error {
+	keys, err := readKeys(path)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	r.keys = keys
+	r.Unlock()
+	return nil
+}
+
+func readKeys(path string) ([]*Key, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(bs, &keys); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 || keys[0].Retired() {
+		return nil, errors.New("active key not found")
+	}
+
+	for _, k := range keys {
+		if len(k.Privkey) != ed25519.PrivateKeySize {
+			return nil, errors.New("invalid ed25519 private key length")
+		}
+
+		k.ID = KeyID(k.Public())
+	}
+
+	return keys, nil
+}
+
+func (r *KeyRing) Save(path string) error {
+	r.RLock()
+	bs, err := json.MarshalIndent(r.keys, "", "  ")
+	r.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, bs, 0600)
+}
+
+// Rotate retires the active key and makes a fresh one active.
+func (r *KeyRing) Rotate() (*Key, error) {
+	key, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.keys[0].RetiredAt = key.CreatedAt
+	r.keys = append([]*Key{key}, r.keys...)
+
+	return key, nil
+}
+
+// Prune drops keys retired before the given time and returns how many.
+func (r *KeyRing) Prune(before time.Time) int {
+	r.Lock()
+	defer r.Unlock()
+
+	n := len(r.keys)
+	r.keys = slices.DeleteFunc(r.keys, func(k *Key) bool {
+		return k.Retired() && k.RetiredAt.Before(before)
+	})
+
+	return n - len(r.keys)
+}
+
+// Active returns the key new tokens are signed with.
+func (r *KeyRing) Active() *Key {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.keys[0]
+}
+
+func (r *KeyRing) Lookup(kid string) (*Key, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, k := range r.keys {
+		if k.ID == kid {
+			return k, nil
+		}
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+func (r *KeyRing) Keys() []*Key {
+	r.RLock()
+	defer r.RUnlock()
+
+	return slices.Clone(r.keys)
+}
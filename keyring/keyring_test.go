@@ -0,0 +1,85 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys, err := Load(path, priv)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	active := keys.Active()
+	assert.Equal(KeyID(priv.Public().(ed25519.PublicKey)), active.ID)
+	assert.Len(keys.Keys(), 1)
+}
+
+func TestRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+	keys := New(NewKey(priv))
+
+	previous := keys.Active()
+
+	active, err := keys.Rotate()
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.NotEqual(previous.ID, active.ID)
+	assert.Equal(active, keys.Active())
+	assert.True(previous.Retired())
+
+	// Retired keys still verify.
+	k, err := keys.Lookup(previous.ID)
+	assert.NoError(err)
+	assert.Equal(previous.Public(), k.Public())
+
+	_, err = keys.Lookup("unknown")
+	assert.ErrorIs(err, ErrKeyNotFound)
+
+	assert.Equal(0, keys.Prune(previous.RetiredAt))
+	assert.Equal(1, keys.Prune(time.Now().Add(time.Second)))
+	assert.Len(keys.Keys(), 1)
+}
+
+func TestSaveAndReload(t *testing.T) {
+	assert := assert.New(t)
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+	keys := New(NewKey(priv))
+	keys.Rotate()
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := keys.Save(path); err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	loaded, err := Load(path, nil)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal(keys.Active().ID, loaded.Active().ID)
+	assert.Len(loaded.Keys(), 2)
+
+	other := New(NewKey(priv))
+	assert.NoError(other.Reload(path))
+	assert.Equal(keys.Active().ID, other.Active().ID)
+}
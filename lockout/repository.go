@@ -0,0 +1,31 @@
+package lockout
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrRecordNotFound = errors.New("lockout record not found")
+
+// Record counts the recent failed attempts of one key.
+type Record struct {
+	Failures    int // since the last lockout
+	Lockouts    int // in a row, for the backoff
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists records until their ttl runs out.
+type Store interface {
+	// Command
+
+	Save(key string, r *Record, ttl time.Duration) error
+	Delete(key string) error
+
+	// Query
+
+	Find(key string) (*Record, error)
+
+	// Close the store
+	Close() error
+}
@@ -0,0 +1,146 @@
+package lockout
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/conf"
+)
+
+var ErrLockedOut = errors.New("too many failed attempts")
+
+// LockedOutError tells when another attempt will be allowed.
+type LockedOutError struct {
+	Until time.Time
+}
+
+func (e *LockedOutError) Error() string {
+	return ErrLockedOut.Error()
+}
+
+func (e *LockedOutError) Unwrap() error {
+	return ErrLockedOut
+}
+
+// Service locks a key, a user or a client IP, out for a while once it
+// fails too often. Each lockout in a row lasts twice as long as the one
+// before.
+type Service interface {
+	Check(key string) error // a LockedOutError while locked out
+	Fail(key string) error
+	Reset(key string) error
+}
+
+const (
+	defaultThreshold   = 5
+	defaultWindow      = 15 * time.Minute
+	defaultDuration    = time.Minute
+	defaultMaxDuration = time.Hour
+)
+
+func NewService(store Store, cfg conf.LockoutPolicy) Service {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultThreshold
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+
+	if cfg.Duration <= 0 {
+		cfg.Duration = defaultDuration
+	}
+
+	if cfg.MaxDuration < cfg.Duration {
+		cfg.MaxDuration = max(defaultMaxDuration, cfg.Duration)
+	}
+
+	return &service{store: store, cfg: cfg}
+}
+
+type service struct {
+	store Store
+	cfg   conf.LockoutPolicy
+	mu    sync.Mutex // serializes read-modify-write of records
+}
+
+func (svc *service) Check(key string) error {
+	r, err := svc.store.Find(key)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	if time.Now().Before(r.LockedUntil) {
+		return &LockedOutError{Until: r.LockedUntil}
+	}
+
+	return nil
+}
+
+func (svc *service) Fail(key string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	now := time.Now()
+
+	r, err := svc.store.Find(key)
+	if err != nil {
+		if !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+
+		r = new(Record)
+	}
+
+	// Attempts made while locked out were never let through.
+	if now.Before(r.LockedUntil) {
+		return nil
+	}
+
+	// Quiet for a whole window: start over, backoff included.
+	if now.Sub(latest(r.LastFailure, r.LockedUntil)) > svc.cfg.Window {
+		r = new(Record)
+	}
+
+	r.Failures++
+	r.LastFailure = now
+
+	if r.Failures >= svc.cfg.Threshold {
+		r.Failures = 0
+		r.Lockouts++
+		r.LockedUntil = now.Add(svc.duration(r.Lockouts))
+	}
+
+	ttl := latest(r.LastFailure, r.LockedUntil).Sub(now) + svc.cfg.Window
+	return svc.store.Save(key, r, ttl)
+}
+
+// duration doubles the first lockout for each one after, up to the maximum.
+func (svc *service) duration(lockouts int) time.Duration {
+	d := svc.cfg.Duration
+	for i := 1; i < lockouts && d < svc.cfg.MaxDuration; i++ {
+		d *= 2
+	}
+
+	return min(d, svc.cfg.MaxDuration)
+}
+
+func (svc *service) Reset(key string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	return svc.store.Delete(key)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,90 @@
+package lockout_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/lockout"
+	"github.com/flarexio/identity/persistence/inmem"
+)
+
+func lockedUntil(err error) time.Time {
+	var lockedOut *lockout.LockedOutError
+	if !errors.As(err, &lockedOut) {
+		return time.Time{}
+	}
+
+	return lockedOut.Until
+}
+
+func TestLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewLockoutStore()
+	defer store.Close()
+
+	svc := lockout.NewService(store, conf.LockoutPolicy{
+		Threshold:   3,
+		Window:      time.Second,
+		Duration:    100 * time.Millisecond,
+		MaxDuration: 300 * time.Millisecond,
+	})
+
+	key := "user:01"
+
+	assert.NoError(svc.Fail(key))
+	assert.NoError(svc.Fail(key))
+	assert.NoError(svc.Check(key))
+
+	assert.NoError(svc.Fail(key))
+
+	err := svc.Check(key)
+	assert.ErrorIs(err, lockout.ErrLockedOut)
+	assert.WithinDuration(time.Now().Add(100*time.Millisecond), lockedUntil(err), 50*time.Millisecond)
+
+	// Other keys are not affected.
+	assert.NoError(svc.Check("user:02"))
+
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(svc.Check(key))
+
+	// The next lockout in a row lasts twice as long.
+	for range 3 {
+		assert.NoError(svc.Fail(key))
+	}
+
+	err = svc.Check(key)
+	assert.WithinDuration(time.Now().Add(200*time.Millisecond), lockedUntil(err), 50*time.Millisecond)
+
+	assert.NoError(svc.Reset(key))
+	assert.NoError(svc.Check(key))
+}
+
+func TestLockoutWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewLockoutStore()
+	defer store.Close()
+
+	svc := lockout.NewService(store, conf.LockoutPolicy{
+		Threshold: 2,
+		Window:    50 * time.Millisecond,
+	})
+
+	key := "ip:192.0.2.1"
+
+	assert.NoError(svc.Fail(key))
+
+	// Failures a window apart are forgotten.
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(svc.Fail(key))
+	assert.NoError(svc.Check(key))
+
+	assert.NoError(svc.Fail(key))
+	assert.ErrorIs(svc.Check(key), lockout.ErrLockedOut)
+}
@@ -2,10 +2,12 @@ package identity
 
 import (
 	"context"
+	"errors"
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"go.uber.org/zap"
 
+	"github.com/flarexio/identity/totp"
 	"github.com/flarexio/identity/user"
 )
 
@@ -42,6 +44,22 @@ func (mw *loggingMiddleware) Register(username string, name string, email string
 	return u, nil
 }
 
+func (mw *loggingMiddleware) SendOTP(username string) error {
+	log := mw.log.With(
+		zap.String("action", "send_otp"),
+		zap.String("username", username),
+	)
+
+	err := mw.next.SendOTP(username)
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	log.Info("otp sent")
+	return nil
+}
+
 func (mw *loggingMiddleware) OTPVerify(otp string, username string) (*user.User, error) {
 	log := mw.log.With(
 		zap.String("action", "otp_verify"),
@@ -65,6 +83,29 @@ func (mw *loggingMiddleware) SignIn(ctx context.Context, credential string, prov
 	)
 
 	u, err := mw.next.SignIn(ctx, credential, provider)
+	if err != nil {
+		if errors.Is(err, ErrSecondFactorRequired) || errors.Is(err, ErrLinkRequired) {
+			log.Info(err.Error())
+			return nil, err
+		}
+
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("user signed in",
+		zap.String("user_id", u.ID.String()),
+		zap.String("username", u.Username),
+	)
+	return u, nil
+}
+
+func (mw *loggingMiddleware) VerifySecondFactor(ticket string, code string) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "verify_second_factor"),
+	)
+
+	u, err := mw.next.VerifySecondFactor(ticket, code)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
@@ -77,14 +118,81 @@ func (mw *loggingMiddleware) SignIn(ctx context.Context, credential string, prov
 	return u, nil
 }
 
-func (mw *loggingMiddleware) AddSocialAccount(credential string, provider user.SocialProvider, username string) (*user.User, error) {
+func (mw *loggingMiddleware) CompleteLink(ctx context.Context, ticket string, credential string, provider user.SocialProvider, code string) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "complete_link"),
+		zap.String("provider", string(provider)),
+	)
+
+	u, err := mw.next.CompleteLink(ctx, ticket, credential, provider, code)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("social account linked",
+		zap.String("user_id", u.ID.String()),
+		zap.String("username", u.Username),
+	)
+	return u, nil
+}
+
+func (mw *loggingMiddleware) EnrollTOTP(username string) (*totp.Key, error) {
+	log := mw.log.With(
+		zap.String("action", "enroll_totp"),
+		zap.String("username", username),
+	)
+
+	key, err := mw.next.EnrollTOTP(username)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("totp enrolled")
+	return key, nil
+}
+
+func (mw *loggingMiddleware) ConfirmTOTP(username string, code string) ([]string, error) {
+	log := mw.log.With(
+		zap.String("action", "confirm_totp"),
+		zap.String("username", username),
+	)
+
+	codes, err := mw.next.ConfirmTOTP(username, code)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("totp confirmed")
+	return codes, nil
+}
+
+func (mw *loggingMiddleware) DisableTOTP(username string, code string) error {
+	log := mw.log.With(
+		zap.String("action", "disable_totp"),
+		zap.String("username", username),
+	)
+
+	err := mw.next.DisableTOTP(username, code)
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	log.Info("totp disabled")
+	return nil
+}
+
+func (mw *loggingMiddleware) AddSocialAccount(ctx context.Context, credential string, provider user.SocialProvider, username string) (*user.User, error) {
 	log := mw.log.With(
 		zap.String("action", "add_social_account"),
 		zap.String("provider", string(provider)),
 		zap.String("username", username),
 	)
 
-	u, err := mw.next.AddSocialAccount(credential, provider, username)
+	u, err := mw.next.AddSocialAccount(ctx, credential, provider, username)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
@@ -128,6 +236,71 @@ func (mw *loggingMiddleware) RegisterPasskey(username string) (*protocol.Credent
 	return opts, nil
 }
 
+func (mw *loggingMiddleware) UpdateUser(username string, changes UserChanges) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "update_user"),
+		zap.String("username", username),
+	)
+
+	u, err := mw.next.UpdateUser(username, changes)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("user updated", zap.String("new_username", u.Username))
+	return u, nil
+}
+
+func (mw *loggingMiddleware) VerifyEmail(username string, otp string) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "verify_email"),
+		zap.String("username", username),
+	)
+
+	u, err := mw.next.VerifyEmail(username, otp)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("email verified")
+	return u, nil
+}
+
+func (mw *loggingMiddleware) SendEmailVerification(username string) error {
+	log := mw.log.With(
+		zap.String("action", "send_email_verification"),
+		zap.String("username", username),
+	)
+
+	if err := mw.next.SendEmailVerification(username); err != nil {
+		log.Error(err.Error())
+		return err
+	}
+
+	log.Info("email verification sent")
+	return nil
+}
+
+func (mw *loggingMiddleware) ConfirmEmailVerification(token string) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "confirm_email_verification"),
+	)
+
+	u, err := mw.next.ConfirmEmailVerification(token)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("email verified",
+		zap.String("user_id", u.ID.String()),
+		zap.String("username", u.Username),
+	)
+	return u, nil
+}
+
 func (mw *loggingMiddleware) User(username string) (*user.User, error) {
 	log := mw.log.With(
 		zap.String("action", "user"),
@@ -144,13 +317,47 @@ func (mw *loggingMiddleware) User(username string) (*user.User, error) {
 	return u, nil
 }
 
-func (mw *loggingMiddleware) UserBySocialID(socialID user.SocialID) (*user.User, error) {
+func (mw *loggingMiddleware) Users(q *user.Query) (*user.Page, error) {
 	log := mw.log.With(
-		zap.String("action", "user_by_social_id"),
+		zap.String("action", "users"),
+		zap.String("cursor", q.Cursor),
+		zap.Int("limit", q.Limit),
+	)
+
+	page, err := mw.next.Users(q)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("users listed", zap.Int("count", len(page.Users)))
+	return page, nil
+}
+
+func (mw *loggingMiddleware) SearchUsers(query string, limit int) ([]*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "search_users"),
+		zap.Int("limit", limit),
+	)
+
+	users, err := mw.next.SearchUsers(query, limit)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("users searched", zap.Int("count", len(users)))
+	return users, nil
+}
+
+func (mw *loggingMiddleware) UserBySocialAccount(provider user.SocialProvider, socialID user.SocialID) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "user_by_social_account"),
+		zap.String("provider", string(provider)),
 		zap.String("social_id", string(socialID)),
 	)
 
-	u, err := mw.next.UserBySocialID(socialID)
+	u, err := mw.next.UserBySocialAccount(provider, socialID)
 	if err != nil {
 		log.Error(err.Error())
 		return nil, err
@@ -160,6 +367,38 @@ func (mw *loggingMiddleware) UserBySocialID(socialID user.SocialID) (*user.User,
 	return u, nil
 }
 
+func (mw *loggingMiddleware) LockUser(username string, reason string) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "lock_user"),
+		zap.String("username", username),
+	)
+
+	u, err := mw.next.LockUser(username, reason)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("user locked", zap.String("reason", reason))
+	return u, nil
+}
+
+func (mw *loggingMiddleware) UnlockUser(username string) (*user.User, error) {
+	log := mw.log.With(
+		zap.String("action", "unlock_user"),
+		zap.String("username", username),
+	)
+
+	u, err := mw.next.UnlockUser(username)
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	log.Info("user unlocked")
+	return u, nil
+}
+
 func (mw *loggingMiddleware) DeleteUser(username string) error {
 	log := mw.log.With(
 		zap.String("action", "delete_user"),
@@ -274,3 +513,212 @@ func (mw *loggingMiddleware) UserDeletedHandler(e *user.UserDeletedEvent) error
 	log.Info("user deleted")
 	return nil
 }
+
+func (mw *loggingMiddleware) UserTOTPEnrolledHandler(e *user.UserTOTPEnrolledEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserTOTPEnrolledHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("totp enrolled")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserTOTPConfirmedHandler(e *user.UserTOTPConfirmedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserTOTPConfirmedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("totp confirmed")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserTOTPDisabledHandler(e *user.UserTOTPDisabledEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserTOTPDisabledHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("totp disabled")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserRecoveryCodeUsedHandler(e *user.UserRecoveryCodeUsedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserRecoveryCodeUsedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("recovery code used")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserProfileUpdatedHandler(e *user.UserProfileUpdatedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserProfileUpdatedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("profile updated")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserRenamedHandler(e *user.UserRenamedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserRenamedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("user renamed")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserEmailChangeRequestedHandler(e *user.UserEmailChangeRequestedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserEmailChangeRequestedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("email change requested")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserEmailChangedHandler(e *user.UserEmailChangedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserEmailChangedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("email changed")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserEmailVerifiedHandler(e *user.UserEmailVerifiedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserEmailVerifiedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("email verified")
+	return nil
+}
+
+func (mw *loggingMiddleware) UserLockedHandler(e *user.UserLockedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserLockedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("user locked", zap.String("reason", e.Reason))
+	return nil
+}
+
+func (mw *loggingMiddleware) UserUnlockedHandler(e *user.UserUnlockedEvent) error {
+	log := mw.log.With(
+		zap.String("event", e.EventName()),
+		zap.String("user_id", e.UserID.String()),
+	)
+
+	handler, err := mw.next.Handler()
+	if err != nil {
+		return err
+	}
+
+	if err := handler.UserUnlockedHandler(e); err != nil {
+		log.Error(err.Error())
+	}
+
+	log.Info("user unlocked")
+	return nil
+}
@@ -0,0 +1,41 @@
+package mail
+
+import "sync"
+
+// InMemSender keeps what it is asked to send, for tests and development.
+type InMemSender struct {
+	messages []*Message
+	sync.Mutex
+}
+
+func NewInMemSender() *InMemSender {
+	return new(InMemSender)
+}
+
+func (s *InMemSender) Send(msg *Message) error {
+	if msg.To == "" {
+		return ErrRecipientRequired
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	m := *msg
+	s.messages = append(s.messages, &m)
+	return nil
+}
+
+// Messages returns what was sent to the recipient, oldest first.
+func (s *InMemSender) Messages(to string) []*Message {
+	s.Lock()
+	defer s.Unlock()
+
+	var messages []*Message
+	for _, m := range s.messages {
+		if m.To == to {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages
+}
@@ -0,0 +1,24 @@
+package mail
+
+import "errors"
+
+var ErrRecipientRequired = errors.New("recipient required")
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a message to its recipient.
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// SenderFunc adapts an ordinary function to a Sender.
+type SenderFunc func(msg *Message) error
+
+func (fn SenderFunc) Send(msg *Message) error {
+	return fn(msg)
+}
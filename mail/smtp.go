@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flarexio/identity/conf"
+)
+
+// NewSMTPSender sends through a relay. Credentials are only ever sent over
+// STARTTLS, which net/smtp insists on for anything but localhost.
+func NewSMTPSender(cfg conf.Mail) Sender {
+	port := cfg.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+
+	addr := net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if cfg.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+
+	// The envelope wants the bare address of a "Name <address>" sender.
+	envelope := cfg.From
+	if from, err := mail.ParseAddress(cfg.From); err == nil {
+		envelope = from.Address
+	}
+
+	return SenderFunc(func(msg *Message) error {
+		if msg.To == "" {
+			return ErrRecipientRequired
+		}
+
+		return smtp.SendMail(addr, auth, envelope, []string{msg.To}, compose(cfg.From, msg))
+	})
+}
+
+func compose(from string, msg *Message) []byte {
+	var buf bytes.Buffer
+
+	// Header values come from our own templates and addresses already
+	// validated as bare addresses, but a stray line break must never
+	// start a new header.
+	header := func(name, value string) {
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return buf.Bytes()
+}
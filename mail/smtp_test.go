@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompose(t *testing.T) {
+	assert := assert.New(t)
+
+	bs := compose("FlareX <no-reply@flarex.io>", &Message{
+		To:      "user01@example.com",
+		Subject: "Hello\r\nBcc: attacker@example.com",
+		Body:    "line 1\nline 2",
+	})
+
+	header, body, ok := strings.Cut(string(bs), "\r\n\r\n")
+	if !assert.True(ok) {
+		return
+	}
+
+	assert.Contains(header, "From: FlareX <no-reply@flarex.io>\r\n")
+	assert.Contains(header, "To: user01@example.com\r\n")
+	assert.NotContains(header, "\r\nBcc:")
+	assert.Equal("line 1\r\nline 2", body)
+}
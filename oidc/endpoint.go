@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+func ValidateEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(AuthorizeRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		err := svc.Validate(req)
+		return nil, err
+	}
+}
+
+type AuthorizeCodeRequest struct {
+	AuthorizeRequest
+	Subject  string
+	AuthTime time.Time
+}
+
+func AuthorizeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(AuthorizeCodeRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Authorize(req.AuthorizeRequest, req.Subject, req.AuthTime)
+	}
+}
+
+func ExchangeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(TokenRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Exchange(req)
+	}
+}
+
+func AuthenticateClientEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(TokenRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		err := svc.AuthenticateClient(req.ClientID, req.ClientSecret, req.GrantType)
+		return nil, err
+	}
+}
+
+func ClientCredentialsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(TokenRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.ClientCredentials(req)
+	}
+}
@@ -0,0 +1,58 @@
+package oidc
+
+import "errors"
+
+var ErrCodeInvalid = errors.New("authorization code invalid")
+
+var (
+	// Errors the authorization endpoint must not redirect with, since the
+	// redirect_uri itself cannot be trusted.
+	ErrClientNotFound   = errors.New("client not found")
+	ErrRedirectNotFound = errors.New("redirect uri not registered")
+)
+
+// Error is an OAuth 2.0 error response (RFC 6749, section 5.2).
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+// Is matches on the error code, so described errors still compare equal to
+// the sentinels below.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrInvalidRequest          = &Error{Code: "invalid_request"}
+	ErrInvalidClient           = &Error{Code: "invalid_client"}
+	ErrInvalidGrant            = &Error{Code: "invalid_grant"}
+	ErrInvalidScope            = &Error{Code: "invalid_scope"}
+	ErrUnauthorizedClient      = &Error{Code: "unauthorized_client"}
+	ErrUnsupportedGrantType    = &Error{Code: "unsupported_grant_type"}
+	ErrUnsupportedResponseType = &Error{Code: "unsupported_response_type"}
+)
+
+// Errors of the device authorization grant (RFC 8628, section 3.5).
+var (
+	ErrAuthorizationPending = &Error{Code: "authorization_pending"}
+	ErrSlowDown             = &Error{Code: "slow_down"}
+	ErrAccessDenied         = &Error{Code: "access_denied"}
+	ErrExpiredToken         = &Error{Code: "expired_token"}
+)
+
+func describe(err *Error, description string) error {
+	return &Error{
+		Code:        err.Code,
+		Description: description,
+	}
+}
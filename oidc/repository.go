@@ -0,0 +1,21 @@
+package oidc
+
+import "time"
+
+// AuthorizationCode is what a code stands for until the client redeems it.
+type AuthorizationCode struct {
+	ClientID    string
+	RedirectURI string
+	Subject     string // username
+	Scope       []string
+	Nonce       string
+	Challenge   string // S256 code_challenge, empty if the client sent none
+	AuthTime    time.Time
+}
+
+// Store keeps authorization codes; Consume must be one-time.
+type Store interface {
+	Save(code string, c *AuthorizationCode, ttl time.Duration) error
+	Consume(code string) (*AuthorizationCode, error)
+	Close() error
+}
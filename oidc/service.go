@@ -0,0 +1,239 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flarexio/identity/client"
+)
+
+const codeTTL = 5 * time.Minute
+
+// ScopesSupported are the scopes any client may ask of a user. The scopes a
+// client holds are its own, for client_credentials, and never delegated.
+var ScopesSupported = []string{"openid", "profile", "email"}
+
+// ValidateScope refuses scopes a client may not ask of a user: they would
+// end up in the user's access token, and in what introspection reports.
+func ValidateScope(scope []string) error {
+	for _, s := range scope {
+		if !slices.Contains(ScopesSupported, s) {
+			return describe(ErrInvalidScope, "unsupported scope "+s)
+		}
+	}
+
+	return nil
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	DeviceCode   string `form:"device_code"`
+}
+
+// ClientGrant is what a client_credentials request earns: a token for the
+// client itself, holding the granted scopes.
+type ClientGrant struct {
+	Client *client.Client
+	Scope  []string
+}
+
+// Service implements the authorization code flow with PKCE and the client
+// credentials grant. Signing the tokens is left to the transport, which owns
+// the key ring.
+type Service interface {
+	Validate(req AuthorizeRequest) error
+	Authorize(req AuthorizeRequest, subject string, authTime time.Time) (string, error)
+	Exchange(req TokenRequest) (*AuthorizationCode, error)
+	AuthenticateClient(id string, secret string, grantType string) error
+	ClientCredentials(req TokenRequest) (*ClientGrant, error)
+}
+
+func NewService(codes Store, clients client.Service) Service {
+	return &service{codes, clients}
+}
+
+type service struct {
+	codes   Store
+	clients client.Service
+}
+
+func (svc *service) Validate(req AuthorizeRequest) error {
+	c, err := svc.clients.Client(req.ClientID)
+	if err != nil {
+		if errors.Is(err, client.ErrClientNotFound) {
+			return ErrClientNotFound
+		}
+
+		return err
+	}
+
+	if !c.AllowsRedirect(req.RedirectURI) {
+		return ErrRedirectNotFound
+	}
+
+	if req.ResponseType != "code" {
+		return ErrUnsupportedResponseType
+	}
+
+	if !c.AllowsGrant(client.AuthorizationCode) {
+		return ErrUnauthorizedClient
+	}
+
+	scope := strings.Fields(req.Scope)
+	if !slices.Contains(scope, "openid") {
+		return describe(ErrInvalidScope, "openid scope required")
+	}
+
+	if err := ValidateScope(scope); err != nil {
+		return err
+	}
+
+	switch {
+	case req.CodeChallenge == "" && c.Public():
+		return describe(ErrInvalidRequest, "public clients must use PKCE")
+
+	case req.CodeChallenge != "" && req.CodeChallengeMethod != "S256":
+		return describe(ErrInvalidRequest, "code_challenge_method must be S256")
+	}
+
+	return nil
+}
+
+func (svc *service) Authorize(req AuthorizeRequest, subject string, authTime time.Time) (string, error) {
+	if err := svc.Validate(req); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := base64.RawURLEncoding.EncodeToString(buf)
+
+	c := &AuthorizationCode{
+		ClientID:    req.ClientID,
+		RedirectURI: req.RedirectURI,
+		Subject:     subject,
+		Scope:       strings.Fields(req.Scope),
+		Nonce:       req.Nonce,
+		Challenge:   req.CodeChallenge,
+		AuthTime:    authTime,
+	}
+
+	if err := svc.codes.Save(code, c, codeTTL); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+func (svc *service) Exchange(req TokenRequest) (*AuthorizationCode, error) {
+	if req.GrantType != client.AuthorizationCode {
+		return nil, ErrUnsupportedGrantType
+	}
+
+	if err := svc.AuthenticateClient(req.ClientID, req.ClientSecret, req.GrantType); err != nil {
+		return nil, err
+	}
+
+	c, err := svc.codes.Consume(req.Code)
+	if err != nil {
+		return nil, describe(ErrInvalidGrant, err.Error())
+	}
+
+	if c.ClientID != req.ClientID || c.RedirectURI != req.RedirectURI {
+		return nil, describe(ErrInvalidGrant, "code was issued to another client")
+	}
+
+	if c.Challenge != "" || req.CodeVerifier != "" {
+		sum := sha256.Sum256([]byte(req.CodeVerifier))
+		challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+		if subtle.ConstantTimeCompare([]byte(challenge), []byte(c.Challenge)) != 1 {
+			return nil, describe(ErrInvalidGrant, "code_verifier mismatch")
+		}
+	}
+
+	return c, nil
+}
+
+func (svc *service) AuthenticateClient(id string, secret string, grantType string) error {
+	_, err := svc.authenticate(id, secret, grantType)
+	return err
+}
+
+func (svc *service) ClientCredentials(req TokenRequest) (*ClientGrant, error) {
+	if req.GrantType != client.ClientCredentials {
+		return nil, ErrUnsupportedGrantType
+	}
+
+	c, err := svc.authenticate(req.ClientID, req.ClientSecret, req.GrantType)
+	if err != nil {
+		return nil, err
+	}
+
+	// A public client has nothing to prove who it is with.
+	if c.Public() {
+		return nil, ErrUnauthorizedClient
+	}
+
+	scope, err := c.GrantScopes(strings.Fields(req.Scope))
+	if err != nil {
+		return nil, describe(ErrInvalidScope, err.Error())
+	}
+
+	return &ClientGrant{c, scope}, nil
+}
+
+// Authenticate checks a client's credentials for the token endpoint and
+// the endpoints beside it. An unknown client is as invalid as a wrong
+// secret (RFC 6749, section 5.2).
+func Authenticate(clients client.Service, id string, secret string) (*client.Client, error) {
+	c, err := clients.Authenticate(id, secret)
+	if err != nil {
+		if errors.Is(err, client.ErrSecretInvalid) || errors.Is(err, client.ErrClientNotFound) {
+			return nil, ErrInvalidClient
+		}
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (svc *service) authenticate(id string, secret string, grantType string) (*client.Client, error) {
+	c, err := Authenticate(svc.clients, id, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.AllowsGrant(grantType) {
+		return nil, ErrUnauthorizedClient
+	}
+
+	return c, nil
+}
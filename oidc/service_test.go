@@ -0,0 +1,233 @@
+package oidc_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/persistence/inmem"
+)
+
+var clients = []conf.OIDCClient{
+	{
+		ID:           "wallet",
+		Audience:     "wallet.flarex.io",
+		RedirectURIs: []string{"https://wallet.flarex.io/callback"},
+	},
+	{
+		ID:           "mdm",
+		Secret:       "secret",
+		Audience:     "mdm.flarex.io",
+		RedirectURIs: []string{"https://mdm.flarex.io/callback"},
+	},
+	{
+		ID:         "directory",
+		Secret:     "secret",
+		GrantTypes: []string{"client_credentials"},
+		Audience:   "identity.flarex.io",
+		Scopes:     []string{"users.read", "users.write"},
+	},
+}
+
+func newService(t *testing.T) oidc.Service {
+	codes, _ := inmem.NewAuthorizationCodeStore()
+	t.Cleanup(func() { codes.Close() })
+
+	repo, _ := inmem.NewClientRepository()
+	clientSvc := client.NewService(repo)
+	if err := clientSvc.Seed(clients); err != nil {
+		t.Fatal(err)
+	}
+
+	return oidc.NewService(codes, clientSvc)
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	req := oidc.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "wallet",
+		RedirectURI:         "https://wallet.flarex.io/callback",
+		Scope:               "openid profile",
+		CodeChallenge:       challenge("verifier"),
+		CodeChallengeMethod: "S256",
+	}
+
+	assert.NoError(svc.Validate(req))
+
+	invalid := req
+	invalid.ClientID = "unknown"
+	assert.ErrorIs(svc.Validate(invalid), oidc.ErrClientNotFound)
+
+	invalid = req
+	invalid.RedirectURI = "https://evil.example.com/callback"
+	assert.ErrorIs(svc.Validate(invalid), oidc.ErrRedirectNotFound)
+
+	invalid = req
+	invalid.Scope = "profile"
+	assert.ErrorIs(svc.Validate(invalid), oidc.ErrInvalidScope)
+
+	invalid = req
+	invalid.Scope = "openid admin"
+	assert.ErrorIs(svc.Validate(invalid), oidc.ErrInvalidScope)
+
+	// Public clients must use PKCE, and only S256.
+	invalid = req
+	invalid.CodeChallenge = ""
+	assert.ErrorIs(svc.Validate(invalid), oidc.ErrInvalidRequest)
+
+	invalid = req
+	invalid.CodeChallengeMethod = "plain"
+	assert.ErrorIs(svc.Validate(invalid), oidc.ErrInvalidRequest)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	authTime := time.Now()
+	code, err := svc.Authorize(oidc.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "wallet",
+		RedirectURI:         "https://wallet.flarex.io/callback",
+		Scope:               "openid email",
+		Nonce:               "nonce",
+		CodeChallenge:       challenge("verifier"),
+		CodeChallengeMethod: "S256",
+	}, "user01", authTime)
+
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	req := oidc.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  "https://wallet.flarex.io/callback",
+		ClientID:     "wallet",
+		CodeVerifier: "verifier",
+	}
+
+	c, err := svc.Exchange(req)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("user01", c.Subject)
+	assert.Equal("nonce", c.Nonce)
+	assert.Equal([]string{"openid", "email"}, c.Scope)
+
+	// Codes are one-time.
+	_, err = svc.Exchange(req)
+	assert.ErrorIs(err, oidc.ErrInvalidGrant)
+}
+
+func TestExchangeInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	authorize := oidc.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            "wallet",
+		RedirectURI:         "https://wallet.flarex.io/callback",
+		Scope:               "openid",
+		CodeChallenge:       challenge("verifier"),
+		CodeChallengeMethod: "S256",
+	}
+
+	code, _ := svc.Authorize(authorize, "user01", time.Now())
+
+	_, err := svc.Exchange(oidc.TokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  "https://wallet.flarex.io/callback",
+		ClientID:     "wallet",
+		CodeVerifier: "wrong",
+	})
+	assert.ErrorIs(err, oidc.ErrInvalidGrant)
+
+	code, _ = svc.Authorize(authorize, "user01", time.Now())
+
+	_, err = svc.Exchange(oidc.TokenRequest{
+		GrantType:   "authorization_code",
+		Code:        code,
+		RedirectURI: "https://mdm.flarex.io/callback",
+		ClientID:    "mdm",
+	})
+	assert.ErrorIs(err, oidc.ErrInvalidClient)
+
+	_, err = svc.Exchange(oidc.TokenRequest{
+		GrantType: "password",
+	})
+	assert.ErrorIs(err, oidc.ErrUnsupportedGrantType)
+
+	assert.NoError(svc.AuthenticateClient("mdm", "secret", "refresh_token"))
+	assert.ErrorIs(svc.AuthenticateClient("mdm", "wrong", "refresh_token"), oidc.ErrInvalidClient)
+	assert.ErrorIs(svc.AuthenticateClient("unknown", "secret", "refresh_token"), oidc.ErrInvalidClient)
+	assert.ErrorIs(svc.AuthenticateClient("mdm", "secret", "password"), oidc.ErrUnauthorizedClient)
+}
+
+func TestClientCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := newService(t)
+
+	req := oidc.TokenRequest{
+		GrantType:    "client_credentials",
+		ClientID:     "directory",
+		ClientSecret: "secret",
+	}
+
+	grant, err := svc.ClientCredentials(req)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("directory", grant.Client.ID)
+	assert.Equal([]string{"users.read", "users.write"}, grant.Scope)
+
+	req.Scope = "users.read"
+	grant, err = svc.ClientCredentials(req)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal([]string{"users.read"}, grant.Scope)
+
+	req.Scope = "users.delete"
+	_, err = svc.ClientCredentials(req)
+	assert.ErrorIs(err, oidc.ErrInvalidScope)
+
+	req.Scope = ""
+	req.ClientSecret = "wrong"
+	_, err = svc.ClientCredentials(req)
+	assert.ErrorIs(err, oidc.ErrInvalidClient)
+
+	// Clients not registered for the grant cannot use it.
+	_, err = svc.ClientCredentials(oidc.TokenRequest{
+		GrantType:    "client_credentials",
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	})
+	assert.ErrorIs(err, oidc.ErrUnauthorizedClient)
+}
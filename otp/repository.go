@@ -0,0 +1,28 @@
+package otp
+
+import "time"
+
+// Code is a hashed one-time password waiting to be verified. Attempts and
+// Issued count for the subject since WindowEnds-ttl, across every code
+// issued in that window.
+type Code struct {
+	Hash       []byte
+	Salt       []byte
+	Attempts   int
+	Issued     int
+	WindowEnds time.Time
+	ExpiresAt  time.Time
+}
+
+// Store persists pending codes; Attempt must be atomic.
+type Store interface {
+	// Command
+
+	Save(subject string, code *Code) error
+	Find(subject string) (*Code, error)
+	Attempt(subject string) (*Code, error) // increments Attempts and returns the updated code
+	Delete(subject string) error
+
+	// Close the store
+	Close() error
+}
@@ -0,0 +1,13 @@
+package otp
+
+// Sender delivers a freshly issued code to its recipient.
+type Sender interface {
+	Send(to string, code string) error
+}
+
+// SenderFunc adapts an ordinary function to a Sender.
+type SenderFunc func(to string, code string) error
+
+func (fn SenderFunc) Send(to string, code string) error {
+	return fn(to, code)
+}
@@ -0,0 +1,138 @@
+package otp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	// ErrCodeInvalid collapses unknown/expired/mismatched into one error.
+	ErrCodeInvalid     = errors.New("otp invalid")
+	ErrTooManyAttempts = errors.New("too many otp attempts")
+	ErrTooManyCodes    = errors.New("too many otps issued")
+)
+
+// Service issues and verifies time-limited one-time passwords. Neither
+// sending a new code nor the attempts against it start over within one ttl
+// of the first code, so re-issuing cannot buy a guesser more tries.
+type Service interface {
+	Issue(subject string, to string) error
+	Verify(subject string, code string) error
+	Reset(subject string) error // drops the pending code and its counts
+}
+
+const (
+	defaultTTL  = 10 * time.Minute
+	maxAttempts = 5
+	maxIssued   = 3
+	digits      = 6
+)
+
+func NewService(store Store, sender Sender, ttl time.Duration) Service {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &service{store: store, sender: sender, ttl: ttl}
+}
+
+type service struct {
+	store  Store
+	sender Sender
+	ttl    time.Duration
+}
+
+func (svc *service) Issue(subject string, to string) error {
+	max := big.NewInt(1)
+	for range digits {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%0*d", digits, n)
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c := &Code{
+		Hash:       hash(salt, code),
+		Salt:       salt,
+		Issued:     1,
+		WindowEnds: now.Add(svc.ttl),
+		ExpiresAt:  now.Add(svc.ttl),
+	}
+
+	prev, err := svc.store.Find(subject)
+	switch {
+	case err == nil:
+		if now.Before(prev.WindowEnds) {
+			if prev.Issued >= maxIssued {
+				return ErrTooManyCodes
+			}
+
+			c.Attempts = prev.Attempts
+			c.Issued = prev.Issued + 1
+			c.WindowEnds = prev.WindowEnds
+		}
+
+	case !errors.Is(err, ErrCodeInvalid):
+		return err
+	}
+
+	// A new code always replaces the previous one for the same subject. It
+	// stays even when it cannot be sent: nobody knows it, and it still
+	// counts against the subject.
+	if err := svc.store.Save(subject, c); err != nil {
+		return err
+	}
+
+	return svc.sender.Send(to, code)
+}
+
+func (svc *service) Verify(subject string, code string) error {
+	if code == "" {
+		return ErrCodeInvalid
+	}
+
+	c, err := svc.store.Attempt(subject)
+	if err != nil {
+		return err
+	}
+
+	if time.Now().After(c.ExpiresAt) {
+		svc.store.Delete(subject)
+		return ErrCodeInvalid
+	}
+
+	// The code stays until it expires, so a new one cannot reset the count.
+	if c.Attempts > maxAttempts {
+		return ErrTooManyAttempts
+	}
+
+	if subtle.ConstantTimeCompare(c.Hash, hash(c.Salt, code)) != 1 {
+		return ErrCodeInvalid
+	}
+
+	return svc.store.Delete(subject)
+}
+
+func (svc *service) Reset(subject string) error {
+	return svc.store.Delete(subject)
+}
+
+func hash(salt []byte, code string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(code))
+	return h.Sum(nil)
+}
@@ -0,0 +1,73 @@
+package otp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/otp"
+	"github.com/flarexio/identity/persistence/inmem"
+)
+
+func newService(t *testing.T) (otp.Service, <-chan string) {
+	store, _ := inmem.NewOTPStore()
+	t.Cleanup(func() { store.Close() })
+
+	codes := make(chan string, 8)
+	sender := otp.SenderFunc(func(to string, code string) error {
+		codes <- code
+		return nil
+	})
+
+	return otp.NewService(store, sender, time.Hour), codes
+}
+
+func TestVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	svc, codes := newService(t)
+
+	err := svc.Issue("user01", "user01@example.com")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	code := <-codes
+
+	assert.ErrorIs(svc.Verify("user01", "x"), otp.ErrCodeInvalid)
+	assert.NoError(svc.Verify("user01", code))
+
+	// A code is good once.
+	assert.ErrorIs(svc.Verify("user01", code), otp.ErrCodeInvalid)
+}
+
+func TestReissue(t *testing.T) {
+	assert := assert.New(t)
+
+	svc, codes := newService(t)
+
+	svc.Issue("user01", "user01@example.com")
+	<-codes
+
+	for range 5 {
+		assert.ErrorIs(svc.Verify("user01", "x"), otp.ErrCodeInvalid)
+	}
+
+	// A new code carries the attempts against the previous one.
+	assert.NoError(svc.Issue("user01", "user01@example.com"))
+	assert.ErrorIs(svc.Verify("user01", <-codes), otp.ErrTooManyAttempts)
+
+	assert.NoError(svc.Issue("user01", "user01@example.com"))
+	<-codes
+
+	// Only so many codes are sent per subject within a ttl.
+	assert.ErrorIs(svc.Issue("user01", "user01@example.com"), otp.ErrTooManyCodes)
+	assert.NoError(svc.Issue("user02", "user02@example.com"))
+	<-codes
+
+	assert.NoError(svc.Reset("user01"))
+	assert.NoError(svc.Issue("user01", "user01@example.com"))
+	assert.NoError(svc.Verify("user01", <-codes))
+}
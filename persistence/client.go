@@ -0,0 +1,24 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/db"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/persistence/kv"
+)
+
+func NewClientRepository(cfg conf.Persistence) (client.Repository, error) {
+	switch cfg.Driver {
+	case conf.SQLite, conf.Postgres, conf.MySQL:
+		return db.NewClientRepository(cfg)
+	case conf.BadgerDB:
+		return kv.NewClientRepository(cfg)
+	case conf.InMem:
+		return inmem.NewClientRepository()
+	default:
+		return nil, errors.New("driver not supported")
+	}
+}
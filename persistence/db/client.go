@@ -0,0 +1,108 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+)
+
+type Client struct {
+	ID           string `gorm:"primaryKey"`
+	Name         string
+	SecretHash   string
+	RedirectURIs string // space-separated
+	GrantTypes   string // space-separated
+	Audience     string
+	Scopes       string // space-separated
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func NewClient(c *client.Client) *Client {
+	return &Client{
+		ID:           c.ID,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectURIs: strings.Join(c.RedirectURIs, " "),
+		GrantTypes:   strings.Join(c.GrantTypes, " "),
+		Audience:     c.Audience,
+		Scopes:       strings.Join(c.Scopes, " "),
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+	}
+}
+
+func (c *Client) reconstitute() *client.Client {
+	return &client.Client{
+		ID:           c.ID,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		GrantTypes:   strings.Fields(c.GrantTypes),
+		Audience:     c.Audience,
+		Scopes:       strings.Fields(c.Scopes),
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+	}
+}
+
+func NewClientRepository(cfg conf.Persistence) (client.Repository, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &clientRepository{db}, nil
+}
+
+type clientRepository struct {
+	db *gorm.DB
+}
+
+func (repo *clientRepository) Store(c *client.Client) error {
+	return repo.db.Save(NewClient(c)).Error
+}
+
+func (repo *clientRepository) Delete(id string) error {
+	return repo.db.Delete(&Client{}, "id = ?", id).Error
+}
+
+func (repo *clientRepository) Find(id string) (*client.Client, error) {
+	var c *Client
+	if err := repo.db.Take(&c, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, client.ErrClientNotFound
+		}
+
+		return nil, err
+	}
+
+	return c.reconstitute(), nil
+}
+
+func (repo *clientRepository) List() ([]*client.Client, error) {
+	var clients []*Client
+	if err := repo.db.Order("id").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]*client.Client, 0)
+	for _, c := range clients {
+		results = append(results, c.reconstitute())
+	}
+
+	return results, nil
+}
+
+func (repo *clientRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+)
+
+type clientRepositoryTestSuite struct {
+	suite.Suite
+	clients client.Repository
+}
+
+func (suite *clientRepositoryTestSuite) SetupSuite() {
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Name:   "identity",
+		InMem:  true,
+	}
+
+	clients, err := NewClientRepository(cfg)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.clients = clients
+}
+
+func (suite *clientRepositoryTestSuite) TestStore() {
+	now := time.Now()
+	c := &client.Client{
+		ID:           "mdm",
+		Name:         "MDM",
+		SecretHash:   client.HashSecret("secret"),
+		RedirectURIs: []string{"https://mdm.flarex.io/callback"},
+		GrantTypes:   []string{client.AuthorizationCode, client.RefreshToken},
+		Audience:     "mdm.flarex.io",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	err := suite.clients.Store(c)
+	suite.NoError(err)
+
+	// 讀回的 client 應與儲存的一致
+	found, err := suite.clients.Find("mdm")
+	suite.NoError(err)
+	suite.Equal("MDM", found.Name)
+	suite.Equal(c.RedirectURIs, found.RedirectURIs)
+	suite.Equal(c.GrantTypes, found.GrantTypes)
+	suite.True(found.VerifySecret("secret"))
+
+	clients, err := suite.clients.List()
+	suite.NoError(err)
+	suite.Len(clients, 1)
+
+	err = suite.clients.Delete("mdm")
+	suite.NoError(err)
+
+	// 刪除後查無此 client
+	_, err = suite.clients.Find("mdm")
+	suite.ErrorIs(err, client.ErrClientNotFound)
+}
+
+func (suite *clientRepositoryTestSuite) TearDownSuite() {
+	suite.clients.Close()
+}
+
+func TestClientRepositoryTestSuite(t *testing.T) {
+	suite.Run(t, new(clientRepositoryTestSuite))
+}
@@ -1,11 +1,244 @@
 package db
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"time"
 
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/conf"
 )
 
+var ErrTLSModeInvalid = errors.New("invalid tls mode")
+
+func open(cfg conf.Persistence) (*gorm.DB, error) {
+	dialector, err := dialect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Pool.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(cfg.Pool.MaxOpenConns)
+	}
+
+	if cfg.Pool.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(cfg.Pool.MaxIdleConns)
+	}
+
+	if cfg.Pool.ConnMaxLifetime > 0 {
+		pool.SetConnMaxLifetime(cfg.Pool.ConnMaxLifetime)
+	}
+
+	if cfg.Pool.ConnMaxIdleTime > 0 {
+		pool.SetConnMaxIdleTime(cfg.Pool.ConnMaxIdleTime)
+	}
+
+	return db, nil
+}
+
+func dialect(cfg conf.Persistence) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case conf.SQLite:
+		filename := cfg.Host + "/" + cfg.Name + ".db"
+		if cfg.InMem {
+			filename = "file::memory:?cache=shared"
+		}
+
+		return sqlite.Open(filename), nil
+
+	case conf.Postgres:
+		dsn, err := postgresDSN(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return postgres.Open(dsn), nil
+
+	case conf.MySQL:
+		connector, err := mysqlConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return mysql.New(mysql.Config{
+			Conn: sql.OpenDB(connector),
+		}), nil
+
+	default:
+		return nil, errors.New("driver not supported")
+	}
+}
+
+func address(cfg conf.Persistence, defaultPort int) string {
+	port := cfg.Port
+	if port == 0 {
+		port = defaultPort
+	}
+
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+}
+
+// postgresDSN leaves TLS to pgx, which speaks sslmode natively.
+func postgresDSN(cfg conf.Persistence) (string, error) {
+	query := url.Values{}
+
+	switch cfg.TLS.Mode {
+	case "", "disable", "require", "verify-ca", "verify-full":
+		if cfg.TLS.Mode != "" {
+			query.Set("sslmode", cfg.TLS.Mode)
+		}
+	default:
+		return "", ErrTLSModeInvalid
+	}
+
+	if cfg.TLS.CAFile != "" {
+		query.Set("sslrootcert", cfg.TLS.CAFile)
+	}
+
+	if cfg.TLS.CertFile != "" {
+		query.Set("sslcert", cfg.TLS.CertFile)
+		query.Set("sslkey", cfg.TLS.KeyFile)
+	}
+
+	dsn := &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.Username, cfg.Password),
+		Host:     address(cfg, 5432),
+		Path:     "/" + cfg.Name,
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String(), nil
+}
+
+func mysqlConnector(cfg conf.Persistence) (driver.Connector, error) {
+	dsn := mysqlDriver.NewConfig()
+	dsn.User = cfg.Username
+	dsn.Passwd = cfg.Password
+	dsn.Net = "tcp"
+	dsn.Addr = address(cfg, 3306)
+	dsn.DBName = cfg.Name
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+	dsn.Params = map[string]string{"charset": "utf8mb4"}
+
+	tlsConfig, err := mysqlTLS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn.TLS = tlsConfig
+
+	return mysqlDriver.NewConnector(dsn)
+}
+
+// mysqlTLS maps the sslmode vocabulary onto a tls.Config.
+func mysqlTLS(cfg conf.Persistence) (*tls.Config, error) {
+	var tlsConfig *tls.Config
+
+	switch cfg.TLS.Mode {
+	case "", "disable":
+		return nil, nil
+
+	case "require":
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+	case "verify-ca", "verify-full":
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+
+		if cfg.TLS.CAFile != "" {
+			pem, err := os.ReadFile(cfg.TLS.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificate found in " + cfg.TLS.CAFile)
+			}
+		}
+
+		tlsConfig = &tls.Config{
+			RootCAs:    roots,
+			ServerName: cfg.Host,
+		}
+
+		// verify-ca trusts the chain whatever name the server goes by.
+		if cfg.TLS.Mode == "verify-ca" {
+			tlsConfig.InsecureSkipVerify = true
+			tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) == 0 {
+					return errors.New("no server certificate")
+				}
+
+				intermediates := x509.NewCertPool()
+				for _, cert := range cs.PeerCertificates[1:] {
+					intermediates.AddCert(cert)
+				}
+
+				_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+					Roots:         roots,
+					Intermediates: intermediates,
+				})
+
+				return err
+			}
+		}
+
+	default:
+		return nil, ErrTLSModeInvalid
+	}
+
+	if cfg.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// purgeExpired deletes the rows of each model past their expires_at. The
+// stores of rows that expire call it on every write, which keeps their
+// tables small without a janitor to run.
+func purgeExpired(tx *gorm.DB, models ...any) error {
+	now := time.Now()
+	for _, model := range models {
+		if err := tx.Where("expires_at < ?", now).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type DataModel struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/conf"
+)
+
+var ErrNoMigrationApplied = errors.New("no migration applied")
+
+// Migration moves the schema from the previous version to Version. Once
+// released a migration is never edited, so it describes the tables as they
+// were then instead of using the models in this package.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back the migrations of a database, one
+// transaction per migration. MySQL commits schema changes as it goes, so
+// there a failed migration may leave part of itself behind.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(cfg conf.Persistence) (*Migrator, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db, migrations), nil
+}
+
+func newMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{db, sorted}
+}
+
+// migrate brings the schema up to date, as every store does when opened.
+func migrate(db *gorm.DB) error {
+	_, err := newMigrator(db, migrations).Up()
+	return err
+}
+
+func (m *Migrator) applied() (map[int]*SchemaMigration, error) {
+	if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var records []*SchemaMigration
+	if err := m.db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]*SchemaMigration)
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		}); err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations, latest first.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+
+			return tx.Delete(&SchemaMigration{}, "version = ?", migration.Version).Error
+		}); err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	if len(done) == 0 && steps > 0 {
+		return nil, ErrNoMigrationApplied
+	}
+
+	return done, nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status := &MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+
+		if r, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = r.AppliedAt
+		}
+
+		statuses[i] = status
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) Close() error {
+	db, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/conf"
+)
+
+func TestMigrator(t *testing.T) {
+	assert := assert.New(t)
+
+	// 使用獨立的資料庫檔案，避免影響其他測試
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Host:   t.TempDir(),
+		Name:   "identity",
+	}
+
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+	defer m.Close()
+
+	statuses, err := m.Status()
+	assert.NoError(err)
+	assert.Len(statuses, len(migrations))
+	for _, s := range statuses {
+		assert.False(s.Applied)
+	}
+
+	applied, err := m.Up()
+	assert.NoError(err)
+	assert.Len(applied, len(migrations))
+	assert.True(m.db.Migrator().HasColumn(&User{}, "Avatar"))
+	assert.True(m.db.Migrator().HasIndex(&User{}, "idx_users_username"))
+
+	// 已套用的遷移不會重複執行
+	applied, err = m.Up()
+	assert.NoError(err)
+	assert.Empty(applied)
+
+	// 回復最後一個遷移
+	reverted, err := m.Down(1)
+	assert.NoError(err)
+	assert.Len(reverted, 1)
+	assert.Equal(len(migrations), reverted[0].Version)
+
+	// 只保留初始結構
+	_, err = m.Down(len(migrations) - 2)
+	assert.NoError(err)
+	assert.False(m.db.Migrator().HasColumn(&User{}, "Avatar"))
+
+	statuses, err = m.Status()
+	assert.NoError(err)
+	assert.True(statuses[0].Applied)
+	assert.False(statuses[1].Applied)
+
+	// 全部回復後資料表應被移除
+	_, err = m.Down(len(migrations))
+	assert.NoError(err)
+	assert.False(m.db.Migrator().HasTable(&User{}))
+
+	_, err = m.Down(1)
+	assert.ErrorIs(err, ErrNoMigrationApplied)
+}
+
+func TestMigratorAdoptsUnversionedSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Host:   t.TempDir(),
+		Name:   "identity",
+	}
+
+	// 模擬遷移版本化之前所建立的資料庫
+	db, err := open(cfg)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	err = db.AutoMigrate(&userV1{}, &socialAccountV1{})
+	assert.NoError(err)
+
+	err = db.Create(&userV1{ID: "01JAAAAAAAAAAAAAAAAAAAAAAA", Username: "user01"}).Error
+	assert.NoError(err)
+
+	m := newMigrator(db, migrations)
+	defer m.Close()
+
+	applied, err := m.Up()
+	assert.NoError(err)
+	assert.Len(applied, len(migrations))
+
+	// 既有資料應保留
+	var count int64
+	db.Model(&User{}).Where("username = ?", "user01").Count(&count)
+	assert.Equal(int64(1), count)
+}
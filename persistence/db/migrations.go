@@ -0,0 +1,400 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/user"
+)
+
+// migrations lists every schema change in order. Append only.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up:      initialSchemaUp,
+		Down:    initialSchemaDown,
+	},
+	{
+		Version: 2,
+		Name:    "add user avatar",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&userV2{}, "Avatar")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&userV2{}, "Avatar")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "index users for queries",
+		Up:      userIndexesUp,
+		Down:    userIndexesDown,
+	},
+	{
+		Version: 4,
+		Name:    "add user version",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&userVersionV4{}, "Version")
+		},
+		Down: func(tx *gorm.DB) error {
+			// gorm drops a SQLite column by rebuilding the table, which
+			// loses the indexes of version 3.
+			return tx.Exec("ALTER TABLE users DROP COLUMN version").Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add refresh token scope",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&refreshTokenScopeV5{}, "Scope")
+		},
+		Down: func(tx *gorm.DB) error {
+			// Same as version 4: keep SQLite from rebuilding the table.
+			return tx.Exec("ALTER TABLE refresh_tokens DROP COLUMN scope").Error
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add token revocations",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&revokedTokenV6{}, &subjectRevocationV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&revokedTokenV6{}, &subjectRevocationV6{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add user search terms",
+		Up:      userSearchTermsUp,
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("user_search_terms")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "make usernames unique",
+		Up:      uniqueUsernamesUp,
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex("users", "idx_users_username_unique")
+		},
+	},
+}
+
+// The tables as they were before migrations were versioned.
+
+type userV1 struct {
+	ID                string `gorm:"primaryKey"`
+	Username          string
+	Name              string
+	Email             string `gorm:"index"`
+	Status            int
+	Accounts          []*socialAccountV1 `gorm:"foreignKey:UserID"`
+	TOTPSecret        string             `gorm:"column:totp_secret"`
+	TOTPEnabled       bool               `gorm:"column:totp_enabled"`
+	TOTPRecoveryCodes string             `gorm:"column:totp_recovery_codes"`
+	TOTPConfirmedAt   time.Time          `gorm:"column:totp_confirmed_at"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+	EmailVerified     bool
+	PendingEmail      string
+}
+
+func (userV1) TableName() string { return "users" }
+
+type socialAccountV1 struct {
+	Provider  string `gorm:"primaryKey"`
+	SocialID  string `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (socialAccountV1) TableName() string { return "social_accounts" }
+
+type clientV1 struct {
+	ID           string `gorm:"primaryKey"`
+	Name         string
+	SecretHash   string
+	RedirectURIs string
+	GrantTypes   string
+	Audience     string
+	Scopes       string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (clientV1) TableName() string { return "clients" }
+
+type refreshTokenV1 struct {
+	ID        string `gorm:"primaryKey"`
+	Family    string `gorm:"index"`
+	Subject   string `gorm:"index"`
+	ClientID  string
+	Used      bool
+	Revoked   bool
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (refreshTokenV1) TableName() string { return "refresh_tokens" }
+
+type usernameReservationV1 struct {
+	Username  string `gorm:"primaryKey"`
+	UserID    string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (usernameReservationV1) TableName() string { return "username_reservations" }
+
+// initialSchemaUp also adopts databases created before migrations were
+// versioned: the tables may already exist, in whatever shape an older
+// release left them.
+func initialSchemaUp(tx *gorm.DB) error {
+	if err := rekeySocialAccounts(tx); err != nil {
+		return err
+	}
+
+	return tx.AutoMigrate(
+		&userV1{}, &socialAccountV1{},
+		&clientV1{},
+		&refreshTokenV1{},
+		&usernameReservationV1{},
+	)
+}
+
+func initialSchemaDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(
+		&socialAccountV1{}, &userV1{},
+		&clientV1{},
+		&refreshTokenV1{},
+		&usernameReservationV1{},
+	)
+}
+
+// rekeySocialAccounts moves the social_accounts table of earlier versions,
+// keyed by (user_id, social_id), to the (provider, social_id) key. Two users
+// sharing an account fail the copy, and with it the migration, rather than
+// losing one of them silently.
+func rekeySocialAccounts(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasTable(&socialAccountV1{}) {
+		return nil
+	}
+
+	columns, err := m.ColumnTypes(&socialAccountV1{})
+	if err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		if column.Name() != "provider" {
+			continue
+		}
+
+		if pk, ok := column.PrimaryKey(); ok && pk {
+			return nil
+		}
+	}
+
+	// Index names are per database, not per table.
+	for _, index := range []string{"idx_social_accounts_deleted_at", "idx_social_accounts_user_id"} {
+		if m.HasIndex(&socialAccountV1{}, index) {
+			if err := m.DropIndex(&socialAccountV1{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := m.RenameTable("social_accounts", "social_accounts_legacy"); err != nil {
+		return err
+	}
+
+	if err := m.CreateTable(&socialAccountV1{}); err != nil {
+		return err
+	}
+
+	if err := tx.Exec(`INSERT INTO social_accounts
+		(provider, social_id, user_id, created_at, updated_at, deleted_at)
+		SELECT provider, social_id, user_id, created_at, updated_at, deleted_at
+		FROM social_accounts_legacy`).Error; err != nil {
+		return err
+	}
+
+	return m.DropTable("social_accounts_legacy")
+}
+
+type userV2 struct {
+	userV1
+	Avatar string
+}
+
+func (userV2) TableName() string { return "users" }
+
+// userIndexesV3 holds just the columns user queries filter by.
+type userIndexesV3 struct {
+	Username  string    `gorm:"index;size:191"`
+	Status    int       `gorm:"index"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (userIndexesV3) TableName() string { return "users" }
+
+var userIndexFieldsV3 = []string{"Username", "Status", "CreatedAt"}
+
+func userIndexesUp(tx *gorm.DB) error {
+	m := tx.Migrator()
+
+	// MySQL indexes no TEXT column without a length.
+	if tx.Dialector.Name() == "mysql" {
+		if err := m.AlterColumn(&userIndexesV3{}, "Username"); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range userIndexFieldsV3 {
+		if err := m.CreateIndex(&userIndexesV3{}, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func userIndexesDown(tx *gorm.DB) error {
+	m := tx.Migrator()
+
+	for _, field := range userIndexFieldsV3 {
+		if err := m.DropIndex(&userIndexesV3{}, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// userVersionV4 counts the stores of a user; existing rows start at 0.
+type userVersionV4 struct {
+	Version int `gorm:"not null;default:0"`
+}
+
+func (userVersionV4) TableName() string { return "users" }
+
+// refreshTokenScopeV5 keeps the granted scope, space-separated; tokens
+// issued before carry none.
+type refreshTokenScopeV5 struct {
+	Scope string
+}
+
+func (refreshTokenScopeV5) TableName() string { return "refresh_tokens" }
+
+type revokedTokenV6 struct {
+	ID        string `gorm:"primaryKey"`
+	Subject   string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (revokedTokenV6) TableName() string { return "revoked_tokens" }
+
+type subjectRevocationV6 struct {
+	Subject      string `gorm:"primaryKey"`
+	IssuedBefore time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+func (subjectRevocationV6) TableName() string { return "subject_revocations" }
+
+// userSearchTermsUp creates the terms with a byte-wise collation, so a
+// prefix is a range of the key, and fills them from the users there are.
+func userSearchTermsUp(tx *gorm.DB) error {
+	var ddl string
+	switch tx.Dialector.Name() {
+	case "postgres":
+		ddl = `CREATE TABLE user_search_terms (
+			term TEXT COLLATE "C" NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (term, user_id)
+		)`
+
+	case "mysql":
+		ddl = `CREATE TABLE user_search_terms (
+			term VARCHAR(191) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+			user_id VARCHAR(191) NOT NULL,
+			PRIMARY KEY (term, user_id)
+		)`
+
+	default:
+		ddl = `CREATE TABLE user_search_terms (
+			term TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			PRIMARY KEY (term, user_id)
+		)`
+	}
+
+	if err := tx.Exec(ddl).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Exec(`CREATE INDEX idx_user_search_terms_user_id
+		ON user_search_terms (user_id)`).Error; err != nil {
+		return err
+	}
+
+	var users []*userV1
+	if err := tx.Preload("Accounts").Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		found := &user.User{
+			Username: u.Username,
+			Name:     u.Name,
+			Email:    u.Email,
+		}
+
+		for _, account := range u.Accounts {
+			found.Accounts = append(found.Accounts, &user.SocialAccount{
+				SocialID: user.SocialID(account.SocialID),
+			})
+		}
+
+		seen := make(map[string]struct{})
+		for _, term := range user.SearchTerms(found) {
+			if runes := []rune(term); len(runes) > 191 {
+				term = string(runes[:191])
+			}
+
+			if _, ok := seen[term]; ok {
+				continue
+			}
+			seen[term] = struct{}{}
+
+			if err := tx.Exec("INSERT INTO user_search_terms (term, user_id) VALUES (?, ?)",
+				term, u.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// uniqueUsernamesUp holds a username to one user not deleted; a deleted
+// user leaves theirs to be taken again. MySQL knows no partial index, but
+// leaves NULLs out of a unique one. Two users sharing a name fail the
+// migration, rather than one of them losing it silently.
+func uniqueUsernamesUp(tx *gorm.DB) error {
+	ddl := `CREATE UNIQUE INDEX idx_users_username_unique
+		ON users (username) WHERE deleted_at IS NULL`
+
+	if tx.Dialector.Name() == "mysql" {
+		ddl = `CREATE UNIQUE INDEX idx_users_username_unique
+			ON users ((IF(deleted_at IS NULL, username, NULL)))`
+	}
+
+	return tx.Exec(ddl).Error
+}
@@ -1,6 +1,9 @@
 package db
 
 import (
+	"strings"
+	"time"
+
 	"gorm.io/gorm"
 
 	"github.com/flarexio/core/events"
@@ -12,10 +15,55 @@ type User struct {
 	ID       string `gorm:"primaryKey"`
 	Username string
 	Name     string
-	Email    string
+	Email    string `gorm:"index"`
+	Avatar   string
 	Status   user.Status
 	Accounts []*SocialAccount
+	TOTP
 	DataModel
+
+	EmailVerified bool
+	PendingEmail  string
+	Version       int
+}
+
+// TOTP flattens user.TOTP into columns; a nil TOTP has an empty secret.
+type TOTP struct {
+	TOTPSecret        string    `gorm:"column:totp_secret"`
+	TOTPEnabled       bool      `gorm:"column:totp_enabled"`
+	TOTPRecoveryCodes string    `gorm:"column:totp_recovery_codes"` // comma-separated hashes
+	TOTPConfirmedAt   time.Time `gorm:"column:totp_confirmed_at"`
+}
+
+func NewTOTP(t *user.TOTP) TOTP {
+	if t == nil {
+		return TOTP{}
+	}
+
+	return TOTP{
+		TOTPSecret:        t.Secret,
+		TOTPEnabled:       t.Enabled,
+		TOTPRecoveryCodes: strings.Join(t.RecoveryCodes, ","),
+		TOTPConfirmedAt:   t.ConfirmedAt,
+	}
+}
+
+func (t TOTP) reconstitute() *user.TOTP {
+	if t.TOTPSecret == "" {
+		return nil
+	}
+
+	var codes []string
+	if t.TOTPRecoveryCodes != "" {
+		codes = strings.Split(t.TOTPRecoveryCodes, ",")
+	}
+
+	return &user.TOTP{
+		Secret:        t.TOTPSecret,
+		Enabled:       t.TOTPEnabled,
+		RecoveryCodes: codes,
+		ConfirmedAt:   t.TOTPConfirmedAt,
+	}
 }
 
 func NewUser(u *user.User) *User {
@@ -29,8 +77,10 @@ func NewUser(u *user.User) *User {
 		Username: u.Username,
 		Name:     u.Name,
 		Email:    u.Email,
+		Avatar:   u.Avatar,
 		Status:   u.Status,
 		Accounts: accounts,
+		TOTP:     NewTOTP(u.TOTP),
 		DataModel: DataModel{
 			CreatedAt: u.CreatedAt,
 			UpdatedAt: u.UpdatedAt,
@@ -39,6 +89,9 @@ func NewUser(u *user.User) *User {
 				Valid: !u.DeletedAt.IsZero(),
 			},
 		},
+		EmailVerified: u.EmailVerified,
+		PendingEmail:  u.PendingEmail,
+		Version:       u.Version,
 	}
 }
 
@@ -58,21 +111,28 @@ func (u *User) reconstitute() *user.User {
 		Username: u.Username,
 		Name:     u.Name,
 		Email:    u.Email,
+		Avatar:   u.Avatar,
 		Status:   u.Status,
 		Accounts: accounts,
+		TOTP:     u.TOTP.reconstitute(),
 		Model: model.Model{
 			CreatedAt: u.CreatedAt,
 			UpdatedAt: u.UpdatedAt,
 			DeletedAt: u.DeletedAt.Time,
 		},
-		EventStore: events.NewEventStore(),
+		EmailVerified: u.EmailVerified,
+		PendingEmail:  u.PendingEmail,
+		Version:       u.Version,
+		EventStore:    events.NewEventStore(),
 	}
 }
 
+// SocialAccount is keyed by provider and social ID: a subject is only
+// unique within the provider that issued it.
 type SocialAccount struct {
-	UserID   string        `gorm:"primaryKey"`
-	SocialID user.SocialID `gorm:"primaryKey"`
-	Provider user.SocialProvider
+	Provider user.SocialProvider `gorm:"primaryKey"`
+	SocialID user.SocialID       `gorm:"primaryKey"`
+	UserID   string              `gorm:"index"`
 	DataModel
 }
 
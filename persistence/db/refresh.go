@@ -0,0 +1,147 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/refresh"
+)
+
+type RefreshToken struct {
+	ID        string `gorm:"primaryKey"`
+	Family    string `gorm:"index"`
+	Subject   string `gorm:"index"`
+	ClientID  string
+	Scope     string // space-separated
+	Used      bool
+	Revoked   bool
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func NewRefreshToken(t *refresh.Token) *RefreshToken {
+	return &RefreshToken{
+		ID:        t.ID,
+		Family:    t.Family,
+		Subject:   t.Subject,
+		ClientID:  t.ClientID,
+		Scope:     strings.Join(t.Scope, " "),
+		Used:      t.Used,
+		Revoked:   t.Revoked,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: t.CreatedAt,
+	}
+}
+
+func (t *RefreshToken) reconstitute() *refresh.Token {
+	return &refresh.Token{
+		ID:        t.ID,
+		Family:    t.Family,
+		Subject:   t.Subject,
+		ClientID:  t.ClientID,
+		Scope:     strings.Fields(t.Scope),
+		Used:      t.Used,
+		Revoked:   t.Revoked,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: t.CreatedAt,
+	}
+}
+
+func NewRefreshTokenStore(cfg conf.Persistence) (refresh.Store, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &refreshTokenStore{db}, nil
+}
+
+type refreshTokenStore struct {
+	db *gorm.DB
+}
+
+func (s *refreshTokenStore) Save(t *refresh.Token) error {
+	if err := purgeExpired(s.db, &RefreshToken{}); err != nil {
+		return err
+	}
+
+	return s.db.Create(NewRefreshToken(t)).Error
+}
+
+func (s *refreshTokenStore) Use(id string) (*refresh.Token, error) {
+	var token RefreshToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Take(&token, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return refresh.ErrTokenInvalid
+			}
+
+			return err
+		}
+
+		// The conditional update decides races: only one caller flips it.
+		result := tx.Model(&RefreshToken{}).
+			Where("id = ? AND used = ?", id, false).
+			Update("used", true)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			token.Used = true
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token.reconstitute(), nil
+}
+
+func (s *refreshTokenStore) Find(id string) (*refresh.Token, error) {
+	var token RefreshToken
+	if err := s.db.Take(&token, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, refresh.ErrTokenInvalid
+		}
+
+		return nil, err
+	}
+
+	return token.reconstitute(), nil
+}
+
+func (s *refreshTokenStore) RevokeFamily(family string) error {
+	return s.db.Model(&RefreshToken{}).
+		Where("family = ?", family).
+		Update("revoked", true).
+		Error
+}
+
+func (s *refreshTokenStore) RevokeSubject(subject string) error {
+	return s.db.Model(&RefreshToken{}).
+		Where("subject = ?", subject).
+		Update("revoked", true).
+		Error
+}
+
+func (s *refreshTokenStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
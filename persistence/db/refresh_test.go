@@ -0,0 +1,107 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/refresh"
+)
+
+type refreshTokenStoreTestSuite struct {
+	suite.Suite
+	tokens refresh.Store
+}
+
+func (suite *refreshTokenStoreTestSuite) SetupSuite() {
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Name:   "identity",
+		InMem:  true,
+	}
+
+	tokens, err := NewRefreshTokenStore(cfg)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.tokens = tokens
+}
+
+func (suite *refreshTokenStoreTestSuite) TestUse() {
+	now := time.Now()
+	suite.tokens.Save(&refresh.Token{
+		ID:        "token01",
+		Family:    "family01",
+		Subject:   "mirror770109",
+		Scope:     []string{"openid", "profile"},
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	})
+
+	// 第一次使用回傳未使用的狀態
+	t, err := suite.tokens.Use("token01")
+	suite.NoError(err)
+	suite.Equal("mirror770109", t.Subject)
+	suite.Equal([]string{"openid", "profile"}, t.Scope)
+	suite.False(t.Used)
+
+	// 第二次使用即為重複使用
+	t, err = suite.tokens.Use("token01")
+	suite.NoError(err)
+	suite.True(t.Used)
+
+	_, err = suite.tokens.Use("unknown")
+	suite.ErrorIs(err, refresh.ErrTokenInvalid)
+}
+
+func (suite *refreshTokenStoreTestSuite) TestRevokeFamily() {
+	now := time.Now()
+	for _, id := range []string{"token02", "token03"} {
+		suite.tokens.Save(&refresh.Token{
+			ID:        id,
+			Family:    "family02",
+			Subject:   "mirror770109",
+			ExpiresAt: now.Add(time.Hour),
+			CreatedAt: now,
+		})
+	}
+
+	err := suite.tokens.RevokeFamily("family02")
+	suite.NoError(err)
+
+	// 同一家族的所有 token 都被撤銷
+	t, err := suite.tokens.Use("token03")
+	suite.NoError(err)
+	suite.True(t.Revoked)
+}
+
+func (suite *refreshTokenStoreTestSuite) TestRevokeSubject() {
+	now := time.Now()
+	suite.tokens.Save(&refresh.Token{
+		ID:        "token04",
+		Family:    "family04",
+		Subject:   "revoked",
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	})
+
+	err := suite.tokens.RevokeSubject("revoked")
+	suite.NoError(err)
+
+	// 使用者的所有 token 都被撤銷
+	t, err := suite.tokens.Use("token04")
+	suite.NoError(err)
+	suite.True(t.Revoked)
+}
+
+func (suite *refreshTokenStoreTestSuite) TearDownSuite() {
+	suite.tokens.Close()
+}
+
+func TestRefreshTokenStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(refreshTokenStoreTestSuite))
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+type UsernameReservation struct {
+	Username  string `gorm:"primaryKey"`
+	UserID    string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func NewReservationStore(cfg conf.Persistence) (user.ReservationStore, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &reservationStore{db}, nil
+}
+
+type reservationStore struct {
+	db *gorm.DB
+}
+
+func (s *reservationStore) Reserve(r *user.Reservation) error {
+	if err := purgeExpired(s.db, &UsernameReservation{}); err != nil {
+		return err
+	}
+
+	return s.db.Save(&UsernameReservation{
+		Username:  r.Username,
+		UserID:    r.UserID.String(),
+		ExpiresAt: r.ExpiresAt,
+	}).Error
+}
+
+func (s *reservationStore) Release(username string) error {
+	return s.db.Delete(&UsernameReservation{}, "username = ?", username).Error
+}
+
+func (s *reservationStore) Find(username string) (*user.Reservation, error) {
+	var r UsernameReservation
+	if err := s.db.Take(&r, "username = ? AND expires_at > ?", username, time.Now()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, user.ErrReservationNotFound
+		}
+
+		return nil, err
+	}
+
+	id, err := user.ParseID(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.Reservation{
+		Username:  r.Username,
+		UserID:    id,
+		ExpiresAt: r.ExpiresAt,
+	}, nil
+}
+
+func (s *reservationStore) Close() error {
+	return nil
+}
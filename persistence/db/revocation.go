@@ -0,0 +1,133 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/revocation"
+)
+
+type RevokedToken struct {
+	ID        string `gorm:"primaryKey"`
+	Subject   string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// SubjectRevocation is the latest revoke-all of a subject.
+type SubjectRevocation struct {
+	Subject      string `gorm:"primaryKey"`
+	IssuedBefore time.Time
+	ExpiresAt    time.Time `gorm:"index"`
+}
+
+func NewRevocationStore(cfg conf.Persistence) (revocation.Store, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	return &revocationStore{db}, nil
+}
+
+type revocationStore struct {
+	db *gorm.DB
+}
+
+// Add is idempotent: every instance applies what the others publish, and
+// with a shared database they all write the same rows.
+func (s *revocationStore) Add(r *revocation.Revocation) error {
+	if err := purgeExpired(s.db, &RevokedToken{}, &SubjectRevocation{}); err != nil {
+		return err
+	}
+
+	if r.ID != "" {
+		return s.db.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&RevokedToken{
+				ID:        r.ID,
+				Subject:   r.Subject,
+				ExpiresAt: r.ExpiresAt,
+			}).Error
+	}
+
+	// Only ever move a revoke-all forward. An insert losing the race to
+	// another one retries the update once.
+	for range 2 {
+		result := s.db.Model(&SubjectRevocation{}).
+			Where("subject = ? AND issued_before < ?", r.Subject, r.IssuedBefore).
+			Updates(map[string]any{
+				"issued_before": r.IssuedBefore,
+				"expires_at":    r.ExpiresAt,
+			})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			return nil
+		}
+
+		result = s.db.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&SubjectRevocation{
+				Subject:      r.Subject,
+				IssuedBefore: r.IssuedBefore,
+				ExpiresAt:    r.ExpiresAt,
+			})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *revocationStore) Revoked(id string, subject string, issuedAt time.Time) (bool, error) {
+	var count int64
+	if err := s.db.Model(&RevokedToken{}).
+		Where("id = ?", id).
+		Count(&count).
+		Error; err != nil {
+		return false, err
+	}
+
+	if count > 0 {
+		return true, nil
+	}
+
+	var r SubjectRevocation
+	if err := s.db.Take(&r, "subject = ?", subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	// iat only has second precision, so a token from the same second as
+	// the revocation is treated as issued before it.
+	return !issuedAt.After(r.IssuedBefore.Truncate(time.Second)), nil
+}
+
+func (s *revocationStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
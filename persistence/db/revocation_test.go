@@ -0,0 +1,93 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/revocation"
+)
+
+type revocationStoreTestSuite struct {
+	suite.Suite
+	revocations revocation.Store
+}
+
+func (suite *revocationStoreTestSuite) SetupSuite() {
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Name:   "identity",
+		InMem:  true,
+	}
+
+	revocations, err := NewRevocationStore(cfg)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.revocations = revocations
+}
+
+func (suite *revocationStoreTestSuite) TestAddToken() {
+	now := time.Now()
+	r := &revocation.Revocation{
+		ID:        "token01",
+		Subject:   "mirror770109",
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	suite.NoError(suite.revocations.Add(r))
+
+	// 重複套用同一筆撤銷不影響結果
+	suite.NoError(suite.revocations.Add(r))
+
+	revoked, err := suite.revocations.Revoked("token01", "mirror770109", now)
+	suite.NoError(err)
+	suite.True(revoked)
+
+	revoked, err = suite.revocations.Revoked("token02", "mirror770109", now)
+	suite.NoError(err)
+	suite.False(revoked)
+}
+
+func (suite *revocationStoreTestSuite) TestAddSubject() {
+	now := time.Now()
+	later := &revocation.Revocation{
+		Subject:      "revoked",
+		IssuedBefore: now,
+		ExpiresAt:    now.Add(time.Hour),
+	}
+
+	suite.NoError(suite.revocations.Add(later))
+
+	// 較早的全部撤銷不會覆蓋較晚的
+	suite.NoError(suite.revocations.Add(&revocation.Revocation{
+		Subject:      "revoked",
+		IssuedBefore: now.Add(-time.Hour),
+		ExpiresAt:    now.Add(time.Hour),
+	}))
+
+	revoked, err := suite.revocations.Revoked("token03", "revoked", now.Add(-time.Minute))
+	suite.NoError(err)
+	suite.True(revoked)
+
+	// 撤銷之後簽發的 token 不受影響
+	revoked, err = suite.revocations.Revoked("token03", "revoked", now.Add(2*time.Second))
+	suite.NoError(err)
+	suite.False(revoked)
+
+	revoked, err = suite.revocations.Revoked("token03", "mirror770109", now.Add(-time.Minute))
+	suite.NoError(err)
+	suite.False(revoked)
+}
+
+func (suite *revocationStoreTestSuite) TearDownSuite() {
+	suite.revocations.Close()
+}
+
+func TestRevocationStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(revocationStoreTestSuite))
+}
@@ -0,0 +1,295 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+var ErrFTS5Unavailable = errors.New("sqlite built without fts5")
+
+// NewSearchIndex keeps the index in the database, so every instance sharing
+// it searches the same users. SQLite built with the sqlite_fts5 tag gets a
+// full-text table; any other build or database a table of terms, which the
+// migrations create.
+func NewSearchIndex(cfg conf.Persistence) (user.SearchIndex, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
+
+	if cfg.Driver == conf.SQLite {
+		index, err := newFTS5Index(db)
+		if !errors.Is(err, ErrFTS5Unavailable) {
+			return index, err
+		}
+	}
+
+	return &termIndex{db}, nil
+}
+
+// newFTS5Index keeps the index in an FTS5 table beside the users. The table
+// is no part of the migrations: it takes SQLite built with the sqlite_fts5
+// tag, and as it is derived from the users, it is filled from them whenever
+// it has to be created.
+func newFTS5Index(db *gorm.DB) (user.SearchIndex, error) {
+	index := &fts5Index{db}
+
+	if db.Migrator().HasTable("users_search") {
+		return index, nil
+	}
+
+	if err := db.Exec(`CREATE VIRTUAL TABLE users_search USING fts5(
+		user_id, terms,
+		tokenize = "unicode61 remove_diacritics 0",
+		prefix = '2 3'
+	)`).Error; err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return nil, ErrFTS5Unavailable
+		}
+
+		return nil, err
+	}
+
+	users, err := (&userRepository{db}).ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if err := index.Index(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
+}
+
+type fts5Index struct {
+	db *gorm.DB
+}
+
+// phrase quotes a token for MATCH, limited to one column.
+func phrase(column string, token string, prefix bool) string {
+	p := column + ` : "` + strings.ReplaceAll(token, `"`, `""`) + `"`
+	if prefix {
+		p += "*"
+	}
+
+	return p
+}
+
+func (index *fts5Index) Index(u *user.User) error {
+	return index.db.Transaction(func(tx *gorm.DB) error {
+		if err := remove(tx, u.ID); err != nil {
+			return err
+		}
+
+		return tx.Exec("INSERT INTO users_search (user_id, terms) VALUES (?, ?)",
+			u.ID.String(), strings.Join(user.SearchTerms(u), " ")).Error
+	})
+}
+
+func (index *fts5Index) Remove(id user.UserID) error {
+	return remove(index.db, id)
+}
+
+// remove goes through the full-text index on user_id, not a table scan.
+func remove(tx *gorm.DB, id user.UserID) error {
+	return tx.Exec("DELETE FROM users_search WHERE users_search MATCH ?",
+		phrase("user_id", strings.ToLower(id.String()), false)).Error
+}
+
+func (index *fts5Index) Search(query string, limit int) ([]user.UserID, error) {
+	tokens := user.Tokenize(query)
+	if len(tokens) == 0 {
+		return nil, user.ErrSearchQueryEmpty
+	}
+
+	phrases := make([]string, len(tokens))
+	for i, token := range tokens {
+		phrases[i] = phrase("terms", token, true)
+	}
+
+	var rows []string
+	if err := index.db.Raw(`SELECT user_id FROM users_search
+		WHERE users_search MATCH ?
+		ORDER BY rank
+		LIMIT ?`, strings.Join(phrases, " AND "), limit).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return parseIDs(rows)
+}
+
+func (index *fts5Index) Close() error {
+	return nil
+}
+
+// UserSearchTerm is one word a user is found by. The term column compares
+// bytes on every database, so a prefix is a range of the primary key.
+type UserSearchTerm struct {
+	Term   string `gorm:"primaryKey"`
+	UserID string `gorm:"primaryKey"`
+}
+
+// maxTermLength fits the key MySQL can index.
+const maxTermLength = 191
+
+func searchTerm(word string) string {
+	if runes := []rune(word); len(runes) > maxTermLength {
+		return string(runes[:maxTermLength])
+	}
+
+	return word
+}
+
+// prefixRange bounds the terms starting with prefix: compared as bytes, no
+// character sorts past U+10FFFF.
+func prefixRange(prefix string) (string, string) {
+	return prefix, prefix + "\U0010FFFF"
+}
+
+type termIndex struct {
+	db *gorm.DB
+}
+
+func (index *termIndex) Index(u *user.User) error {
+	return index.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&UserSearchTerm{}, "user_id = ?", u.ID.String()).Error; err != nil {
+			return err
+		}
+
+		seen := make(map[string]struct{})
+		rows := make([]*UserSearchTerm, 0)
+		for _, word := range user.SearchTerms(u) {
+			term := searchTerm(word)
+			if _, ok := seen[term]; ok {
+				continue
+			}
+
+			seen[term] = struct{}{}
+			rows = append(rows, &UserSearchTerm{Term: term, UserID: u.ID.String()})
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		return tx.Create(rows).Error
+	})
+}
+
+func (index *termIndex) Remove(id user.UserID) error {
+	return index.db.Delete(&UserSearchTerm{}, "user_id = ?", id.String()).Error
+}
+
+// Search reads the terms of the users matching every token, and scores
+// them as the in-memory index does: a whole word above a prefix.
+func (index *termIndex) Search(query string, limit int) ([]user.UserID, error) {
+	tokens := user.Tokenize(query)
+	if len(tokens) == 0 {
+		return nil, user.ErrSearchQueryEmpty
+	}
+
+	for i, token := range tokens {
+		tokens[i] = searchTerm(token)
+	}
+
+	// Rows of any token, from the users matching every one.
+	ranges := make([]string, len(tokens))
+	args := make([]any, 0, 4*len(tokens))
+	for i, token := range tokens {
+		from, to := prefixRange(token)
+
+		ranges[i] = "(term >= ? AND term < ?)"
+		args = append(args, from, to)
+	}
+
+	sql := "SELECT term, user_id FROM user_search_terms WHERE (" + strings.Join(ranges, " OR ") + ")"
+	for _, token := range tokens {
+		from, to := prefixRange(token)
+
+		sql += " AND user_id IN (SELECT user_id FROM user_search_terms WHERE term >= ? AND term < ?)"
+		args = append(args, from, to)
+	}
+
+	var rows []*UserSearchTerm
+	if err := index.db.Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]int)
+	best := make(map[string]map[string]int) // map[UserID]map[Token]Score
+	for _, row := range rows {
+		if best[row.UserID] == nil {
+			best[row.UserID] = make(map[string]int)
+		}
+
+		for _, token := range tokens {
+			if !strings.HasPrefix(row.Term, token) {
+				continue
+			}
+
+			score := 1
+			if row.Term == token {
+				score = 2
+			}
+
+			best[row.UserID][token] = max(best[row.UserID][token], score)
+		}
+	}
+
+	for id, perToken := range best {
+		for _, score := range perToken {
+			scores[id] += score
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+
+		return ids[i] < ids[j]
+	})
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	return parseIDs(ids)
+}
+
+func (index *termIndex) Close() error {
+	return nil
+}
+
+func parseIDs(rows []string) ([]user.UserID, error) {
+	ids := make([]user.UserID, 0, len(rows))
+	for _, row := range rows {
+		id, err := user.ParseID(row)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
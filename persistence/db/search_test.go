@@ -0,0 +1,159 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+// TestSearchIndex needs the sqlite_fts5 build tag.
+func TestSearchIndex(t *testing.T) {
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Name:   "search",
+		InMem:  true,
+	}
+
+	users, err := NewUserRepository(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 建立索引前已存在的用戶須被補進索引
+	u := user.NewUser("mirror770109", "Lin, Ying-Chin", "mirror770109@gmail.com")
+	u.AddSocialAccount(user.GOOGLE, "100043685676652067799")
+	if err := users.Store(u); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := newFTS5Index(db)
+	if errors.Is(err, ErrFTS5Unavailable) {
+		t.Skip(err.Error())
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	testSearchIndex(t, index, u)
+}
+
+// TestTermIndex runs wherever FTS5 is missing, as on the server databases.
+func TestTermIndex(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := conf.Persistence{
+		Driver: conf.SQLite,
+		Name:   "terms",
+		InMem:  true,
+	}
+
+	users, err := NewUserRepository(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := user.NewUser("yuki1207", "Tanaka Yukiko", "yuki1207@example.jp")
+	u.AddSocialAccount(user.GOOGLE, "100043685676652067800")
+	if err := users.Store(u); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新建立詞表時須補進既有的用戶
+	m, err := NewMigrator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 退回詞表之前的版本 (6)
+	if _, err := m.Down(len(migrations) - 6); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := &termIndex{db}
+
+	ids, err := index.Search("tanaka yuki", 10)
+	assert.NoError(err)
+	assert.Equal([]user.UserID{u.ID}, ids)
+
+	// 完整符合的詞排在前綴之前
+	other := user.NewUser("mishima", "Yuki Mishima", "mishima@example.jp")
+	assert.NoError(index.Index(other))
+
+	ids, err = index.Search("yuki", 10)
+	assert.NoError(err)
+	assert.Equal([]user.UserID{other.ID, u.ID}, ids)
+
+	ids, err = index.Search("yuki", 1)
+	assert.NoError(err)
+	assert.Equal([]user.UserID{other.ID}, ids)
+
+	assert.NoError(index.Remove(other.ID))
+
+	// 記憶體資料庫與其他測試共用
+	assert.NoError(db.Exec("DELETE FROM user_search_terms").Error)
+
+	u = user.NewUser("mirror770109", "Lin, Ying-Chin", "mirror770109@gmail.com")
+	u.AddSocialAccount(user.GOOGLE, "100043685676652067799")
+	assert.NoError(index.Index(u))
+
+	testSearchIndex(t, index, u)
+}
+
+// testSearchIndex expects u indexed, and nobody else matching it.
+func testSearchIndex(t *testing.T, index user.SearchIndex, u *user.User) {
+	assert := assert.New(t)
+
+	for _, query := range []string{"ying", "Lin", "mirror77", "gmail.com", "1000436856"} {
+		ids, err := index.Search(query, 10)
+		assert.NoError(err)
+		assert.Equal([]user.UserID{u.ID}, ids, query)
+	}
+
+	// 每個詞都須符合
+	ids, err := index.Search("lin yahoo", 10)
+	assert.NoError(err)
+	assert.Empty(ids)
+
+	_, err = index.Search(" , ", 10)
+	assert.ErrorIs(err, user.ErrSearchQueryEmpty)
+
+	// 重新索引後舊名稱不再可搜尋
+	u.Name = "Mirror Lin"
+	err = index.Index(u)
+	assert.NoError(err)
+
+	ids, err = index.Search("ying", 10)
+	assert.NoError(err)
+	assert.Empty(ids)
+
+	ids, err = index.Search("mirror lin", 10)
+	assert.NoError(err)
+	assert.Equal([]user.UserID{u.ID}, ids)
+
+	err = index.Remove(u.ID)
+	assert.NoError(err)
+
+	ids, err = index.Search("mirror", 10)
+	assert.NoError(err)
+	assert.Empty(ids)
+}
@@ -2,28 +2,24 @@ package db
 
 import (
 	"errors"
+	"strings"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/flarexio/identity/conf"
 	"github.com/flarexio/identity/user"
 )
 
 func NewUserRepository(cfg conf.Persistence) (user.Repository, error) {
-	filename := cfg.Host + "/" + cfg.Name + ".db"
-	if cfg.InMem {
-		filename = "file::memory:?cache=shared"
-	}
-
-	db, err := gorm.Open(sqlite.Open(filename), &gorm.Config{})
+	db, err := open(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	db.AutoMigrate(
-		&User{}, &SocialAccount{},
-	)
+	if err := migrate(db); err != nil {
+		return nil, err
+	}
 
 	repo := new(userRepository)
 	repo.db = db
@@ -35,35 +31,132 @@ type userRepository struct {
 }
 
 func (repo *userRepository) Store(u *user.User) error {
-	user := NewUser(u) // convert Domain to Data model
+	row := NewUser(u) // convert Domain to Data model
+	row.Version++
 
-	return repo.db.Transaction(func(tx *gorm.DB) error {
-		// First, delete existing social accounts
+	if err := repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkUsername(tx, row); err != nil {
+			return err
+		}
+
+		if err := checkSocialAccounts(tx, row); err != nil {
+			return err
+		}
+
+		// Update the user only from the version it was read at
+		result := tx.Model(row).
+			Omit(clause.Associations).
+			Where("version = ?", u.Version).
+			Select("*").
+			Updates(row)
+
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		// or insert it, unless somebody else did first
+		if result.RowsAffected == 0 && u.Version == 0 {
+			result = tx.Omit(clause.Associations).
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(row)
+
+			if err := result.Error; err != nil {
+				return err
+			}
+
+			// The unique index held back a user registered meanwhile
+			if result.RowsAffected == 0 {
+				if err := checkUsername(tx, row); err != nil {
+					return err
+				}
+			}
+		}
+
+		if result.RowsAffected == 0 {
+			return user.ErrConcurrentModification
+		}
+
+		// Then, replace the social accounts
 		if err := tx.Unscoped().
-			Where("user_id = ?", user.ID).
+			Where("user_id = ?", row.ID).
 			Delete(&SocialAccount{}).
 			Error; err != nil {
 			return err
 		}
 
-		// Then, save the user
-		return tx.Save(user).Error
-	})
-}
+		if len(row.Accounts) == 0 {
+			return nil
+		}
 
-func (repo *userRepository) Delete(u *user.User) error {
-	user := NewUser(u) // convert Domain to Data model
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&row.Accounts).
+			Error
+	}); err != nil {
+		return err
+	}
 
-	result := repo.db.Unscoped().Delete(
-		&SocialAccount{},
-		"user_id = ?", user.ID)
+	u.Version = row.Version
+	return nil
+}
 
-	if err := result.Error; err != nil {
+// checkUsername fails when another user has the username; the unique index
+// of the migrations stands behind it.
+func checkUsername(tx *gorm.DB, u *User) error {
+	var count int64
+	if err := tx.Model(&User{}).
+		Where("username = ? AND id <> ?", u.Username, u.ID).
+		Count(&count).
+		Error; err != nil {
 		return err
 	}
 
-	result = repo.db.Delete(user)
-	return result.Error
+	if count > 0 {
+		return user.ErrUserExists
+	}
+
+	return nil
+}
+
+// checkSocialAccounts fails when another user holds one of the accounts.
+// Saving associations skips conflicting rows silently, so it cannot be left
+// to the primary key.
+func checkSocialAccounts(tx *gorm.DB, u *User) error {
+	for _, account := range u.Accounts {
+		var count int64
+		if err := tx.Unscoped().
+			Model(&SocialAccount{}).
+			Where("provider = ? AND social_id = ? AND user_id <> ?",
+				account.Provider, account.SocialID, u.ID).
+			Count(&count).
+			Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return user.ErrSocialAccountExists
+		}
+	}
+
+	return nil
+}
+
+func (repo *userRepository) Delete(u *user.User) error {
+	row := NewUser(u) // convert Domain to Data model
+
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("version = ?", u.Version).Delete(row)
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return user.ErrConcurrentModification
+		}
+
+		return tx.Unscoped().
+			Delete(&SocialAccount{}, "user_id = ?", row.ID).
+			Error
+	})
 }
 
 func (repo *userRepository) ListAll() ([]*user.User, error) {
@@ -82,6 +175,92 @@ func (repo *userRepository) ListAll() ([]*user.User, error) {
 	return results, nil
 }
 
+// Query pages through users by primary key; the filters are backed by
+// indexes on status, created_at, username and email, which a prefix only
+// uses as a range on SQLite (see wherePrefix).
+func (repo *userRepository) Query(q *user.Query) (*user.Page, error) {
+	cursor, err := q.CursorID()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := repo.db.Preload("Accounts")
+
+	if cursor != nil {
+		op := ">"
+		if q.Sort == user.SortNewest {
+			op = "<"
+		}
+
+		tx = tx.Where("id "+op+" ?", cursor.String())
+	}
+
+	if len(q.Status) > 0 {
+		tx = tx.Where("status IN ?", q.Status)
+	}
+
+	if q.Provider != "" {
+		tx = tx.Where(`EXISTS (SELECT 1 FROM social_accounts
+			WHERE social_accounts.user_id = users.id
+			AND social_accounts.provider = ?
+			AND social_accounts.deleted_at IS NULL)`, q.Provider)
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		tx = tx.Where("created_at >= ?", q.CreatedAfter)
+	}
+
+	if !q.CreatedBefore.IsZero() {
+		tx = tx.Where("created_at < ?", q.CreatedBefore)
+	}
+
+	if q.UsernamePrefix != "" {
+		tx = wherePrefix(tx, "username", q.UsernamePrefix)
+	}
+
+	if q.EmailPrefix != "" {
+		tx = wherePrefix(tx, "email", q.EmailPrefix)
+	}
+
+	order := "id"
+	if q.Sort == user.SortNewest {
+		order = "id DESC"
+	}
+
+	size := q.Size()
+
+	var users []*User
+	if err := tx.Order(order).Limit(size + 1).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.User, 0)
+	for _, u := range users {
+		results = append(results, u.reconstitute())
+	}
+
+	return user.NewPage(results, size), nil
+}
+
+// wherePrefix filters on the values of column starting with prefix. SQLite
+// compares columns as bytes but LIKE ignoring case, which keeps it off the
+// index; there the prefix is a range, as for the search terms.
+func wherePrefix(tx *gorm.DB, column string, prefix string) *gorm.DB {
+	if tx.Dialector.Name() == "sqlite" {
+		from, to := prefixRange(prefix)
+		return tx.Where(column+" >= ? AND "+column+" < ?", from, to)
+	}
+
+	return tx.Where(column+` LIKE ? ESCAPE '!'`, likePrefix(prefix))
+}
+
+// likePrefix matches strings starting with prefix, wildcards and all. The
+// escape is '!' since MySQL reads a backslash in a literal as one itself.
+func likePrefix(prefix string) string {
+	prefix = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix)
+	return prefix + "%"
+}
+
 func (repo *userRepository) Find(id user.UserID) (*user.User, error) {
 	var u *User
 
@@ -114,12 +293,12 @@ func (repo *userRepository) FindByUsername(username string) (*user.User, error)
 	return user, nil
 }
 
-func (repo *userRepository) FindBySocialID(socialID user.SocialID) (*user.User, error) {
+func (repo *userRepository) FindBySocialAccount(provider user.SocialProvider, socialID user.SocialID) (*user.User, error) {
 	var u *User
 	result := repo.db.
 		Preload("Accounts").
 		Joins("INNER JOIN social_accounts ON social_accounts.user_id = users.id").
-		Take(&u, "social_accounts.social_id = ?", socialID)
+		Take(&u, "social_accounts.provider = ? AND social_accounts.social_id = ?", provider, socialID)
 
 	if err := result.Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -133,6 +312,22 @@ func (repo *userRepository) FindBySocialID(socialID user.SocialID) (*user.User,
 	return user, nil
 }
 
+func (repo *userRepository) FindByEmail(email string) ([]*user.User, error) {
+	var users []*User
+
+	result := repo.db.Preload("Accounts").Find(&users, "email = ?", email)
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]*user.User, 0)
+	for _, u := range users {
+		results = append(results, u.reconstitute())
+	}
+
+	return results, nil
+}
+
 func (repo *userRepository) Close() error {
 	return nil
 }
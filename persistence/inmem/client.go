@@ -0,0 +1,68 @@
+package inmem
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/flarexio/identity/client"
+)
+
+func NewClientRepository() (client.Repository, error) {
+	return &clientRepository{
+		clients: make(map[string]client.Client),
+	}, nil
+}
+
+type clientRepository struct {
+	clients map[string]client.Client
+	sync.RWMutex
+}
+
+func (repo *clientRepository) Store(c *client.Client) error {
+	repo.Lock()
+	defer repo.Unlock()
+
+	repo.clients[c.ID] = *c
+	return nil
+}
+
+func (repo *clientRepository) Delete(id string) error {
+	repo.Lock()
+	defer repo.Unlock()
+
+	delete(repo.clients, id)
+	return nil
+}
+
+func (repo *clientRepository) Find(id string) (*client.Client, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	c, ok := repo.clients[id]
+	if !ok {
+		return nil, client.ErrClientNotFound
+	}
+
+	return &c, nil
+}
+
+func (repo *clientRepository) List() ([]*client.Client, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	clients := make([]*client.Client, 0, len(repo.clients))
+	for _, c := range repo.clients {
+		clients = append(clients, &c)
+	}
+
+	slices.SortFunc(clients, func(a, b *client.Client) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return clients, nil
+}
+
+func (repo *clientRepository) Close() error {
+	return nil
+}
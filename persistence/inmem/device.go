@@ -0,0 +1,146 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/device"
+)
+
+func NewDeviceAuthorizationStore() (device.Store, error) {
+	store := &deviceAuthorizationStore{
+		authorizations: make(map[string]*device.Authorization),
+		userCodes:      make(map[string]string),
+		done:           make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type deviceAuthorizationStore struct {
+	authorizations map[string]*device.Authorization // by device code
+	userCodes      map[string]string                // user code -> device code
+	done           chan struct{}
+	once           sync.Once
+	sync.Mutex
+}
+
+func (s *deviceAuthorizationStore) Save(a *device.Authorization) error {
+	s.Lock()
+	defer s.Unlock()
+
+	saved := *a
+	s.authorizations[a.DeviceCode] = &saved
+	s.userCodes[a.UserCode] = a.DeviceCode
+	return nil
+}
+
+func (s *deviceAuthorizationStore) Decide(userCode string, subject string, status device.Status) error {
+	s.Lock()
+	defer s.Unlock()
+
+	a, ok := s.findByUserCode(userCode)
+	if !ok || a.Status != device.Pending {
+		return device.ErrUserCodeInvalid
+	}
+
+	a.Status = status
+	a.Subject = subject
+	return nil
+}
+
+func (s *deviceAuthorizationStore) Poll(deviceCode string, clientID string) (*device.Authorization, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	a, ok := s.authorizations[deviceCode]
+	if !ok || time.Now().After(a.ExpiresAt) {
+		return nil, device.ErrDeviceCodeInvalid
+	}
+
+	polled := *a
+
+	// Left for the service to turn down, untouched.
+	if a.ClientID != clientID {
+		return &polled, nil
+	}
+
+	// One-time: a decision is handed out on the first poll after it.
+	if a.Status != device.Pending {
+		s.delete(a)
+		return &polled, nil
+	}
+
+	now := time.Now()
+	if now.Sub(a.LastPolledAt) < a.Interval {
+		a.Interval += device.SlowDownStep
+	}
+
+	a.LastPolledAt = now
+	return &polled, nil
+}
+
+func (s *deviceAuthorizationStore) FindByUserCode(userCode string) (*device.Authorization, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	a, ok := s.findByUserCode(userCode)
+	if !ok {
+		return nil, device.ErrUserCodeInvalid
+	}
+
+	found := *a
+	return &found, nil
+}
+
+func (s *deviceAuthorizationStore) findByUserCode(userCode string) (*device.Authorization, bool) {
+	deviceCode, ok := s.userCodes[userCode]
+	if !ok {
+		return nil, false
+	}
+
+	a, ok := s.authorizations[deviceCode]
+	if !ok || time.Now().After(a.ExpiresAt) {
+		return nil, false
+	}
+
+	return a, true
+}
+
+func (s *deviceAuthorizationStore) delete(a *device.Authorization) {
+	delete(s.authorizations, a.DeviceCode)
+	delete(s.userCodes, a.UserCode)
+}
+
+func (s *deviceAuthorizationStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *deviceAuthorizationStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *deviceAuthorizationStore) purgeExpired() {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	for _, a := range s.authorizations {
+		if now.After(a.ExpiresAt) {
+			s.delete(a)
+		}
+	}
+}
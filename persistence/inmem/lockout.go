@@ -0,0 +1,97 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/lockout"
+)
+
+// NewLockoutStore keeps the records of this instance only; every instance
+// counts the failures it sees.
+func NewLockoutStore() (lockout.Store, error) {
+	store := &lockoutStore{
+		records: make(map[string]lockoutRecord),
+		done:    make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type lockoutRecord struct {
+	record    lockout.Record
+	expiresAt time.Time
+}
+
+type lockoutStore struct {
+	records map[string]lockoutRecord
+	done    chan struct{}
+	once    sync.Once
+	sync.Mutex
+}
+
+func (s *lockoutStore) Save(key string, r *lockout.Record, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.records[key] = lockoutRecord{
+		record:    *r,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *lockoutStore) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+func (s *lockoutStore) Find(key string) (*lockout.Record, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	r, ok := s.records[key]
+	if !ok || time.Now().After(r.expiresAt) {
+		return nil, lockout.ErrRecordNotFound
+	}
+
+	record := r.record
+	return &record, nil
+}
+
+func (s *lockoutStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *lockoutStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *lockoutStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for key, r := range s.records {
+		if now.After(r.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
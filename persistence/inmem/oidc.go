@@ -0,0 +1,93 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/oidc"
+)
+
+func NewAuthorizationCodeStore() (oidc.Store, error) {
+	store := &authorizationCodeStore{
+		codes: make(map[string]pendingCode),
+		done:  make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type pendingCode struct {
+	code      *oidc.AuthorizationCode
+	expiresAt time.Time
+}
+
+type authorizationCodeStore struct {
+	codes map[string]pendingCode
+	done  chan struct{}
+	once  sync.Once
+	sync.Mutex
+}
+
+func (s *authorizationCodeStore) Save(code string, c *oidc.AuthorizationCode, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.codes[code] = pendingCode{
+		code:      c,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *authorizationCodeStore) Consume(code string) (*oidc.AuthorizationCode, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.codes[code]
+	if !ok {
+		return nil, oidc.ErrCodeInvalid
+	}
+
+	// One-time: delete on first read (lock makes lookup+delete atomic).
+	delete(s.codes, code)
+
+	if time.Now().After(c.expiresAt) {
+		return nil, oidc.ErrCodeInvalid
+	}
+
+	return c.code, nil
+}
+
+func (s *authorizationCodeStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *authorizationCodeStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *authorizationCodeStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for code, c := range s.codes {
+		if now.After(c.expiresAt) {
+			delete(s.codes, code)
+		}
+	}
+}
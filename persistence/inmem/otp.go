@@ -0,0 +1,101 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/otp"
+)
+
+func NewOTPStore() (otp.Store, error) {
+	store := &otpStore{
+		codes: make(map[string]otp.Code),
+		done:  make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type otpStore struct {
+	codes map[string]otp.Code
+	done  chan struct{}
+	once  sync.Once
+	sync.Mutex
+}
+
+func (s *otpStore) Save(subject string, code *otp.Code) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.codes[subject] = *code
+	return nil
+}
+
+func (s *otpStore) Find(subject string) (*otp.Code, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.codes[subject]
+	if !ok {
+		return nil, otp.ErrCodeInvalid
+	}
+
+	return &c, nil
+}
+
+func (s *otpStore) Attempt(subject string) (*otp.Code, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.codes[subject]
+	if !ok {
+		return nil, otp.ErrCodeInvalid
+	}
+
+	c.Attempts++
+	s.codes[subject] = c
+
+	return &c, nil
+}
+
+func (s *otpStore) Delete(subject string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.codes, subject)
+	return nil
+}
+
+func (s *otpStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *otpStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *otpStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for subject, c := range s.codes {
+		if now.After(c.ExpiresAt) {
+			delete(s.codes, subject)
+		}
+	}
+}
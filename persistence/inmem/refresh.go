@@ -0,0 +1,122 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/refresh"
+)
+
+func NewRefreshTokenStore() (refresh.Store, error) {
+	store := &refreshTokenStore{
+		tokens: make(map[string]refresh.Token),
+		done:   make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type refreshTokenStore struct {
+	tokens map[string]refresh.Token
+	done   chan struct{}
+	once   sync.Once
+	sync.Mutex
+}
+
+func (s *refreshTokenStore) Save(t *refresh.Token) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.tokens[t.ID] = *t
+	return nil
+}
+
+func (s *refreshTokenStore) Use(id string) (*refresh.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, refresh.ErrTokenInvalid
+	}
+
+	used := t
+	used.Used = true
+	s.tokens[id] = used
+
+	return &t, nil
+}
+
+func (s *refreshTokenStore) Find(id string) (*refresh.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, refresh.ErrTokenInvalid
+	}
+
+	return &t, nil
+}
+
+func (s *refreshTokenStore) RevokeFamily(family string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, t := range s.tokens {
+		if t.Family == family {
+			t.Revoked = true
+			s.tokens[id] = t
+		}
+	}
+
+	return nil
+}
+
+func (s *refreshTokenStore) RevokeSubject(subject string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, t := range s.tokens {
+		if t.Subject == subject {
+			t.Revoked = true
+			s.tokens[id] = t
+		}
+	}
+
+	return nil
+}
+
+func (s *refreshTokenStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *refreshTokenStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *refreshTokenStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for id, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+}
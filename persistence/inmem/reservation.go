@@ -0,0 +1,86 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/user"
+)
+
+func NewReservationStore() (user.ReservationStore, error) {
+	store := &reservationStore{
+		reservations: make(map[string]user.Reservation),
+		done:         make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type reservationStore struct {
+	reservations map[string]user.Reservation // map[Username]user.Reservation
+	done         chan struct{}
+	once         sync.Once
+	sync.RWMutex
+}
+
+func (s *reservationStore) Reserve(r *user.Reservation) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.reservations[r.Username] = *r
+	return nil
+}
+
+func (s *reservationStore) Release(username string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.reservations, username)
+	return nil
+}
+
+func (s *reservationStore) Find(username string) (*user.Reservation, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	r, ok := s.reservations[username]
+	if !ok || time.Now().After(r.ExpiresAt) {
+		return nil, user.ErrReservationNotFound
+	}
+
+	return &r, nil
+}
+
+func (s *reservationStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *reservationStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *reservationStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for username, r := range s.reservations {
+		if now.After(r.ExpiresAt) {
+			delete(s.reservations, username)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/revocation"
+)
+
+func NewRevocationStore() (revocation.Store, error) {
+	store := &revocationStore{
+		tokens:   make(map[string]time.Time),
+		subjects: make(map[string]revocation.Revocation),
+		done:     make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type revocationStore struct {
+	tokens   map[string]time.Time             // jti -> expiresAt
+	subjects map[string]revocation.Revocation // latest revoke-all per subject
+	done     chan struct{}
+	once     sync.Once
+	sync.RWMutex
+}
+
+func (s *revocationStore) Add(r *revocation.Revocation) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.ID != "" {
+		s.tokens[r.ID] = r.ExpiresAt
+		return nil
+	}
+
+	if prev, ok := s.subjects[r.Subject]; ok && prev.IssuedBefore.After(r.IssuedBefore) {
+		return nil
+	}
+
+	s.subjects[r.Subject] = *r
+	return nil
+}
+
+func (s *revocationStore) Revoked(id string, subject string, issuedAt time.Time) (bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, ok := s.tokens[id]; ok {
+		return true, nil
+	}
+
+	r, ok := s.subjects[subject]
+	if !ok {
+		return false, nil
+	}
+
+	// iat only has second precision, so a token from the same second as
+	// the revocation is treated as issued before it.
+	return !issuedAt.After(r.IssuedBefore.Truncate(time.Second)), nil
+}
+
+func (s *revocationStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *revocationStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *revocationStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for id, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+
+	for subject, r := range s.subjects {
+		if now.After(r.ExpiresAt) {
+			delete(s.subjects, subject)
+		}
+	}
+}
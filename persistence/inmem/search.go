@@ -0,0 +1,145 @@
+package inmem
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/flarexio/identity/user"
+)
+
+// NewSearchIndex keeps an inverted index in memory. It starts empty; the
+// caller fills it from the repository.
+func NewSearchIndex() (user.SearchIndex, error) {
+	index := new(searchIndex)
+	index.postings = make(map[string]map[user.UserID]struct{})
+	index.docs = make(map[user.UserID][]string)
+	return index, nil
+}
+
+type searchIndex struct {
+	terms    []string                            // sorted, for prefix lookups
+	postings map[string]map[user.UserID]struct{} // map[Term]Users
+	docs     map[user.UserID][]string            // map[UserID]Terms, to unindex
+	sync.RWMutex
+}
+
+func (index *searchIndex) Index(u *user.User) error {
+	index.Lock()
+	defer index.Unlock()
+
+	index.remove(u.ID)
+
+	terms := user.SearchTerms(u)
+	for _, term := range terms {
+		users, ok := index.postings[term]
+		if !ok {
+			users = make(map[user.UserID]struct{})
+			index.postings[term] = users
+
+			i, _ := slices.BinarySearch(index.terms, term)
+			index.terms = slices.Insert(index.terms, i, term)
+		}
+
+		users[u.ID] = struct{}{}
+	}
+
+	index.docs[u.ID] = terms
+
+	return nil
+}
+
+func (index *searchIndex) Remove(id user.UserID) error {
+	index.Lock()
+	defer index.Unlock()
+
+	index.remove(id)
+	return nil
+}
+
+func (index *searchIndex) remove(id user.UserID) {
+	for _, term := range index.docs[id] {
+		users := index.postings[term]
+		delete(users, id)
+
+		if len(users) > 0 {
+			continue
+		}
+
+		delete(index.postings, term)
+
+		if i, ok := slices.BinarySearch(index.terms, term); ok {
+			index.terms = slices.Delete(index.terms, i, i+1)
+		}
+	}
+
+	delete(index.docs, id)
+}
+
+// Search scores a whole-word match above a prefix match.
+func (index *searchIndex) Search(query string, limit int) ([]user.UserID, error) {
+	tokens := user.Tokenize(query)
+	if len(tokens) == 0 {
+		return nil, user.ErrSearchQueryEmpty
+	}
+
+	index.RLock()
+	defer index.RUnlock()
+
+	var scores map[user.UserID]int
+	for _, token := range tokens {
+		matched := make(map[user.UserID]int)
+
+		i, _ := slices.BinarySearch(index.terms, token)
+		for ; i < len(index.terms) && strings.HasPrefix(index.terms[i], token); i++ {
+			term := index.terms[i]
+
+			score := 1
+			if term == token {
+				score = 2
+			}
+
+			for id := range index.postings[term] {
+				matched[id] = max(matched[id], score)
+			}
+		}
+
+		// Every token has to match.
+		if scores == nil {
+			scores = matched
+			continue
+		}
+
+		for id, score := range scores {
+			if s, ok := matched[id]; ok {
+				scores[id] = score + s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	ids := make([]user.UserID, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+
+		return ids[i].Compare(ids[j]) < 0
+	})
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	return ids, nil
+}
+
+func (index *searchIndex) Close() error {
+	return nil
+}
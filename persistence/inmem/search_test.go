@@ -0,0 +1,89 @@
+package inmem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/flarexio/identity/user"
+)
+
+type searchIndexTestSuite struct {
+	suite.Suite
+	index user.SearchIndex
+	user  *user.User
+}
+
+func (suite *searchIndexTestSuite) SetupTest() {
+	index, err := NewSearchIndex()
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	// 建立測試用戶
+	u := user.NewUser("mirror770109", "Lin, Ying-Chin", "mirror770109@gmail.com")
+	u.AddSocialAccount(user.GOOGLE, "100043685676652067799")
+	index.Index(u)
+
+	suite.index = index
+	suite.user = u
+}
+
+func (suite *searchIndexTestSuite) TestSearch() {
+	for _, query := range []string{"ying", "Lin", "mirror77", "gmail.com", "1000436856"} {
+		ids, err := suite.index.Search(query, 10)
+		suite.NoError(err)
+		suite.Equal([]user.UserID{suite.user.ID}, ids, query)
+	}
+
+	// 每個詞都須符合
+	ids, err := suite.index.Search("lin yahoo", 10)
+	suite.NoError(err)
+	suite.Empty(ids)
+
+	_, err = suite.index.Search(" , ", 10)
+	suite.ErrorIs(err, user.ErrSearchQueryEmpty)
+}
+
+func (suite *searchIndexTestSuite) TestRanking() {
+	u := user.NewUser("linus", "Linus", "linus@example.com")
+	suite.index.Index(u)
+
+	// 完整字詞優先於前綴
+	ids, err := suite.index.Search("lin", 10)
+	suite.NoError(err)
+	suite.Equal([]user.UserID{suite.user.ID, u.ID}, ids)
+
+	ids, err = suite.index.Search("lin", 1)
+	suite.NoError(err)
+	suite.Equal([]user.UserID{suite.user.ID}, ids)
+}
+
+func (suite *searchIndexTestSuite) TestReindex() {
+	u := *suite.user
+	u.Name = "Mirror Lin"
+	suite.index.Index(&u)
+
+	// 舊名稱不再可搜尋
+	ids, err := suite.index.Search("ying", 10)
+	suite.NoError(err)
+	suite.Empty(ids)
+
+	ids, err = suite.index.Search("mirror lin", 10)
+	suite.NoError(err)
+	suite.Equal([]user.UserID{u.ID}, ids)
+}
+
+func (suite *searchIndexTestSuite) TestRemove() {
+	err := suite.index.Remove(suite.user.ID)
+	suite.NoError(err)
+
+	ids, err := suite.index.Search("mirror", 10)
+	suite.NoError(err)
+	suite.Empty(ids)
+}
+
+func TestSearchIndexTestSuite(t *testing.T) {
+	suite.Run(t, new(searchIndexTestSuite))
+}
@@ -0,0 +1,93 @@
+package inmem
+
+import (
+	"sync"
+	"time"
+
+	"github.com/flarexio/identity/ticket"
+)
+
+func NewTicketStore() (ticket.Store, error) {
+	store := &ticketStore{
+		tickets: make(map[string]pendingTicket),
+		done:    make(chan struct{}),
+	}
+
+	go store.janitor(time.Minute)
+
+	return store, nil
+}
+
+type pendingTicket struct {
+	subject   string
+	expiresAt time.Time
+}
+
+type ticketStore struct {
+	tickets map[string]pendingTicket
+	done    chan struct{}
+	once    sync.Once
+	sync.Mutex
+}
+
+func (s *ticketStore) Save(t, subject string, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.tickets[t] = pendingTicket{
+		subject:   subject,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *ticketStore) Consume(t string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, ok := s.tickets[t]
+	if !ok {
+		return "", ticket.ErrTicketInvalid
+	}
+
+	// One-time: delete on first read (lock makes lookup+delete atomic).
+	delete(s.tickets, t)
+
+	if time.Now().After(c.expiresAt) {
+		return "", ticket.ErrTicketInvalid
+	}
+
+	return c.subject, nil
+}
+
+func (s *ticketStore) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *ticketStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.purgeExpired()
+		}
+	}
+}
+
+func (s *ticketStore) purgeExpired() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for t, c := range s.tickets {
+		if now.After(c.expiresAt) {
+			delete(s.tickets, t)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package inmem
 
 import (
+	"slices"
 	"sync"
 
 	"github.com/flarexio/core/events"
@@ -11,34 +12,82 @@ func NewUserRepository() (user.Repository, error) {
 	repo := new(userRepository)
 	repo.users = make(map[user.UserID]*user.User)
 	repo.usernames = make(map[string]*user.User)
-	repo.socials = make(map[user.SocialID]*user.User)
+	repo.socials = make(map[socialKey]*user.User)
 	return repo, nil
 }
 
+// socialKey scopes a social ID to its provider; two providers may well
+// hand out the same subject.
+type socialKey struct {
+	Provider user.SocialProvider
+	SocialID user.SocialID
+}
+
 type userRepository struct {
-	users     map[user.UserID]*user.User   // map[UserID]*user.User
-	usernames map[string]*user.User        // map[Username]*user.User
-	socials   map[user.SocialID]*user.User // map[SocialID]*user.User
+	users     map[user.UserID]*user.User // map[UserID]*user.User
+	usernames map[string]*user.User      // map[Username]*user.User
+	socials   map[socialKey]*user.User   // map[Provider, SocialID]*user.User
 	sync.RWMutex
 }
 
+// clone hands out a copy, so changes reach the repository through Store
+// only, checked against the stored version.
+func clone(u *user.User) *user.User {
+	c := *u
+	c.Accounts = slices.Clone(u.Accounts)
+
+	if u.TOTP != nil {
+		t := *u.TOTP
+		c.TOTP = &t
+	}
+
+	c.EventStore = events.NewEventStore()
+	return &c
+}
+
 func (repo *userRepository) Store(u *user.User) error {
 	repo.Lock()
+	defer repo.Unlock()
 
-	newUser := new(user.User)
-	*newUser = *u
+	// A user not stored yet is at version 0.
+	old, ok := repo.users[u.ID]
+	if (ok && old.Version != u.Version) || (!ok && u.Version != 0) {
+		return user.ErrConcurrentModification
+	}
 
-	u = newUser
-	u.EventStore = nil
+	if owner, ok := repo.usernames[u.Username]; ok && owner.ID != u.ID {
+		return user.ErrUserExists
+	}
 
-	repo.users[u.ID] = u
-	repo.usernames[u.Username] = u
+	for _, account := range u.Accounts {
+		key := socialKey{account.Provider, account.SocialID}
+		if owner, ok := repo.socials[key]; ok && owner.ID != u.ID {
+			return user.ErrSocialAccountExists
+		}
+	}
+
+	stored := clone(u)
+	stored.Version++
+	stored.EventStore = nil
+
+	// Drop what the previous version was indexed by: a former username,
+	// removed accounts.
+	if ok {
+		delete(repo.usernames, old.Username)
+
+		for _, account := range old.Accounts {
+			delete(repo.socials, socialKey{account.Provider, account.SocialID})
+		}
+	}
+
+	repo.users[u.ID] = stored
+	repo.usernames[u.Username] = stored
 
 	for _, account := range u.Accounts {
-		repo.socials[account.SocialID] = u
+		repo.socials[socialKey{account.Provider, account.SocialID}] = stored
 	}
 
-	repo.Unlock()
+	u.Version = stored.Version
 	return nil
 }
 
@@ -46,11 +95,16 @@ func (repo *userRepository) Delete(u *user.User) error {
 	repo.Lock()
 	defer repo.Unlock()
 
+	old, ok := repo.users[u.ID]
+	if !ok || old.Version != u.Version {
+		return user.ErrConcurrentModification
+	}
+
 	delete(repo.users, u.ID)
 	delete(repo.usernames, u.Username)
 
 	for _, account := range u.Accounts {
-		delete(repo.socials, account.SocialID)
+		delete(repo.socials, socialKey{account.Provider, account.SocialID})
 	}
 
 	return nil
@@ -62,13 +116,46 @@ func (repo *userRepository) ListAll() ([]*user.User, error) {
 
 	users := make([]*user.User, 0)
 	for _, u := range repo.users {
-		u.EventStore = events.NewEventStore()
-		users = append(users, u)
+		users = append(users, clone(u))
 	}
 
 	return users, nil
 }
 
+func (repo *userRepository) Query(q *user.Query) (*user.Page, error) {
+	cursor, err := q.CursorID()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.RLock()
+	defer repo.RUnlock()
+
+	users := make([]*user.User, 0)
+	for _, u := range repo.users {
+		if !q.Follows(u.ID, cursor) || !q.Match(u) {
+			continue
+		}
+
+		users = append(users, clone(u))
+	}
+
+	slices.SortFunc(users, func(a, b *user.User) int {
+		if q.Sort == user.SortNewest {
+			return b.ID.Compare(a.ID)
+		}
+
+		return a.ID.Compare(b.ID)
+	})
+
+	size := q.Size()
+	if len(users) > size+1 {
+		users = users[:size+1]
+	}
+
+	return user.NewPage(users, size), nil
+}
+
 func (repo *userRepository) Find(id user.UserID) (*user.User, error) {
 	repo.RLock()
 	defer repo.RUnlock()
@@ -78,8 +165,7 @@ func (repo *userRepository) Find(id user.UserID) (*user.User, error) {
 		return nil, user.ErrUserNotFound
 	}
 
-	u.EventStore = events.NewEventStore()
-	return u, nil
+	return clone(u), nil
 }
 
 func (repo *userRepository) FindByUsername(username string) (*user.User, error) {
@@ -91,21 +177,35 @@ func (repo *userRepository) FindByUsername(username string) (*user.User, error)
 		return nil, user.ErrUserNotFound
 	}
 
-	u.EventStore = events.NewEventStore()
-	return u, nil
+	return clone(u), nil
 }
 
-func (repo *userRepository) FindBySocialID(socialID user.SocialID) (*user.User, error) {
+func (repo *userRepository) FindBySocialAccount(provider user.SocialProvider, socialID user.SocialID) (*user.User, error) {
 	repo.RLock()
 	defer repo.RUnlock()
 
-	u, ok := repo.socials[socialID]
+	u, ok := repo.socials[socialKey{provider, socialID}]
 	if !ok {
 		return nil, user.ErrUserNotFound
 	}
 
-	u.EventStore = events.NewEventStore()
-	return u, nil
+	return clone(u), nil
+}
+
+func (repo *userRepository) FindByEmail(email string) ([]*user.User, error) {
+	repo.RLock()
+	defer repo.RUnlock()
+
+	users := make([]*user.User, 0)
+	for _, u := range repo.users {
+		if u.Email != email {
+			continue
+		}
+
+		users = append(users, clone(u))
+	}
+
+	return users, nil
 }
 
 func (repo *userRepository) Close() error {
@@ -118,6 +218,6 @@ func (repo *userRepository) Truncate() error {
 
 	repo.users = make(map[user.UserID]*user.User)
 	repo.usernames = make(map[string]*user.User)
-	repo.socials = make(map[user.SocialID]*user.User)
+	repo.socials = make(map[socialKey]*user.User)
 	return nil
 }
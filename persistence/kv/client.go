@@ -0,0 +1,104 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+)
+
+const clientPrefix = "client:"
+
+func NewClientRepository(cfg conf.Persistence) (client.Repository, error) {
+	opts := badger.DefaultOptions(cfg.Host + "/" + cfg.Name + "_clients")
+	if cfg.InMem {
+		opts = badger.DefaultOptions("").WithInMemory(true)
+	}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientRepository{db}, nil
+}
+
+type clientRepository struct {
+	db *badger.DB
+}
+
+func (repo *clientRepository) Store(c *client.Client) error {
+	bs, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(clientPrefix+c.ID), bs)
+	})
+}
+
+func (repo *clientRepository) Delete(id string) error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(clientPrefix + id))
+	})
+}
+
+func (repo *clientRepository) Find(id string) (*client.Client, error) {
+	var c *client.Client
+	err := repo.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(clientPrefix + id))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return client.ErrClientNotFound
+			}
+
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &c)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (repo *clientRepository) List() ([]*client.Client, error) {
+	clients := make([]*client.Client, 0)
+	err := repo.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(clientPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var c *client.Client
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &c)
+			}); err != nil {
+				return err
+			}
+
+			clients = append(clients, c)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (repo *clientRepository) Close() error {
+	return repo.db.Close()
+}
@@ -0,0 +1,176 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/refresh"
+)
+
+const refreshTokenPrefix = "refresh:"
+
+func NewRefreshTokenStore(cfg conf.Persistence) (refresh.Store, error) {
+	opts := badger.DefaultOptions(cfg.Host + "/" + cfg.Name + "_tokens")
+	if cfg.InMem {
+		opts = badger.DefaultOptions("").WithInMemory(true)
+	}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &refreshTokenStore{db}, nil
+}
+
+type refreshTokenStore struct {
+	db *badger.DB
+}
+
+func (s *refreshTokenStore) Save(t *refresh.Token) error {
+	bs, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(t.ExpiresAt)
+	if ttl <= 0 {
+		return refresh.ErrTokenInvalid
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry([]byte(refreshTokenPrefix+t.ID), bs).WithTTL(ttl)
+		return txn.SetEntry(e)
+	})
+}
+
+func (s *refreshTokenStore) Use(id string) (*refresh.Token, error) {
+	var t *refresh.Token
+	err := s.db.Update(func(txn *badger.Txn) error {
+		key := []byte(refreshTokenPrefix + id)
+
+		item, err := txn.Get(key)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return refresh.ErrTokenInvalid
+			}
+
+			return err
+		}
+
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &t)
+		}); err != nil {
+			return err
+		}
+
+		if t.Used {
+			return nil
+		}
+
+		used := *t
+		used.Used = true
+
+		bs, err := json.Marshal(&used)
+		if err != nil {
+			return err
+		}
+
+		e := badger.NewEntry(key, bs).WithTTL(time.Until(t.ExpiresAt))
+		return txn.SetEntry(e)
+	})
+
+	// Losing a conflict means another request used the token first.
+	if errors.Is(err, badger.ErrConflict) && t != nil {
+		t.Used = true
+		return t, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (s *refreshTokenStore) Find(id string) (*refresh.Token, error) {
+	var t *refresh.Token
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(refreshTokenPrefix + id))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return refresh.ErrTokenInvalid
+			}
+
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &t)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (s *refreshTokenStore) RevokeFamily(family string) error {
+	return s.revoke(func(t *refresh.Token) bool {
+		return t.Family == family
+	})
+}
+
+func (s *refreshTokenStore) RevokeSubject(subject string) error {
+	return s.revoke(func(t *refresh.Token) bool {
+		return t.Subject == subject
+	})
+}
+
+// revoke scans every live token; revocations are rare enough for that to do.
+func (s *refreshTokenStore) revoke(match func(t *refresh.Token) bool) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(refreshTokenPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			var t *refresh.Token
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &t)
+			}); err != nil {
+				return err
+			}
+
+			if t.Revoked || !match(t) {
+				continue
+			}
+
+			t.Revoked = true
+
+			bs, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+
+			e := badger.NewEntry(item.KeyCopy(nil), bs).WithTTL(time.Until(t.ExpiresAt))
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *refreshTokenStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,84 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+const reservationPrefix = "reservation:"
+
+func NewReservationStore(cfg conf.Persistence) (user.ReservationStore, error) {
+	opts := badger.DefaultOptions(cfg.Host + "/" + cfg.Name + "_reservations")
+	if cfg.InMem {
+		opts = badger.DefaultOptions("").WithInMemory(true)
+	}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservationStore{db}, nil
+}
+
+type reservationStore struct {
+	db *badger.DB
+}
+
+func (s *reservationStore) Reserve(r *user.Reservation) error {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	// Already expired, e.g. a renaming replayed long after the fact.
+	ttl := time.Until(r.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry([]byte(reservationPrefix+r.Username), bs).WithTTL(ttl)
+		return txn.SetEntry(e)
+	})
+}
+
+func (s *reservationStore) Release(username string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(reservationPrefix + username))
+	})
+}
+
+func (s *reservationStore) Find(username string) (*user.Reservation, error) {
+	var r *user.Reservation
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(reservationPrefix + username))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return user.ErrReservationNotFound
+			}
+
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &r)
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *reservationStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,71 @@
+package kv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+type reservationStoreTestSuite struct {
+	suite.Suite
+	reservations user.ReservationStore
+}
+
+func (suite *reservationStoreTestSuite) SetupSuite() {
+	cfg := conf.Persistence{
+		Driver: conf.BadgerDB,
+		Name:   "identity",
+		InMem:  true,
+	}
+
+	reservations, err := NewReservationStore(cfg)
+	if err != nil {
+		suite.Fail(err.Error())
+		return
+	}
+
+	suite.reservations = reservations
+}
+
+func (suite *reservationStoreTestSuite) TestReserve() {
+	id := user.MakeID()
+
+	err := suite.reservations.Reserve(&user.Reservation{
+		Username:  "mirror770109",
+		UserID:    id,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	suite.NoError(err)
+
+	r, err := suite.reservations.Find("mirror770109")
+	suite.NoError(err)
+	suite.Equal(id, r.UserID)
+
+	// 釋放後即可使用
+	suite.NoError(suite.reservations.Release("mirror770109"))
+
+	_, err = suite.reservations.Find("mirror770109")
+	suite.ErrorIs(err, user.ErrReservationNotFound)
+
+	// 過期的保留不會回傳
+	suite.reservations.Reserve(&user.Reservation{
+		Username:  "expired",
+		UserID:    id,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+
+	_, err = suite.reservations.Find("expired")
+	suite.ErrorIs(err, user.ErrReservationNotFound)
+}
+
+func (suite *reservationStoreTestSuite) TearDownSuite() {
+	suite.reservations.Close()
+}
+
+func TestReservationStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(reservationStoreTestSuite))
+}
@@ -0,0 +1,128 @@
+package kv
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/revocation"
+)
+
+const (
+	revokedTokenPrefix   = "revoked:jti:"
+	revokedSubjectPrefix = "revoked:sub:"
+)
+
+func NewRevocationStore(cfg conf.Persistence) (revocation.Store, error) {
+	opts := badger.DefaultOptions(cfg.Host + "/" + cfg.Name + "_revocations")
+	if cfg.InMem {
+		opts = badger.DefaultOptions("").WithInMemory(true)
+	}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revocationStore{db}, nil
+}
+
+type revocationStore struct {
+	db *badger.DB
+}
+
+// Add expires its keys with the revocation, so badger drops them itself.
+func (s *revocationStore) Add(r *revocation.Revocation) error {
+	ttl := time.Until(r.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if r.ID != "" {
+		return s.db.Update(func(txn *badger.Txn) error {
+			e := badger.NewEntry([]byte(revokedTokenPrefix+r.ID), nil).WithTTL(ttl)
+			return txn.SetEntry(e)
+		})
+	}
+
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Update(func(txn *badger.Txn) error {
+		prev, err := getRevocation(txn, r.Subject)
+		if err != nil {
+			return err
+		}
+
+		// Only ever move a revoke-all forward.
+		if prev != nil && prev.IssuedBefore.After(r.IssuedBefore) {
+			return nil
+		}
+
+		e := badger.NewEntry([]byte(revokedSubjectPrefix+r.Subject), bs).WithTTL(ttl)
+		return txn.SetEntry(e)
+	})
+
+	// Another revoke-all of the subject got in first; weigh against it.
+	if errors.Is(err, badger.ErrConflict) {
+		return s.Add(r)
+	}
+
+	return err
+}
+
+func (s *revocationStore) Revoked(id string, subject string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(revokedTokenPrefix + id))
+		switch {
+		case err == nil:
+			revoked = true
+			return nil
+
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return err
+		}
+
+		r, err := getRevocation(txn, subject)
+		if err != nil || r == nil {
+			return err
+		}
+
+		// iat only has second precision, so a token from the same second
+		// as the revocation is treated as issued before it.
+		revoked = !issuedAt.After(r.IssuedBefore.Truncate(time.Second))
+		return nil
+	})
+
+	return revoked, err
+}
+
+func getRevocation(txn *badger.Txn, subject string) (*revocation.Revocation, error) {
+	item, err := txn.Get([]byte(revokedSubjectPrefix + subject))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var r *revocation.Revocation
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &r)
+	}); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *revocationStore) Close() error {
+	return s.db.Close()
+}
@@ -1,6 +1,7 @@
 package kv
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 
@@ -25,38 +26,260 @@ func NewUserRepository(cfg conf.Persistence) (user.Repository, error) {
 	repo := new(userRepository)
 	repo.db = db
 
+	if err := repo.migrateSocialKeys(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := repo.migrateUserKeys(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return repo, nil
 }
 
+func socialKey(provider user.SocialProvider, socialID user.SocialID) []byte {
+	return []byte("social:" + string(provider) + ":" + string(socialID))
+}
+
+func usernameKey(username string) []byte {
+	return []byte("username:" + username)
+}
+
+// userKey orders users by ID under a prefix of their own, for queries to
+// iterate. It is the one key a user is kept under; the username: and social:
+// keys hold the ID.
+func userKey(id user.UserID) []byte {
+	return append([]byte("user:"), id.Bytes()...)
+}
+
+// isID tells an index value from a user, which earlier versions copied
+// under every key.
+func isID(val []byte) bool {
+	return len(val) == len(user.UserID{})
+}
+
+// migrateSocialKeys rewrites the social:<id> keys of earlier versions as
+// social:<provider>:<id>. Keys already in the new form are left alone, so
+// it is safe on every start.
+func (repo *userRepository) migrateSocialKeys() error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		var legacy [][]byte
+		values := make(map[string][]byte)
+
+		if err := func() error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+
+			prefix := []byte("social:")
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				item := it.Item()
+				key := string(item.Key())
+
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+
+				// Only keys of the current form hold an ID.
+				if isID(val) {
+					continue
+				}
+
+				u, err := decodeUser(val)
+				if err != nil {
+					return err
+				}
+
+				var matched []*user.SocialAccount
+				current := false
+				for _, account := range u.Accounts {
+					switch key {
+					case string(socialKey(account.Provider, account.SocialID)):
+						current = true
+					case "social:" + string(account.SocialID):
+						matched = append(matched, account)
+					}
+				}
+
+				if current {
+					continue
+				}
+
+				legacy = append(legacy, []byte(key))
+				for _, account := range matched {
+					values[string(socialKey(account.Provider, account.SocialID))] = val
+				}
+			}
+
+			return nil
+		}(); err != nil {
+			return err
+		}
+
+		for _, key := range legacy {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		for key, val := range values {
+			if err := txn.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// migrateUserKeys keeps users of earlier versions once, under user:<id>.
+// Those copied the user under its bare ID, its username: and social: keys,
+// and later user:<id> too; the copies are written as ID, or dropped. Keys
+// already holding an ID are left alone, so it is safe on every start.
+func (repo *userRepository) migrateUserKeys() error {
+	return repo.db.Update(func(txn *badger.Txn) error {
+		users := make(map[user.UserID][]byte)
+		copies := make(map[string]user.UserID)
+
+		if err := func() error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+
+			for _, prefix := range [][]byte{[]byte("username:"), []byte("social:")} {
+				for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+					item := it.Item()
+
+					val, err := item.ValueCopy(nil)
+					if err != nil {
+						return err
+					}
+
+					if isID(val) {
+						continue
+					}
+
+					u, err := decodeUser(val)
+					if err != nil {
+						return err
+					}
+
+					users[u.ID] = val
+					copies[string(item.KeyCopy(nil))] = u.ID
+				}
+			}
+
+			return nil
+		}(); err != nil {
+			return err
+		}
+
+		for id, val := range users {
+			// Written alongside the copies, user:<id> is as recent.
+			_, err := txn.Get(userKey(id))
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				err = txn.Set(userKey(id), val)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := txn.Delete(id.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		for key, id := range copies {
+			if err := txn.Set([]byte(key), id.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 type userRepository struct {
 	db *badger.DB
 }
 
 func (repo *userRepository) Store(u *user.User) error {
-	newUser := new(user.User)
-	*newUser = *u
+	stored := new(user.User)
+	*stored = *u
 
-	u = newUser
-	u.EventStore = nil
+	stored.Version++
+	stored.EventStore = nil
 
-	bs, err := json.Marshal(u)
+	bs, err := encodeUser(stored)
 	if err != nil {
 		return err
 	}
 
-	return repo.db.Update(func(txn *badger.Txn) error {
-		err := txn.Set(u.ID.Bytes(), bs)
+	err = repo.db.Update(func(txn *badger.Txn) error {
+		// Reading the user also makes badger fail the transaction when
+		// another one writes it first.
+		old, err := getUser(txn, userKey(u.ID))
+		if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+
+		// A user not stored yet is at version 0.
+		if (old != nil && old.Version != u.Version) || (old == nil && u.Version != 0) {
+			return user.ErrConcurrentModification
+		}
+
+		owner, err := getID(txn, usernameKey(u.Username))
+		if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+
+		if err == nil && owner != u.ID {
+			return user.ErrUserExists
+		}
+
+		for _, account := range u.Accounts {
+			owner, err := getID(txn, socialKey(account.Provider, account.SocialID))
+			if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+				return err
+			}
+
+			if err == nil && owner != u.ID {
+				return user.ErrSocialAccountExists
+			}
+		}
+
+		// Drop what the previous version was indexed by: a former
+		// username, removed accounts.
+		if old != nil {
+			if old.Username != u.Username {
+				err := txn.Delete(usernameKey(old.Username))
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, account := range old.Accounts {
+				err := txn.Delete(socialKey(account.Provider, account.SocialID))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = txn.Set(userKey(u.ID), bs)
 		if err != nil {
 			return err
 		}
 
-		err = txn.Set([]byte("username:"+u.Username), bs)
+		err = txn.Set(usernameKey(u.Username), u.ID.Bytes())
 		if err != nil {
 			return err
 		}
 
 		for _, account := range u.Accounts {
-			err := txn.Set([]byte("social:"+account.SocialID), bs)
+			err := txn.Set(socialKey(account.Provider, account.SocialID), u.ID.Bytes())
 			if err != nil {
 				return err
 			}
@@ -64,22 +287,42 @@ func (repo *userRepository) Store(u *user.User) error {
 
 		return nil
 	})
+
+	if errors.Is(err, badger.ErrConflict) {
+		return user.ErrConcurrentModification
+	}
+
+	if err != nil {
+		return err
+	}
+
+	u.Version = stored.Version
+	return nil
 }
 
 func (repo *userRepository) Delete(u *user.User) error {
-	return repo.db.Update(func(txn *badger.Txn) error {
-		err := txn.Delete(u.ID.Bytes())
+	err := repo.db.Update(func(txn *badger.Txn) error {
+		old, err := getUser(txn, userKey(u.ID))
+		if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+			return err
+		}
+
+		if old == nil || old.Version != u.Version {
+			return user.ErrConcurrentModification
+		}
+
+		err = txn.Delete(userKey(u.ID))
 		if err != nil {
 			return err
 		}
 
-		err = txn.Delete([]byte("username:" + u.Username))
+		err = txn.Delete(usernameKey(u.Username))
 		if err != nil {
 			return err
 		}
 
 		for _, account := range u.Accounts {
-			err := txn.Delete([]byte("social:" + account.SocialID))
+			err := txn.Delete(socialKey(account.Provider, account.SocialID))
 			if err != nil {
 				return err
 			}
@@ -87,6 +330,12 @@ func (repo *userRepository) Delete(u *user.User) error {
 
 		return nil
 	})
+
+	if errors.Is(err, badger.ErrConflict) {
+		return user.ErrConcurrentModification
+	}
+
+	return err
 }
 
 func (repo *userRepository) ListAll() ([]*user.User, error) {
@@ -96,12 +345,12 @@ func (repo *userRepository) ListAll() ([]*user.User, error) {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 
-		prefix := []byte("username:")
+		prefix := []byte("user:")
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 			item := it.Item()
 			err := item.Value(func(val []byte) error {
-				var u *user.User
-				if err := json.Unmarshal(val, &u); err != nil {
+				u, err := decodeUser(val)
+				if err != nil {
 					return err
 				}
 
@@ -123,47 +372,213 @@ func (repo *userRepository) ListAll() ([]*user.User, error) {
 	return users, nil
 }
 
+// Query walks the user:<id> keys from the cursor on, so a page costs as
+// many reads as the users it skips for the filters.
+func (repo *userRepository) Query(q *user.Query) (*user.Page, error) {
+	cursor, err := q.CursorID()
+	if err != nil {
+		return nil, err
+	}
+
+	size := q.Size()
+	users := make([]*user.User, 0)
+
+	if err := repo.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = q.Sort == user.SortNewest
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte("user:")
+
+		start := prefix
+		switch {
+		case cursor != nil:
+			start = userKey(*cursor)
+		case opts.Reverse:
+			// Past the last key, as reverse iteration seeks backwards.
+			start = append(prefix, bytes.Repeat([]byte{0xFF}, len(user.UserID{})+1)...)
+		}
+
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			if cursor != nil && bytes.Equal(it.Item().Key(), start) {
+				continue
+			}
+
+			var u *user.User
+			if err := it.Item().Value(func(val []byte) (err error) {
+				u, err = decodeUser(val)
+				return err
+			}); err != nil {
+				return err
+			}
+
+			if !q.Match(u) {
+				continue
+			}
+
+			u.EventStore = events.NewEventStore()
+			users = append(users, u)
+
+			if len(users) > size {
+				break
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return user.NewPage(users, size), nil
+}
+
 func (repo *userRepository) Find(id user.UserID) (*user.User, error) {
-	return repo.find(id.Bytes())
+	return repo.find(func(txn *badger.Txn) (*user.User, error) {
+		return getUser(txn, userKey(id))
+	})
 }
 
 func (repo *userRepository) FindByUsername(username string) (*user.User, error) {
-	return repo.find([]byte("username:" + username))
+	return repo.find(func(txn *badger.Txn) (*user.User, error) {
+		return getIndexed(txn, usernameKey(username))
+	})
+}
+
+func (repo *userRepository) FindBySocialAccount(provider user.SocialProvider, socialID user.SocialID) (*user.User, error) {
+	return repo.find(func(txn *badger.Txn) (*user.User, error) {
+		return getIndexed(txn, socialKey(provider, socialID))
+	})
 }
 
-func (repo *userRepository) FindBySocialID(socialID user.SocialID) (*user.User, error) {
-	return repo.find([]byte("social:" + socialID))
+// FindByEmail has no index to go by; it only runs for sign-ins of social
+// accounts not seen before.
+func (repo *userRepository) FindByEmail(email string) ([]*user.User, error) {
+	all, err := repo.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*user.User, 0)
+	for _, u := range all {
+		if u.Email == email {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
 }
 
-func (repo *userRepository) find(key []byte) (*user.User, error) {
+func (repo *userRepository) find(get func(txn *badger.Txn) (*user.User, error)) (*user.User, error) {
 	var u *user.User
 
 	if err := repo.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
+		found, err := get(txn)
 		if err != nil {
-			if errors.Is(err, badger.ErrKeyNotFound) {
-				return user.ErrUserNotFound
-			}
-
 			return err
 		}
 
-		return item.Value(func(val []byte) error {
-			err := json.Unmarshal(val, &u)
-			if err != nil {
-				return err
-			}
+		u = found
+		return nil
+	}); err != nil {
+		return nil, err
+	}
 
-			u.EventStore = events.NewEventStore()
-			return nil
-		})
+	return u, nil
+}
+
+func getUser(txn *badger.Txn, key []byte) (*user.User, error) {
+	item, err := txn.Get(key)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, user.ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	var u *user.User
+	if err := item.Value(func(val []byte) (err error) {
+		u, err = decodeUser(val)
+		return err
 	}); err != nil {
 		return nil, err
 	}
 
+	u.EventStore = events.NewEventStore()
 	return u, nil
 }
 
+// getID reads the ID a username: or social: key holds.
+func getID(txn *badger.Txn, key []byte) (user.UserID, error) {
+	var id user.UserID
+
+	item, err := txn.Get(key)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return id, user.ErrUserNotFound
+		}
+
+		return id, err
+	}
+
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return id, err
+	}
+
+	if !isID(val) {
+		return id, errors.New("invalid index value")
+	}
+
+	copy(id[:], val)
+	return id, nil
+}
+
+// getIndexed reads the user a username: or social: key holds the ID of.
+func getIndexed(txn *badger.Txn, key []byte) (*user.User, error) {
+	id, err := getID(txn, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return getUser(txn, userKey(id))
+}
+
+// record is how a user is kept. The user's own JSON is what the API hands
+// out and leaves the TOTP secret and recovery codes out, so they are kept
+// beside it.
+type record struct {
+	*user.User
+	TOTPSecret        string   `json:"totp_secret,omitempty"`
+	TOTPRecoveryCodes []string `json:"totp_recovery_codes,omitempty"`
+}
+
+func encodeUser(u *user.User) ([]byte, error) {
+	r := record{User: u}
+	if u.TOTP != nil {
+		r.TOTPSecret = u.TOTP.Secret
+		r.TOTPRecoveryCodes = u.TOTP.RecoveryCodes
+	}
+
+	return json.Marshal(&r)
+}
+
+func decodeUser(val []byte) (*user.User, error) {
+	r := record{User: new(user.User)}
+	if err := json.Unmarshal(val, &r); err != nil {
+		return nil, err
+	}
+
+	if r.TOTP != nil {
+		r.TOTP.Secret = r.TOTPSecret
+		r.TOTP.RecoveryCodes = r.TOTPRecoveryCodes
+	}
+
+	return r.User, nil
+}
+
 func (repo *userRepository) Close() error {
 	return repo.db.Close()
 }
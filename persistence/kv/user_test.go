@@ -1,8 +1,12 @@
 package kv
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger/v4"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/flarexio/identity/conf"
@@ -56,15 +60,35 @@ func (suite *userRepositoryTestSuite) TestFindByUsername() {
 	suite.Equal("mirror770109", user.Username)
 }
 
-func (suite *userRepositoryTestSuite) TestFindBySocialID() {
+func (suite *userRepositoryTestSuite) TestFindBySocialAccount() {
 	sid := suite.user.Accounts[0].SocialID
 
-	user, err := suite.users.FindBySocialID(sid)
+	user, err := suite.users.FindBySocialAccount(user.GOOGLE, sid)
 	suite.NoError(err)
 	suite.Equal("mirror770109", user.Username)
 	suite.Equal(sid, user.Accounts[0].SocialID)
 }
 
+func (suite *userRepositoryTestSuite) TestFindByEmail() {
+	// 相同 email 可屬於多個用戶
+	u2 := user.NewUser("user2", "User Two", "mirror770109@gmail.com")
+	u2.VerifyEmail()
+	err := suite.users.Store(u2)
+	suite.NoError(err)
+
+	users, err := suite.users.FindByEmail("mirror770109@gmail.com")
+	suite.NoError(err)
+	suite.Len(users, 2)
+
+	for _, u := range users {
+		suite.Equal(u.ID == u2.ID, u.EmailVerified)
+	}
+
+	users, err = suite.users.FindByEmail("unknown@example.com")
+	suite.NoError(err)
+	suite.Empty(users)
+}
+
 func (suite *userRepositoryTestSuite) TestAddMultipleSocialAccounts() {
 	// 添加多個社交帳號
 	u, err := suite.users.Find(suite.user.ID)
@@ -141,7 +165,7 @@ func (suite *userRepositoryTestSuite) TestRemoveAndReAddSocialAccount() {
 	suite.Equal(googleID, reAdded.Accounts[0].SocialID)
 
 	// 驗證可以透過 SocialID 找到
-	byGoogle, err := suite.users.FindBySocialID(googleID)
+	byGoogle, err := suite.users.FindBySocialAccount(user.GOOGLE, googleID)
 	suite.NoError(err)
 	suite.Equal(suite.user.ID, byGoogle.ID)
 }
@@ -161,11 +185,45 @@ func (suite *userRepositoryTestSuite) TestDeleteUser() {
 	suite.Equal(user.ErrUserNotFound, err)
 
 	// 驗證無法透過 SocialID 找到
-	_, err = suite.users.FindBySocialID(suite.user.Accounts[0].SocialID)
+	_, err = suite.users.FindBySocialAccount(user.GOOGLE, suite.user.Accounts[0].SocialID)
 	suite.Error(err)
 	suite.Equal(user.ErrUserNotFound, err)
 }
 
+func (suite *userRepositoryTestSuite) TestConcurrentModification() {
+	// 兩方讀取同一版本
+	first, err := suite.users.Find(suite.user.ID)
+	suite.NoError(err)
+
+	second, err := suite.users.Find(suite.user.ID)
+	suite.NoError(err)
+	suite.Equal(first.Version, second.Version)
+
+	first.Name = "First"
+	err = suite.users.Store(first)
+	suite.NoError(err)
+	suite.Equal(second.Version+1, first.Version)
+
+	// 後寫入者不得覆蓋
+	second.Name = "Second"
+	err = suite.users.Store(second)
+	suite.ErrorIs(err, user.ErrConcurrentModification)
+
+	err = suite.users.Delete(second)
+	suite.ErrorIs(err, user.ErrConcurrentModification)
+
+	found, err := suite.users.Find(suite.user.ID)
+	suite.NoError(err)
+	suite.Equal("First", found.Name)
+	suite.Equal(first.Version, found.Version)
+
+	// 已存在的用戶不可重複新增
+	dup := *suite.user
+	dup.Version = 0
+	err = suite.users.Store(&dup)
+	suite.ErrorIs(err, user.ErrConcurrentModification)
+}
+
 func (suite *userRepositoryTestSuite) TestListAll() {
 	// 創建多個用戶
 	u2 := user.NewUser("user2", "User Two", "user2@example.com")
@@ -191,6 +249,92 @@ func (suite *userRepositoryTestSuite) TestListAll() {
 	suite.Len(all, 2)
 }
 
+func (suite *userRepositoryTestSuite) TestQuery() {
+	// 建立多個用戶以測試分頁
+	for i := range 5 {
+		u := user.NewUser(fmt.Sprintf("user%d", i), fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i))
+		if i%2 == 0 {
+			u.AddSocialAccount(user.LINE, user.SocialID(fmt.Sprintf("line-user-%d", i)))
+		}
+
+		err := suite.users.Store(u)
+		suite.NoError(err)
+	}
+
+	// 依游標逐頁讀取，依建立順序排列
+	var usernames []string
+	q := &user.Query{Limit: 2}
+	for {
+		page, err := suite.users.Query(q)
+		if err != nil {
+			suite.Fail(err.Error())
+			return
+		}
+
+		suite.LessOrEqual(len(page.Users), 2)
+		for _, u := range page.Users {
+			usernames = append(usernames, u.Username)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		q.Cursor = page.NextCursor
+	}
+
+	suite.Equal([]string{"mirror770109", "user0", "user1", "user2", "user3", "user4"}, usernames)
+
+	// 由新到舊
+	page, err := suite.users.Query(&user.Query{Sort: user.SortNewest, Limit: 2})
+	suite.NoError(err)
+	suite.Equal("user4", page.Users[0].Username)
+	suite.Equal("user3", page.Users[1].Username)
+
+	page, err = suite.users.Query(&user.Query{Sort: user.SortNewest, Cursor: page.NextCursor})
+	suite.NoError(err)
+	suite.Len(page.Users, 4)
+	suite.Equal("user2", page.Users[0].Username)
+	suite.Empty(page.NextCursor)
+
+	// 篩選條件
+	page, err = suite.users.Query(&user.Query{Provider: user.LINE})
+	suite.NoError(err)
+	suite.Len(page.Users, 3)
+
+	page, err = suite.users.Query(&user.Query{UsernamePrefix: "user"})
+	suite.NoError(err)
+	suite.Len(page.Users, 5)
+
+	// 萬用字元應被視為一般字元
+	page, err = suite.users.Query(&user.Query{UsernamePrefix: "user_"})
+	suite.NoError(err)
+	suite.Empty(page.Users)
+
+	page, err = suite.users.Query(&user.Query{EmailPrefix: "mirror"})
+	suite.NoError(err)
+	suite.Len(page.Users, 1)
+
+	page, err = suite.users.Query(&user.Query{Status: []user.Status{user.Activated}})
+	suite.NoError(err)
+	suite.Empty(page.Users)
+
+	page, err = suite.users.Query(&user.Query{Status: []user.Status{user.Pending, user.Activated}})
+	suite.NoError(err)
+	suite.Len(page.Users, 6)
+
+	page, err = suite.users.Query(&user.Query{CreatedAfter: time.Now().Add(time.Hour)})
+	suite.NoError(err)
+	suite.Empty(page.Users)
+
+	page, err = suite.users.Query(&user.Query{CreatedBefore: time.Now().Add(time.Hour)})
+	suite.NoError(err)
+	suite.Len(page.Users, 6)
+
+	_, err = suite.users.Query(&user.Query{Cursor: "invalid"})
+	suite.ErrorIs(err, user.ErrCursorInvalid)
+}
+
 func (suite *userRepositoryTestSuite) TestDuplicateSocialAccount() {
 	u, err := suite.users.Find(suite.user.ID)
 	suite.NoError(err)
@@ -201,6 +345,79 @@ func (suite *userRepositoryTestSuite) TestDuplicateSocialAccount() {
 	suite.Contains(err.Error(), "already exists")
 }
 
+func (suite *userRepositoryTestSuite) TestDuplicateUsername() {
+	// 同時註冊相同的用戶名稱
+	u := user.NewUser("mirror770109", "Another", "another@example.com")
+	err := suite.users.Store(u)
+	suite.ErrorIs(err, user.ErrUserExists)
+
+	found, err := suite.users.FindByUsername("mirror770109")
+	suite.NoError(err)
+	suite.Equal(suite.user.ID, found.ID)
+}
+
+func (suite *userRepositoryTestSuite) TestSocialAccountScopedByProvider() {
+	sid := suite.user.Accounts[0].SocialID
+
+	// 不同 provider 的相同 SocialID 屬於不同帳號
+	u2 := user.NewUser("user2", "User Two", "user2@example.com")
+	u2.AddSocialAccount(user.LINE, sid)
+	err := suite.users.Store(u2)
+	suite.NoError(err)
+
+	found, err := suite.users.FindBySocialAccount(user.GOOGLE, sid)
+	suite.NoError(err)
+	suite.Equal(suite.user.ID, found.ID)
+
+	found, err = suite.users.FindBySocialAccount(user.LINE, sid)
+	suite.NoError(err)
+	suite.Equal(u2.ID, found.ID)
+
+	_, err = suite.users.FindBySocialAccount(user.FACEBOOK, sid)
+	suite.Equal(user.ErrUserNotFound, err)
+
+	// 相同 provider 的相同 SocialID 不可屬於兩個用戶
+	u3 := user.NewUser("user3", "User Three", "user3@example.com")
+	u3.AddSocialAccount(user.GOOGLE, sid)
+	err = suite.users.Store(u3)
+	suite.ErrorIs(err, user.ErrSocialAccountExists)
+
+	_, err = suite.users.Find(u3.ID)
+	suite.Equal(user.ErrUserNotFound, err)
+
+	// 移除後可由其他用戶使用
+	u2.RemoveSocialAccount(user.LINE, sid)
+	suite.NoError(suite.users.Store(u2))
+
+	_, err = suite.users.FindBySocialAccount(user.LINE, sid)
+	suite.Equal(user.ErrUserNotFound, err)
+}
+
+func (suite *userRepositoryTestSuite) TestTOTP() {
+	u, err := suite.users.Find(suite.user.ID)
+	suite.NoError(err)
+
+	u.EnrollTOTP("sealed-secret")
+	u.ConfirmTOTP([]string{"hash1", "hash2"})
+
+	err = suite.users.Store(u)
+	suite.NoError(err)
+
+	found, err := suite.users.Find(suite.user.ID)
+	suite.NoError(err)
+	suite.True(found.TOTPEnabled())
+	suite.Equal("sealed-secret", found.TOTP.Secret)
+	suite.Equal([]string{"hash1", "hash2"}, found.TOTP.RecoveryCodes)
+
+	// 停用後不應殘留
+	found.DisableTOTP()
+	suite.users.Store(found)
+
+	found, err = suite.users.Find(suite.user.ID)
+	suite.NoError(err)
+	suite.Nil(found.TOTP)
+}
+
 func (suite *userRepositoryTestSuite) TearDownSuite() {
 	suite.users.Truncate()
 	suite.users.Close()
@@ -209,3 +426,135 @@ func (suite *userRepositoryTestSuite) TearDownSuite() {
 func TestUserRepositoryTestSuite(t *testing.T) {
 	suite.Run(t, new(userRepositoryTestSuite))
 }
+
+func TestMigrateSocialKeys(t *testing.T) {
+	cfg := conf.Persistence{
+		Driver: conf.BadgerDB,
+		Host:   t.TempDir(),
+		Name:   "identity",
+	}
+
+	u := user.NewUser("user1", "User One", "user1@example.com")
+	u.AddSocialAccount(user.GOOGLE, "1001")
+	u.EventStore = nil
+
+	bs, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 舊版以 social:<id> 為鍵
+	db, err := badger.Open(badger.DefaultOptions(cfg.Host + "/" + cfg.Name).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(txn *badger.Txn) error {
+		txn.Set(u.ID.Bytes(), bs)
+		txn.Set([]byte("username:"+u.Username), bs)
+		return txn.Set([]byte("social:1001"), bs)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	users, err := NewUserRepository(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer users.Close()
+
+	found, err := users.FindBySocialAccount(user.GOOGLE, "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != u.ID {
+		t.Fatalf("expected %s, got %s", u.ID, found.ID)
+	}
+
+	repo := users.(*userRepository)
+	if err := repo.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("social:1001"))
+		return err
+	}); err != badger.ErrKeyNotFound {
+		t.Fatalf("legacy key not removed: %v", err)
+	}
+}
+
+func TestMigrateUserKeys(t *testing.T) {
+	cfg := conf.Persistence{
+		Driver: conf.BadgerDB,
+		Host:   t.TempDir(),
+		Name:   "identity",
+	}
+
+	u := user.NewUser("user1", "User One", "user1@example.com")
+	u.EventStore = nil
+
+	bs, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 舊版沒有 user:<id> 索引
+	db, err := badger.Open(badger.DefaultOptions(cfg.Host + "/" + cfg.Name).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Update(func(txn *badger.Txn) error {
+		txn.Set(u.ID.Bytes(), bs)
+		return txn.Set([]byte("username:"+u.Username), bs)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	users, err := NewUserRepository(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer users.Close()
+
+	page, err := users.Query(&user.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Users) != 1 || page.Users[0].ID != u.ID {
+		t.Fatalf("expected %s to be indexed, got %d users", u.ID, len(page.Users))
+	}
+
+	// 用戶只存一份，其餘鍵只存 ID
+	repo := users.(*userRepository)
+	if err := repo.db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(u.ID.Bytes()); err != badger.ErrKeyNotFound {
+			return fmt.Errorf("legacy key not removed: %v", err)
+		}
+
+		id, err := getID(txn, usernameKey(u.Username))
+		if err != nil {
+			return err
+		}
+
+		if id != u.ID {
+			return fmt.Errorf("expected %s, got %s", u.ID, id)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := users.FindByUsername(u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != u.ID {
+		t.Fatalf("expected %s, got %s", u.ID, found.ID)
+	}
+}
@@ -0,0 +1,18 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/db"
+)
+
+// NewMigrator manages the schema of the SQL databases; the others have none.
+func NewMigrator(cfg conf.Persistence) (*db.Migrator, error) {
+	switch cfg.Driver {
+	case conf.SQLite, conf.Postgres, conf.MySQL:
+		return db.NewMigrator(cfg)
+	default:
+		return nil, errors.New("driver has no schema migrations")
+	}
+}
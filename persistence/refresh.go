@@ -0,0 +1,24 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/db"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/persistence/kv"
+	"github.com/flarexio/identity/refresh"
+)
+
+func NewRefreshTokenStore(cfg conf.Persistence) (refresh.Store, error) {
+	switch cfg.Driver {
+	case conf.SQLite, conf.Postgres, conf.MySQL:
+		return db.NewRefreshTokenStore(cfg)
+	case conf.BadgerDB:
+		return kv.NewRefreshTokenStore(cfg)
+	case conf.InMem:
+		return inmem.NewRefreshTokenStore()
+	default:
+		return nil, errors.New("driver not supported")
+	}
+}
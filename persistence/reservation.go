@@ -0,0 +1,24 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/db"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/persistence/kv"
+	"github.com/flarexio/identity/user"
+)
+
+func NewReservationStore(cfg conf.Persistence) (user.ReservationStore, error) {
+	switch cfg.Driver {
+	case conf.SQLite, conf.Postgres, conf.MySQL:
+		return db.NewReservationStore(cfg)
+	case conf.BadgerDB:
+		return kv.NewReservationStore(cfg)
+	case conf.InMem:
+		return inmem.NewReservationStore()
+	default:
+		return nil, errors.New("driver not supported")
+	}
+}
@@ -0,0 +1,24 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/db"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/persistence/kv"
+	"github.com/flarexio/identity/revocation"
+)
+
+func NewRevocationStore(cfg conf.Persistence) (revocation.Store, error) {
+	switch cfg.Driver {
+	case conf.SQLite, conf.Postgres, conf.MySQL:
+		return db.NewRevocationStore(cfg)
+	case conf.BadgerDB:
+		return kv.NewRevocationStore(cfg)
+	case conf.InMem:
+		return inmem.NewRevocationStore()
+	default:
+		return nil, errors.New("driver not supported")
+	}
+}
@@ -0,0 +1,42 @@
+package persistence
+
+import (
+	"errors"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/persistence/db"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/user"
+)
+
+// NewSearchIndex keeps the index of the SQL databases in the database
+// itself, shared by every instance using it. BadgerDB is embedded in a
+// single instance, so it and the in-memory store get an index in memory,
+// filled from the users on every start.
+func NewSearchIndex(cfg conf.Persistence, users user.Repository) (user.SearchIndex, error) {
+	switch cfg.Driver {
+	case conf.SQLite, conf.Postgres, conf.MySQL:
+		return db.NewSearchIndex(cfg)
+	case conf.BadgerDB, conf.InMem:
+	default:
+		return nil, errors.New("driver not supported")
+	}
+
+	index, err := inmem.NewSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := users.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range all {
+		if err := index.Index(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
+}
@@ -12,7 +12,7 @@ import (
 
 func NewUserRepository(cfg conf.Persistence) (user.Repository, error) {
 	switch cfg.Driver {
-	case conf.SQLite:
+	case conf.SQLite, conf.Postgres, conf.MySQL:
 		return db.NewUserRepository(cfg)
 	case conf.BadgerDB:
 		return kv.NewUserRepository(cfg)
@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/passkeys"
+	"github.com/flarexio/identity/user"
+)
+
+var ErrProviderExists = errors.New("provider exists")
+
+// SocialIdentity is what a provider vouches for about the user behind a
+// credential. Only Subject is guaranteed; the rest is what the provider
+// chose to share.
+type SocialIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// SocialProvider verifies a credential issued by a social provider, usually
+// an ID token. A nonce the transport put in ctx under user.Nonce must match.
+type SocialProvider interface {
+	Verify(ctx context.Context, credential string) (*SocialIdentity, error)
+}
+
+type SocialProviderFunc func(ctx context.Context, credential string) (*SocialIdentity, error)
+
+func (f SocialProviderFunc) Verify(ctx context.Context, credential string) (*SocialIdentity, error) {
+	return f(ctx, credential)
+}
+
+// ProviderRegistry holds the providers users sign in with, keyed by the
+// name their social accounts are stored under.
+type ProviderRegistry struct {
+	providers map[user.SocialProvider]SocialProvider
+	sync.RWMutex
+}
+
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: make(map[user.SocialProvider]SocialProvider),
+	}
+}
+
+// DefaultProviderRegistry registers the built-in providers and the generic
+// OIDC providers from the config; embedders may register more on top.
+func DefaultProviderRegistry(cfg conf.Providers, passkeys passkeys.Service) (*ProviderRegistry, error) {
+	r := NewProviderRegistry()
+
+	if err := r.Register(user.GOOGLE, NewGoogleProvider(cfg.Google)); err != nil {
+		return nil, err
+	}
+
+	if err := r.Register(user.LINE, NewLINEProvider(cfg.LINE)); err != nil {
+		return nil, err
+	}
+
+	if err := r.Register(user.FACEBOOK, NewFacebookProvider(cfg.Facebook)); err != nil {
+		return nil, err
+	}
+
+	if err := r.Register(user.PASSKEYS, NewPasskeysProvider(passkeys)); err != nil {
+		return nil, err
+	}
+
+	for _, cfg := range cfg.OIDC {
+		p, err := NewOIDCProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := r.Register(user.SocialProvider(cfg.Name), p); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *ProviderRegistry) Register(name user.SocialProvider, p SocialProvider) error {
+	if name == "" {
+		return errors.New("provider name required")
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.providers[name]; ok {
+		return ErrProviderExists
+	}
+
+	r.providers[name] = p
+	return nil
+}
+
+func (r *ProviderRegistry) Provider(name user.SocialProvider) (SocialProvider, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrProviderNotSupported
+	}
+
+	return p, nil
+}
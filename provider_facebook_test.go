@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/conf"
+)
+
+// newGraphAPI stands in for the Graph API, knowing a single user token
+// issued to app01.
+func newGraphAPI(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	tokens := map[string]string{
+		"token01": "app01",
+		"token02": "app02",
+	}
+
+	mux.HandleFunc("/debug_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Query().Get("access_token") != "app01|secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"Invalid OAuth access token","type":"OAuthException","code":190}}`))
+			return
+		}
+
+		app, ok := tokens[r.URL.Query().Get("input_token")]
+		if !ok {
+			w.Write([]byte(`{"data":{"is_valid":false}}`))
+			return
+		}
+
+		w.Write([]byte(`{"data":{"app_id":"` + app + `","user_id":"10001","is_valid":true}}`))
+	})
+
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(token))
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Query().Get("appsecret_proof") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"Invalid appsecret_proof","type":"GraphMethodException","code":100}}`))
+			return
+		}
+
+		w.Write([]byte(`{"id":"10001","name":"User01","email":"user01@example.com",` +
+			`"picture":{"data":{"url":"https://example.com/user01.png"}}}`))
+	})
+
+	return srv
+}
+
+func TestFacebookProviderVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := newGraphAPI(t)
+
+	p := NewFacebookProvider(conf.FacebookProvider{
+		App:      conf.OAuthAPI{ID: "app01", Secret: "secret"},
+		GraphURL: srv.URL,
+	})
+
+	identity, err := p.Verify(context.Background(), "token01")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("10001", identity.Subject)
+	assert.Equal("user01@example.com", identity.Email)
+	assert.False(identity.EmailVerified)
+	assert.Equal("User01", identity.Name)
+	assert.Equal("https://example.com/user01.png", identity.Picture)
+
+	// Issued to another app.
+	_, err = p.Verify(context.Background(), "token02")
+	assert.ErrorIs(err, ErrFacebookTokenInvalid)
+
+	_, err = p.Verify(context.Background(), "unknown")
+	assert.ErrorIs(err, ErrFacebookTokenInvalid)
+
+	p = NewFacebookProvider(conf.FacebookProvider{
+		App:      conf.OAuthAPI{ID: "app01", Secret: "wrong"},
+		GraphURL: srv.URL,
+	})
+
+	_, err = p.Verify(context.Background(), "token01")
+	assert.ErrorIs(err, ErrFacebookTokenInvalid)
+}
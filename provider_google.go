@@ -0,0 +1,36 @@
+package identity
+
+import (
+	"context"
+
+	"google.golang.org/api/idtoken"
+
+	"github.com/flarexio/identity/conf"
+)
+
+// NewGoogleProvider verifies Google ID tokens issued to the configured
+// client.
+func NewGoogleProvider(cfg conf.GoogleProvider) SocialProvider {
+	return SocialProviderFunc(func(ctx context.Context, credential string) (*SocialIdentity, error) {
+		audience := cfg.Client.ID
+		if audience == "" {
+			return nil, ErrAudienceNotFound
+		}
+
+		payload, err := idtoken.Validate(ctx, credential, audience)
+		if err != nil {
+			return nil, err
+		}
+
+		identity := &SocialIdentity{
+			Subject: payload.Subject,
+		}
+
+		identity.Email, _ = payload.Claims["email"].(string)
+		identity.EmailVerified, _ = payload.Claims["email_verified"].(bool)
+		identity.Name, _ = payload.Claims["name"].(string)
+		identity.Picture, _ = payload.Claims["picture"].(string)
+
+		return identity, nil
+	})
+}
@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+type LINEClaims struct {
+	jwt.RegisteredClaims
+	Nonce   string `json:"nonce"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+	Email   string `json:"email"`
+
+	EmailVerified bool `json:"email_verified"`
+}
+
+// NewLINEProvider verifies LINE Login ID tokens, signed HS256 with the
+// channel secret. LINE tokens always come from our own login flow, so the
+// nonce of that flow is required.
+func NewLINEProvider(cfg conf.LineProvider) SocialProvider {
+	return SocialProviderFunc(func(ctx context.Context, credential string) (*SocialIdentity, error) {
+		audience := cfg.Channel.ID
+		if audience == "" {
+			return nil, ErrAudienceNotFound
+		}
+
+		keyFn := func(t *jwt.Token) (any, error) {
+			secret := []byte(cfg.Channel.Secret)
+			return secret, nil
+		}
+
+		var claims LINEClaims
+		if _, err := jwt.ParseWithClaims(credential, &claims, keyFn,
+			jwt.WithIssuer("https://access.line.me"),
+			jwt.WithAudience(audience),
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithLeeway(10*time.Second),
+		); err != nil {
+			return nil, err
+		}
+
+		nonce, ok := ctx.Value(user.Nonce).(string)
+		if !ok || (nonce != claims.Nonce) {
+			return nil, errors.New("invalid nonce")
+		}
+
+		return &SocialIdentity{
+			Subject:       claims.Subject,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			Name:          claims.Name,
+			Picture:       claims.Picture,
+		}, nil
+	})
+}
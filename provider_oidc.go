@@ -0,0 +1,197 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+var (
+	ErrDiscoveryFailed = errors.New("oidc discovery failed")
+	ErrIssuerRequired  = errors.New("oidc issuer or discovery url required")
+)
+
+// defaultAlgorithms are what providers sign ID tokens with unless told
+// otherwise; any other, HS256 included, has to be configured.
+var defaultAlgorithms = []string{"RS256", "ES256"}
+
+// oidcProvider validates the ID tokens of a generic OpenID Connect provider.
+// Discovery happens on first use, so a provider that is down at startup
+// only fails its own sign-ins; a failed discovery is retried next time.
+type oidcProvider struct {
+	cfg    conf.OIDCProvider
+	client *resty.Client
+
+	mu     sync.Mutex
+	issuer string
+	jwks   jwt.Keyfunc
+}
+
+// NewOIDCProvider makes any OpenID Connect provider usable from the config
+// alone.
+func NewOIDCProvider(cfg conf.OIDCProvider) (SocialProvider, error) {
+	if cfg.Issuer == "" && cfg.DiscoveryURL == "" {
+		return nil, ErrIssuerRequired
+	}
+
+	if cfg.DiscoveryURL == "" {
+		cfg.DiscoveryURL = strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	}
+
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = defaultAlgorithms
+	}
+
+	return &oidcProvider{
+		cfg:    cfg,
+		client: resty.New().SetTimeout(5 * time.Second),
+	}, nil
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (string, jwt.Keyfunc, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jwks != nil {
+		return p.issuer, p.jwks, nil
+	}
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+
+	resp, err := p.client.R().
+		SetContext(ctx).
+		SetResult(&doc).
+		Get(p.cfg.DiscoveryURL)
+
+	if err != nil {
+		return "", nil, errors.Join(ErrDiscoveryFailed, err)
+	}
+
+	if resp.StatusCode() != http.StatusOK || doc.JWKSURI == "" {
+		return "", nil, ErrDiscoveryFailed
+	}
+
+	// The issuer a token must carry is the configured one; a discovery
+	// document claiming otherwise is not to be trusted.
+	if p.cfg.Issuer != "" && doc.Issuer != p.cfg.Issuer {
+		return "", nil, errors.Join(ErrDiscoveryFailed, errors.New("issuer mismatch"))
+	}
+
+	// The key set refreshes itself for as long as the service runs.
+	k, err := keyfunc.NewDefaultCtx(context.Background(), []string{doc.JWKSURI})
+	if err != nil {
+		return "", nil, err
+	}
+
+	p.issuer = doc.Issuer
+	p.jwks = k.Keyfunc
+
+	return p.issuer, p.jwks, nil
+}
+
+// Verify checks the ID token against the provider's keys, or its client
+// secret for HS256, and maps its claims. Only the configured algorithms are
+// accepted. A nonce in ctx must match.
+func (p *oidcProvider) Verify(ctx context.Context, credential string) (*SocialIdentity, error) {
+	audience := p.cfg.Client.ID
+	if audience == "" {
+		return nil, ErrAudienceNotFound
+	}
+
+	issuer, jwks, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFn := func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			if p.cfg.Client.Secret == "" {
+				return nil, errors.New("client secret required for HS256")
+			}
+
+			return []byte(p.cfg.Client.Secret), nil
+		}
+
+		return jwks(t)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(credential, claims, keyFn,
+		jwt.WithValidMethods(p.cfg.Algorithms),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(10*time.Second),
+	); err != nil {
+		return nil, err
+	}
+
+	if nonce, ok := ctx.Value(user.Nonce).(string); ok {
+		if claims["nonce"] != nonce {
+			return nil, errors.New("invalid nonce")
+		}
+	}
+
+	mapping := p.cfg.Claims
+
+	identity := &SocialIdentity{
+		Subject:       stringClaim(claims, mapping.Subject, "sub"),
+		Email:         stringClaim(claims, mapping.Email, "email"),
+		Name:          stringClaim(claims, mapping.Name, "name"),
+		Picture:       stringClaim(claims, mapping.Picture, "picture"),
+		EmailVerified: boolClaim(claims, mapping.EmailVerified, "email_verified"),
+	}
+
+	if identity.Subject == "" {
+		return nil, errors.New("subject not found")
+	}
+
+	return identity, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		// Numeric IDs, as some providers use for the subject.
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// boolClaim also accepts "true", as some providers send email_verified as
+// a string.
+func boolClaim(claims jwt.MapClaims, name string, fallback string) bool {
+	if name == "" {
+		name = fallback
+	}
+
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,152 @@
+package identity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+// newIssuer serves the discovery document and JWKS of a provider signing
+// with the returned key.
+func newIssuer(t *testing.T) (*httptest.Server, ed25519.PrivateKey) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer":"` + srv.URL + `","jwks_uri":"` + srv.URL + `/jwks"}`))
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		x := base64.RawURLEncoding.EncodeToString(pub)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","alg":"EdDSA","use":"sig","kid":"key01","x":"` + x + `"}]}`))
+	})
+
+	return srv, priv
+}
+
+func signIDToken(t *testing.T, key any, method jwt.SigningMethod, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "key01"
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestOIDCProviderVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	srv, priv := newIssuer(t)
+
+	cfg := conf.OIDCProvider{
+		Name:       "keycloak",
+		Issuer:     srv.URL,
+		Client:     conf.OAuthAPI{ID: "identity", Secret: "secret"},
+		Algorithms: []string{"EdDSA", "HS256"},
+		Claims:     conf.ClaimMapping{Picture: "avatar_url"},
+	}
+
+	p, err := NewOIDCProvider(cfg)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            srv.URL,
+		"aud":            "identity",
+		"sub":            "user01",
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          "user01@example.com",
+		"email_verified": "true",
+		"name":           "User01",
+		"avatar_url":     "https://example.com/user01.png",
+		"nonce":          "nonce01",
+	}
+
+	ctx := context.WithValue(context.Background(), user.Nonce, "nonce01")
+
+	identity, err := p.Verify(ctx, signIDToken(t, priv, jwt.SigningMethodEdDSA, claims))
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("user01", identity.Subject)
+	assert.Equal("user01@example.com", identity.Email)
+	assert.True(identity.EmailVerified)
+	assert.Equal("User01", identity.Name)
+	assert.Equal("https://example.com/user01.png", identity.Picture)
+
+	// HS256 ID tokens are signed with the client secret.
+	_, err = p.Verify(ctx, signIDToken(t, []byte("secret"), jwt.SigningMethodHS256, claims))
+	assert.NoError(err)
+
+	_, err = p.Verify(ctx, signIDToken(t, []byte("wrong"), jwt.SigningMethodHS256, claims))
+	assert.Error(err)
+
+	ctx = context.WithValue(context.Background(), user.Nonce, "nonce02")
+	_, err = p.Verify(ctx, signIDToken(t, priv, jwt.SigningMethodEdDSA, claims))
+	assert.Error(err)
+
+	claims["aud"] = "another"
+	_, err = p.Verify(context.Background(), signIDToken(t, priv, jwt.SigningMethodEdDSA, claims))
+	assert.Error(err)
+
+	// Algorithms not configured are refused, whatever the token names.
+	claims["aud"] = "identity"
+	cfg.Algorithms = nil
+
+	p, _ = NewOIDCProvider(cfg)
+
+	_, err = p.Verify(context.Background(), signIDToken(t, []byte("secret"), jwt.SigningMethodHS256, claims))
+	assert.ErrorIs(err, jwt.ErrTokenSignatureInvalid)
+
+	_, err = p.Verify(context.Background(), signIDToken(t, priv, jwt.SigningMethodEdDSA, claims))
+	assert.ErrorIs(err, jwt.ErrTokenSignatureInvalid)
+
+	_, err = NewOIDCProvider(conf.OIDCProvider{Name: "keycloak"})
+	assert.ErrorIs(err, ErrIssuerRequired)
+}
+
+func TestOIDCProviderDiscoveryFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	srv, _ := newIssuer(t)
+
+	p, err := NewOIDCProvider(conf.OIDCProvider{
+		Name:   "keycloak",
+		Issuer: "https://another.example.com",
+		Client: conf.OAuthAPI{ID: "identity"},
+		// Claims an issuer other than the configured one.
+		DiscoveryURL: srv.URL + "/.well-known/openid-configuration",
+	})
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	_, err = p.Verify(context.Background(), "token")
+	assert.ErrorIs(err, ErrDiscoveryFailed)
+}
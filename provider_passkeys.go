@@ -0,0 +1,25 @@
+package identity
+
+import (
+	"context"
+
+	"github.com/flarexio/identity/passkeys"
+)
+
+// NewPasskeysProvider verifies the token Hanko hands out after a passkey
+// login. It only names the subject, so passkeys never register new users.
+func NewPasskeysProvider(svc passkeys.Service) SocialProvider {
+	return SocialProviderFunc(func(ctx context.Context, credential string) (*SocialIdentity, error) {
+		token, err := svc.VerifyToken(credential)
+		if err != nil {
+			return nil, err
+		}
+
+		subject, err := token.Claims.GetSubject()
+		if err != nil {
+			return nil, err
+		}
+
+		return &SocialIdentity{Subject: subject}, nil
+	})
+}
@@ -0,0 +1,86 @@
+package identity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+func TestProviderRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewProviderRegistry()
+
+	custom := SocialProviderFunc(func(ctx context.Context, credential string) (*SocialIdentity, error) {
+		return &SocialIdentity{Subject: credential}, nil
+	})
+
+	err := r.Register("custom", custom)
+	assert.NoError(err)
+
+	err = r.Register("custom", custom)
+	assert.ErrorIs(err, ErrProviderExists)
+
+	p, err := r.Provider("custom")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	identity, err := p.Verify(context.Background(), "user01")
+	assert.NoError(err)
+	assert.Equal("user01", identity.Subject)
+
+	_, err = r.Provider(user.FACEBOOK)
+	assert.ErrorIs(err, ErrProviderNotSupported)
+
+	// A generic provider cannot take over a built-in one.
+	_, err = DefaultProviderRegistry(conf.Providers{
+		OIDC: []conf.OIDCProvider{{Name: "google", Issuer: "https://accounts.example.com"}},
+	}, nil)
+	assert.ErrorIs(err, ErrProviderExists)
+}
+
+func TestLINEProviderNonce(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewLINEProvider(conf.LineProvider{
+		Channel: conf.OAuthAPI{ID: "channel01", Secret: "secret"},
+	})
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   "https://access.line.me",
+		"aud":   "channel01",
+		"sub":   "U0001",
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": "nonce01",
+		"email": "user01@example.com",
+	}
+
+	token := signIDToken(t, []byte("secret"), jwt.SigningMethodHS256, claims)
+
+	ctx := context.WithValue(context.Background(), user.Nonce, "nonce01")
+	identity, err := p.Verify(ctx, token)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("U0001", identity.Subject)
+	assert.Equal("user01@example.com", identity.Email)
+
+	// Linking an account goes through the same check as signing in.
+	_, err = p.Verify(context.Background(), token)
+	assert.Error(err)
+
+	ctx = context.WithValue(context.Background(), user.Nonce, "nonce02")
+	_, err = p.Verify(ctx, token)
+	assert.Error(err)
+}
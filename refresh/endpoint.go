@@ -0,0 +1,93 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type IssueRequest struct {
+	Subject  string
+	ClientID string
+	Scope    []string
+}
+
+// IssueEndpoint starts a new token family for the given subject.
+func IssueEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(IssueRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Issue(req.Subject, req.ClientID, req.Scope...)
+	}
+}
+
+type RevokeRequest struct {
+	Token    string
+	Subject  string
+	ClientID string
+}
+
+// RevokeEndpoint ends the session of a refresh token, if it belongs to the
+// subject and client asking.
+func RevokeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(RevokeRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		err := svc.RevokeFor(req.Token, req.Subject, req.ClientID)
+		return nil, err
+	}
+}
+
+// RevokeAllEndpoint ends every session of a subject.
+func RevokeAllEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		subject, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		err := svc.RevokeAll(subject)
+		return nil, err
+	}
+}
+
+type RotateRequest struct {
+	Token    string
+	ClientID string
+}
+
+type RotateResponse struct {
+	Subject  string
+	ClientID string
+	Scope    []string
+	Token    string
+}
+
+// RotateEndpoint exchanges a refresh token for its successor.
+func RotateEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(RotateRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		t, next, err := svc.Rotate(req.Token, req.ClientID)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RotateResponse{
+			Subject:  t.Subject,
+			ClientID: t.ClientID,
+			Scope:    t.Scope,
+			Token:    next,
+		}, nil
+	}
+}
@@ -0,0 +1,34 @@
+package refresh
+
+import "time"
+
+// Token is the stored half of an opaque refresh token. ID is the SHA-256 of
+// the value handed to the client, so a leaked store cannot be replayed.
+type Token struct {
+	ID        string    `json:"id"`
+	Family    string    `json:"family"` // every rotation of one sign-in shares a family
+	Subject   string    `json:"subject"`
+	ClientID  string    `json:"client_id,omitempty"` // empty for the first-party sign-in
+	Scope     []string  `json:"scope,omitempty"`     // granted at sign-in, kept by every rotation
+	Used      bool      `json:"used"`
+	Revoked   bool      `json:"revoked"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists refresh tokens; Use must be atomic.
+type Store interface {
+	// Command
+
+	Save(t *Token) error
+	Use(id string) (*Token, error) // marks the token used and returns it as it was before
+	RevokeFamily(family string) error
+	RevokeSubject(subject string) error
+
+	// Query
+
+	Find(id string) (*Token, error)
+
+	// Close the store
+	Close() error
+}
@@ -0,0 +1,147 @@
+package refresh
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	// ErrTokenInvalid collapses unknown/expired/revoked into one error.
+	ErrTokenInvalid = errors.New("refresh token invalid")
+	ErrTokenReused  = errors.New("refresh token reused")
+)
+
+// Service issues opaque refresh tokens and rotates them on every use.
+// Presenting an already rotated token revokes its whole family. The scope
+// given at issue travels with the family, so a refresh can never widen it.
+type Service interface {
+	Issue(subject string, clientID string, scope ...string) (string, error)
+	Rotate(token string, clientID string) (*Token, string, error)
+	Revoke(token string) error
+	RevokeFor(token string, subject string, clientID string) error
+	RevokeAll(subject string) error
+}
+
+const defaultTTL = 24 * time.Hour
+
+func NewService(store Store, ttl time.Duration) Service {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &service{store: store, ttl: ttl}
+}
+
+type service struct {
+	store Store
+	ttl   time.Duration
+}
+
+func (svc *service) Issue(subject string, clientID string, scope ...string) (string, error) {
+	_, value, err := svc.issue(ulid.Make().String(), subject, clientID, scope)
+	return value, err
+}
+
+// Rotate only accepts a token from the client it was issued to; any other
+// client presenting it is treated like a replay.
+func (svc *service) Rotate(token string, clientID string) (*Token, string, error) {
+	if token == "" {
+		return nil, "", ErrTokenInvalid
+	}
+
+	t, err := svc.store.Use(hash(token))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if t.Revoked || time.Now().After(t.ExpiresAt) {
+		return nil, "", ErrTokenInvalid
+	}
+
+	// Someone already rotated this token: either the client or a thief is
+	// replaying it, and we cannot tell which, so end the whole session.
+	if t.Used || t.ClientID != clientID {
+		if err := svc.store.RevokeFamily(t.Family); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrTokenReused
+	}
+
+	return svc.issue(t.Family, t.Subject, t.ClientID, t.Scope)
+}
+
+// Revoke ends the session the token belongs to; unknown tokens are ignored
+// so signing out twice is harmless.
+func (svc *service) Revoke(token string) error {
+	t, err := svc.store.Use(hash(token))
+	if err != nil {
+		if errors.Is(err, ErrTokenInvalid) {
+			return nil
+		}
+
+		return err
+	}
+
+	return svc.store.RevokeFamily(t.Family)
+}
+
+// RevokeFor is Revoke on behalf of a client, or a user signed in to it,
+// which may only end sessions of their own; an empty subject is any user's.
+// Tokens of someone else are ignored like unknown ones, and left unused, so
+// their rotation goes on as before.
+func (svc *service) RevokeFor(token string, subject string, clientID string) error {
+	t, err := svc.store.Find(hash(token))
+	if err != nil {
+		if errors.Is(err, ErrTokenInvalid) {
+			return nil
+		}
+
+		return err
+	}
+
+	if t.ClientID != clientID || (subject != "" && t.Subject != subject) {
+		return nil
+	}
+
+	return svc.store.RevokeFamily(t.Family)
+}
+
+func (svc *service) RevokeAll(subject string) error {
+	return svc.store.RevokeSubject(subject)
+}
+
+func (svc *service) issue(family string, subject string, clientID string, scope []string) (*Token, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	t := &Token{
+		ID:        hash(value),
+		Family:    family,
+		Subject:   subject,
+		ClientID:  clientID,
+		Scope:     scope,
+		ExpiresAt: now.Add(svc.ttl),
+		CreatedAt: now,
+	}
+
+	if err := svc.store.Save(t); err != nil {
+		return nil, "", err
+	}
+
+	return t, value, nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,152 @@
+package refresh_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/refresh"
+)
+
+func TestRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewRefreshTokenStore()
+	defer store.Close()
+
+	svc := refresh.NewService(store, time.Hour)
+
+	first, err := svc.Issue("user01", "wallet", "openid", "profile")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	token, second, err := svc.Rotate(first, "wallet")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.Equal("user01", token.Subject)
+	assert.Equal([]string{"openid", "profile"}, token.Scope)
+	assert.NotEqual(first, second)
+
+	// Replaying the first token burns the whole family, second included.
+	_, _, err = svc.Rotate(first, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenReused)
+
+	_, _, err = svc.Rotate(second, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+
+	_, _, err = svc.Rotate("unknown", "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+}
+
+func TestRotateOtherClient(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewRefreshTokenStore()
+	defer store.Close()
+
+	svc := refresh.NewService(store, time.Hour)
+
+	token, _ := svc.Issue("user01", "wallet")
+
+	// A token leaking to another client ends the session like a replay.
+	_, _, err := svc.Rotate(token, "mdm")
+	assert.ErrorIs(err, refresh.ErrTokenReused)
+
+	_, _, err = svc.Rotate(token, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+}
+
+func TestRotateExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewRefreshTokenStore()
+	defer store.Close()
+
+	svc := refresh.NewService(store, time.Millisecond)
+
+	token, _ := svc.Issue("user01", "wallet")
+	time.Sleep(5 * time.Millisecond)
+
+	_, _, err := svc.Rotate(token, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+}
+
+func TestRevoke(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewRefreshTokenStore()
+	defer store.Close()
+
+	svc := refresh.NewService(store, time.Hour)
+
+	token, _ := svc.Issue("user01", "wallet")
+	_, next, _ := svc.Rotate(token, "wallet")
+
+	err := svc.Revoke(next)
+	assert.NoError(err)
+
+	_, _, err = svc.Rotate(next, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+
+	// Signing out twice is harmless.
+	err = svc.Revoke(next)
+	assert.NoError(err)
+
+	err = svc.Revoke("unknown")
+	assert.NoError(err)
+}
+
+func TestRevokeAll(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewRefreshTokenStore()
+	defer store.Close()
+
+	svc := refresh.NewService(store, time.Hour)
+
+	first, _ := svc.Issue("user01", "wallet")
+	second, _ := svc.Issue("user01", "wallet")
+	other, _ := svc.Issue("user02", "wallet")
+
+	err := svc.RevokeAll("user01")
+	assert.NoError(err)
+
+	_, _, err = svc.Rotate(first, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+
+	_, _, err = svc.Rotate(second, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+
+	_, _, err = svc.Rotate(other, "wallet")
+	assert.NoError(err)
+}
+
+func TestRevokeFor(t *testing.T) {
+	assert := assert.New(t)
+
+	store, _ := inmem.NewRefreshTokenStore()
+	defer store.Close()
+
+	svc := refresh.NewService(store, time.Hour)
+
+	token, _ := svc.Issue("user01", "wallet")
+
+	// Someone else's token is left as it is.
+	assert.NoError(svc.RevokeFor(token, "user02", "wallet"))
+	assert.NoError(svc.RevokeFor(token, "user01", "mdm"))
+
+	_, next, err := svc.Rotate(token, "wallet")
+	assert.NoError(err)
+
+	assert.NoError(svc.RevokeFor(next, "user01", "wallet"))
+
+	_, _, err = svc.Rotate(next, "wallet")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+}
@@ -0,0 +1,51 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type RevokeRequest struct {
+	ID        string
+	Subject   string
+	ExpiresAt time.Time
+}
+
+func RevokeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(RevokeRequest)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		err := svc.Revoke(req.ID, req.Subject, req.ExpiresAt)
+		return nil, err
+	}
+}
+
+func RevokeAllEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		subject, ok := request.(string)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		err := svc.RevokeAll(subject)
+		return nil, err
+	}
+}
+
+func ApplyEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		r, ok := request.(*Revocation)
+		if !ok {
+			return nil, errors.New("invalid type")
+		}
+
+		err := svc.Apply(r)
+		return nil, err
+	}
+}
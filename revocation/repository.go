@@ -0,0 +1,36 @@
+package revocation
+
+import "time"
+
+// Topic is where revocations are broadcast so every instance agrees.
+const Topic = "identity.revocations"
+
+// Revocation denies one access token by its ID (jti), or, without an ID,
+// every token of Subject issued up to IssuedBefore.
+type Revocation struct {
+	ID           string    `json:"jti,omitempty"`
+	Subject      string    `json:"sub"`
+	IssuedBefore time.Time `json:"issued_before,omitzero"`
+	ExpiresAt    time.Time `json:"expires_at"` // no token it covers outlives this
+}
+
+func (r *Revocation) EventName() string {
+	return "token_revoked"
+}
+
+func (r *Revocation) Topic() string {
+	return Topic
+}
+
+// Store is the denylist. Add must be idempotent: an instance may apply a
+// revocation it already holds, from the bus or a shared database.
+type Store interface {
+	// Command
+	Add(r *Revocation) error
+
+	// Query
+	Revoked(id string, subject string, issuedAt time.Time) (bool, error)
+
+	// Close the store
+	Close() error
+}
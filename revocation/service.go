@@ -0,0 +1,79 @@
+package revocation
+
+import (
+	"errors"
+	"time"
+
+	"github.com/flarexio/core/events"
+)
+
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Service revokes access tokens before their exp. Revocations are applied
+// locally first, then published on Topic for the other instances to Apply.
+type Service interface {
+	Revoke(id string, subject string, expiresAt time.Time) error
+	RevokeAll(subject string) error
+	Apply(r *Revocation) error
+	Revoked(id string, subject string, issuedAt time.Time) bool
+}
+
+// NewService takes the access token lifetime, which bounds how long a
+// revoke-all has to be remembered.
+func NewService(store Store, lifetime time.Duration) Service {
+	return &service{store, lifetime}
+}
+
+type service struct {
+	store    Store
+	lifetime time.Duration
+}
+
+func (svc *service) Revoke(id string, subject string, expiresAt time.Time) error {
+	if id == "" {
+		return errors.New("token id required")
+	}
+
+	return svc.publish(&Revocation{
+		ID:        id,
+		Subject:   subject,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (svc *service) RevokeAll(subject string) error {
+	if subject == "" {
+		return errors.New("subject required")
+	}
+
+	now := time.Now()
+	return svc.publish(&Revocation{
+		Subject:      subject,
+		IssuedBefore: now,
+		ExpiresAt:    now.Add(svc.lifetime),
+	})
+}
+
+func (svc *service) publish(r *Revocation) error {
+	if err := svc.store.Add(r); err != nil {
+		return err
+	}
+
+	es := events.NewEventStore()
+	es.AddEvent(r)
+	return es.Notify()
+}
+
+func (svc *service) Apply(r *Revocation) error {
+	return svc.store.Add(r)
+}
+
+// Revoked fails closed: a denylist we cannot read denies everything.
+func (svc *service) Revoked(id string, subject string, issuedAt time.Time) bool {
+	revoked, err := svc.store.Revoked(id, subject, issuedAt)
+	if err != nil {
+		return true
+	}
+
+	return revoked
+}
@@ -0,0 +1,82 @@
+package revocation_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/core/events"
+	"github.com/flarexio/core/pubsub"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/revocation"
+)
+
+func TestRevoke(t *testing.T) {
+	assert := assert.New(t)
+
+	ps := pubsub.NewSimplePubSub()
+	events.ReplaceGlobals(ps)
+
+	// A second instance that only learns about revocations from the bus.
+	peerStore, _ := inmem.NewRevocationStore()
+	defer peerStore.Close()
+
+	peer := revocation.NewService(peerStore, time.Hour)
+
+	received := make(chan struct{}, 1)
+	ps.Subscribe(revocation.Topic, func(ctx context.Context, msg *pubsub.Message) error {
+		var r *revocation.Revocation
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			return err
+		}
+
+		defer func() { received <- struct{}{} }()
+		return peer.Apply(r)
+	})
+
+	store, _ := inmem.NewRevocationStore()
+	defer store.Close()
+
+	svc := revocation.NewService(store, time.Hour)
+
+	now := time.Now()
+	err := svc.Revoke("token01", "user01", now.Add(time.Hour))
+	assert.NoError(err)
+
+	assert.True(svc.Revoked("token01", "user01", now))
+	assert.False(svc.Revoked("token02", "user01", now))
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		assert.Fail("expected revocation to be published")
+		return
+	}
+
+	assert.True(peer.Revoked("token01", "user01", now))
+}
+
+func TestRevokeAll(t *testing.T) {
+	assert := assert.New(t)
+
+	events.ReplaceGlobals(pubsub.NewSimplePubSub())
+
+	store, _ := inmem.NewRevocationStore()
+	defer store.Close()
+
+	svc := revocation.NewService(store, time.Hour)
+
+	issuedAt := time.Now().Add(-time.Minute)
+
+	err := svc.RevokeAll("user01")
+	assert.NoError(err)
+
+	assert.True(svc.Revoked("token01", "user01", issuedAt))
+	assert.False(svc.Revoked("token01", "user02", issuedAt))
+
+	// Tokens issued after the revocation are fine again.
+	assert.False(svc.Revoked("token02", "user01", time.Now().Add(2*time.Second)))
+}
@@ -2,18 +2,22 @@ package identity
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/go-webauthn/webauthn/protocol"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"google.golang.org/api/idtoken"
 
-	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/lockout"
+	"github.com/flarexio/identity/otp"
 	"github.com/flarexio/identity/passkeys"
+	"github.com/flarexio/identity/ticket"
+	"github.com/flarexio/identity/totp"
 	"github.com/flarexio/identity/user"
+	"github.com/flarexio/identity/verification"
 )
 
 var (
@@ -22,17 +26,124 @@ var (
 	ErrEmailNotFound        = errors.New("email not found")
 	ErrNameNotFound         = errors.New("name not found")
 	ErrPictureNotFound      = errors.New("picture not found")
+	ErrSecondFactorRequired = errors.New("second factor required")
+	ErrSecondFactorInvalid  = errors.New("second factor invalid")
+	ErrLinkRequired         = errors.New("link required")
+	ErrLinkInvalid          = errors.New("link invalid")
+	ErrCredentialInvalid    = errors.New("credential invalid")
 )
 
+const (
+	// mfaTicketTTL bounds how long a first-factor sign-in waits for its TOTP code.
+	mfaTicketTTL = 5 * time.Minute
+
+	// linkTicketTTL bounds how long a sign-in waits for the user to prove
+	// they own the account it is to be linked to.
+	linkTicketTTL = 10 * time.Minute
+
+	// usernameGracePeriod holds a former username back from everybody but
+	// its last owner, so links and mentions do not reach somebody else.
+	usernameGracePeriod = 30 * 24 * time.Hour
+
+	// projectionAttempts bounds how often an event handler starts over
+	// after another writer stored the same user first.
+	projectionAttempts = 5
+)
+
+// UserChanges lists the fields UpdateUser changes; nil leaves one as it is.
+type UserChanges struct {
+	Username *string
+	Name     *string
+	Email    *string // takes effect once verified through VerifyEmail
+	Avatar   *string
+}
+
+// SecondFactorRequiredError is returned by SignIn when the user has TOTP
+// enabled; the ticket is exchanged through VerifySecondFactor.
+type SecondFactorRequiredError struct {
+	Ticket    string
+	ExpiredAt time.Time
+}
+
+func (e *SecondFactorRequiredError) Error() string {
+	return ErrSecondFactorRequired.Error()
+}
+
+func (e *SecondFactorRequiredError) Unwrap() error {
+	return ErrSecondFactorRequired
+}
+
+// LinkRequiredError is returned by SignIn, under the prompt link policy,
+// for an unknown social account whose email belongs to a user; the ticket
+// is exchanged through CompleteLink.
+type LinkRequiredError struct {
+	Ticket    string
+	ExpiredAt time.Time
+}
+
+func (e *LinkRequiredError) Error() string {
+	return ErrLinkRequired.Error()
+}
+
+func (e *LinkRequiredError) Unwrap() error {
+	return ErrLinkRequired
+}
+
+// Lockouts track failed attempts per user and per client IP.
+type Lockouts struct {
+	Users lockout.Service
+	IPs   lockout.Service
+}
+
+func userLockoutKey(u *user.User) string {
+	return "user:" + u.ID.String()
+}
+
+// otpLockoutKey keeps email code failures apart from sign-in: the codes
+// are verified without authentication, so anyone could run them up.
+func otpLockoutKey(u *user.User) string {
+	return "otp:" + u.ID.String()
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// pendingLink is what a link ticket stands for: the social account to be
+// linked, and the user it is to be linked to.
+type pendingLink struct {
+	UserID   string              `json:"user_id"`
+	Provider user.SocialProvider `json:"provider"`
+	SocialID user.SocialID       `json:"social_id"`
+}
+
+// linkTicketPrefix keeps link tickets apart from second factor tickets,
+// which share the store.
+const linkTicketPrefix = "link:"
+
 type Service interface {
 	Register(username string, name string, email string) (*user.User, error)
+	SendOTP(username string) error
 	OTPVerify(otp string, username string) (*user.User, error)
 	SignIn(ctx context.Context, credential string, provider user.SocialProvider) (*user.User, error)
-	AddSocialAccount(credential string, provider user.SocialProvider, username string) (*user.User, error)
+	VerifySecondFactor(ticket string, code string) (*user.User, error)
+	CompleteLink(ctx context.Context, ticket string, credential string, provider user.SocialProvider, code string) (*user.User, error)
+	EnrollTOTP(username string) (*totp.Key, error)
+	ConfirmTOTP(username string, code string) ([]string, error)
+	DisableTOTP(username string, code string) error
+	AddSocialAccount(ctx context.Context, credential string, provider user.SocialProvider, username string) (*user.User, error)
 	RemoveSocialAccount(provider user.SocialProvider, socialID user.SocialID, username string) (*user.User, error)
 	RegisterPasskey(username string) (*protocol.CredentialCreation, error)
+	UpdateUser(username string, changes UserChanges) (*user.User, error)
+	VerifyEmail(username string, otp string) (*user.User, error)
+	SendEmailVerification(username string) error
+	ConfirmEmailVerification(token string) (*user.User, error)
 	User(username string) (*user.User, error)
-	UserBySocialID(socialID user.SocialID) (*user.User, error)
+	Users(q *user.Query) (*user.Page, error)
+	SearchUsers(query string, limit int) ([]*user.User, error)
+	UserBySocialAccount(provider user.SocialProvider, socialID user.SocialID) (*user.User, error)
+	LockUser(username string, reason string) (*user.User, error)
+	UnlockUser(username string) (*user.User, error)
 	DeleteUser(username string) error
 	Handler() (EventHandler, error)
 }
@@ -43,386 +154,1200 @@ type EventHandler interface {
 	UserSocialAccountAddedHandler(e *user.UserSocialAccountAddedEvent) error
 	UserSocialAccountRemovedHandler(e *user.UserSocialAccountRemovedEvent) error
 	UserDeletedHandler(e *user.UserDeletedEvent) error
+	UserTOTPEnrolledHandler(e *user.UserTOTPEnrolledEvent) error
+	UserTOTPConfirmedHandler(e *user.UserTOTPConfirmedEvent) error
+	UserTOTPDisabledHandler(e *user.UserTOTPDisabledEvent) error
+	UserRecoveryCodeUsedHandler(e *user.UserRecoveryCodeUsedEvent) error
+	UserProfileUpdatedHandler(e *user.UserProfileUpdatedEvent) error
+	UserRenamedHandler(e *user.UserRenamedEvent) error
+	UserEmailChangeRequestedHandler(e *user.UserEmailChangeRequestedEvent) error
+	UserEmailChangedHandler(e *user.UserEmailChangedEvent) error
+	UserEmailVerifiedHandler(e *user.UserEmailVerifiedEvent) error
+	UserLockedHandler(e *user.UserLockedEvent) error
+	UserUnlockedHandler(e *user.UserUnlockedEvent) error
 }
 
 type ServiceMiddleware func(Service) Service
 
-func NewService(users user.Repository, passkeys passkeys.Service, cfg conf.Providers) Service {
-	return &service{cfg, users, passkeys}
+func NewService(users user.Repository, search user.SearchIndex, reservations user.ReservationStore, otps otp.Service, verifications verification.Service, totps totp.Service, tickets ticket.Store, passkeys passkeys.Service, providers *ProviderRegistry, sync user.ProfilePolicy, linking user.LinkPolicy, lockouts Lockouts) Service {
+	return &service{users, search, reservations, otps, verifications, totps, tickets, passkeys, providers, sync, linking, lockouts}
 }
 
 type service struct {
-	cfg      conf.Providers
-	users    user.Repository
-	passkeys passkeys.Service
+	users         user.Repository
+	search        user.SearchIndex
+	reservations  user.ReservationStore
+	otps          otp.Service
+	verifications verification.Service
+	totps         totp.Service
+	tickets       ticket.Store
+	passkeys      passkeys.Service
+	providers     *ProviderRegistry
+	sync          user.ProfilePolicy
+	linking       user.LinkPolicy
+	lockouts      Lockouts
 }
 
 func (svc *service) Register(username string, name string, email string) (*user.User, error) {
-	// Ensure username is unique
-	_, err := svc.users.FindByUsername(username)
-	if err == nil {
-		return nil, errors.New("user exists")
+	username = user.NormalizeUsername(username)
+	if err := user.ValidateUsername(username); err != nil {
+		return nil, err
 	}
 
-	if !errors.Is(err, user.ErrUserNotFound) {
+	email, err := user.NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = username
+	}
+
+	if err := svc.usernameAvailable(username, nil); err != nil {
 		return nil, err
 	}
 
 	u := user.NewUser(username, name, email)
+	u.Register()
 	defer u.Notify()
 
 	return u, nil
 }
 
-func (svc *service) OTPVerify(otp string, username string) (*user.User, error) {
+func (svc *service) SendOTP(username string) error {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if u.Email == "" {
+		return ErrEmailNotFound
+	}
+
+	return svc.otps.Issue(u.ID.String(), u.Email)
+}
+
+func (svc *service) OTPVerify(code string, username string) (*user.User, error) {
 	u, err := svc.users.FindByUsername(username)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: otp verify
-	u.Activate()
+	// Only an admin lifts a lock.
+	if u.Status == user.Locked {
+		return nil, user.ErrUserLocked
+	}
+
+	key := otpLockoutKey(u)
+	if err := svc.lockouts.Users.Check(key); err != nil {
+		return nil, err
+	}
+
+	if err := svc.otps.Verify(u.ID.String(), code); err != nil {
+		if errors.Is(err, otp.ErrCodeInvalid) {
+			svc.lockouts.Users.Fail(key)
+		}
+
+		return nil, err
+	}
+
+	svc.lockouts.Users.Reset(key)
+
+	if u.Status == user.Registered {
+		u.Activate()
+	}
+
+	// The code went to the address, so it is proven as well.
+	if !u.EmailVerified {
+		u.VerifyEmail()
+	}
+
 	defer u.Notify()
 
 	return u, nil
 }
 
 func (svc *service) SignIn(ctx context.Context, credential string, provider user.SocialProvider) (*user.User, error) {
-	switch provider {
-	case user.GOOGLE:
-		return svc.signInWithGoogle(ctx, credential)
-
-	case user.LINE:
-		return svc.signInWithLINE(ctx, credential)
+	ip, _ := ctx.Value(user.ClientIP).(string)
+	if ip != "" {
+		if err := svc.lockouts.IPs.Check(ipLockoutKey(ip)); err != nil {
+			return nil, err
+		}
+	}
 
-	case user.PASSKEYS:
-		return svc.signInWithPasskeys(credential)
+	u, err := svc.signIn(ctx, credential, provider)
+	if err != nil {
+		if ip != "" && errors.Is(err, ErrCredentialInvalid) {
+			svc.lockouts.IPs.Fail(ipLockoutKey(ip))
+		}
 
-	default:
-		return nil, ErrProviderNotSupported
+		return nil, err
 	}
-}
 
-func (svc *service) signInWithGoogle(ctx context.Context, token string) (*user.User, error) {
-	audience := svc.cfg.Google.Client.ID
-	if audience == "" {
-		return nil, ErrAudienceNotFound
+	if !u.TOTPEnabled() {
+		return u, nil
 	}
 
-	payload, err := idtoken.Validate(ctx, token, audience)
+	t, err := ticket.Generate()
 	if err != nil {
 		return nil, err
 	}
 
-	socialID := user.SocialID(payload.Subject)
+	if err := svc.tickets.Save(t, u.ID.String(), mfaTicketTTL); err != nil {
+		return nil, err
+	}
+
+	return nil, &SecondFactorRequiredError{
+		Ticket:    t,
+		ExpiredAt: time.Now().Add(mfaTicketTTL),
+	}
+}
+
+func (svc *service) signIn(ctx context.Context, credential string, provider user.SocialProvider) (*user.User, error) {
+	p, err := svc.providers.Provider(provider)
+	if err != nil {
+		return nil, err
+	}
 
-	u, err := svc.users.FindBySocialID(socialID)
+	identity, err := p.Verify(ctx, credential)
 	if err != nil {
-		if !errors.Is(err, user.ErrUserNotFound) {
+		return nil, errors.Join(ErrCredentialInvalid, err)
+	}
+
+	socialID := user.SocialID(identity.Subject)
+
+	// Emails are kept normalized; one that does not parse is as good as none.
+	email, _ := user.NormalizeEmail(identity.Email)
+
+	u, err := svc.users.FindBySocialAccount(provider, socialID)
+	if err == nil {
+		if err := svc.checkSignIn(u); err != nil {
 			return nil, err
 		}
 
-		// New User
-		email, ok := payload.Claims["email"].(string)
-		if !ok {
-			return nil, ErrEmailNotFound
+		// Keep the profile in step with the provider.
+		incoming := user.Profile{
+			Name:   identity.Name,
+			Email:  email,
+			Avatar: identity.Picture,
 		}
 
-		name, ok := payload.Claims["name"].(string)
-		if !ok {
-			return nil, ErrNameNotFound
+		u.UpdateProfile(svc.sync.Merge(u.Profile(), incoming))
+
+		if identity.EmailVerified && email != "" && email == u.Email && !u.EmailVerified {
+			u.VerifyEmail()
 		}
 
-		username := strings.Split(email, "@")[0]
+		defer u.Notify()
+
+		return u, nil
+	}
+
+	if !errors.Is(err, user.ErrUserNotFound) {
+		return nil, err
+	}
+
+	// New User; providers that share no email cannot register one.
+	if email == "" {
+		return nil, err
+	}
+
+	// Unless the email leads to a user the account belongs to.
+	existing, err := svc.linkCandidate(email)
+	if err != nil {
+		return nil, err
+	}
 
-		// Ensure username is unique
-		_, err := svc.users.FindByUsername(username)
-		if err == nil {
-			username = username + "." + uuid.NewString()[:8]
-		} else if !errors.Is(err, user.ErrUserNotFound) {
+	if existing != nil {
+		if err := svc.checkSignIn(existing); err != nil {
 			return nil, err
 		}
 
-		u = user.NewUser(username, name, email)
+		switch svc.linking {
+		case user.LinkVerified:
+			if identity.EmailVerified && existing.HasVerifiedEmail(email) {
+				existing.AddSocialAccount(provider, socialID)
+				defer existing.Notify()
 
-		picture, ok := payload.Claims["picture"].(string)
-		if ok {
-			u.Avatar = picture
+				return existing, nil
+			}
+
+		case user.LinkPrompt:
+			return nil, svc.promptLink(existing, provider, socialID)
 		}
+	}
 
-		u.Register()
-		u.Activate()
-		u.AddSocialAccount(user.GOOGLE, socialID)
+	username, err := svc.usernameFor(email)
+	if err != nil {
+		return nil, err
+	}
 
-		defer u.Notify()
+	name := identity.Name
+	if name == "" {
+		name = username
 	}
 
-	// TODO: check if user exists and update from google
+	u = user.NewUser(username, name, email)
+	u.Avatar = identity.Picture
+	u.EmailVerified = identity.EmailVerified
+
+	u.Register()
+	u.Activate()
+	u.AddSocialAccount(provider, socialID)
+
+	defer u.Notify()
 
 	return u, nil
 }
 
-type LINEClaims struct {
-	jwt.RegisteredClaims
-	Nonce   string `json:"nonce"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
-	Email   string `json:"email"`
-}
+func (svc *service) VerifySecondFactor(t string, code string) (*user.User, error) {
+	subject, err := svc.tickets.Consume(t)
+	if err != nil {
+		return nil, err
+	}
 
-func (svc *service) signInWithLINE(ctx context.Context, token string) (*user.User, error) {
-	cfg := svc.cfg.LINE
+	id, err := user.ParseID(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := svc.users.Find(id)
+	if err != nil {
+		return nil, err
+	}
 
-	audience := cfg.Channel.ID
-	if audience == "" {
-		return nil, ErrAudienceNotFound
+	if err := svc.checkSignIn(u); err != nil {
+		return nil, err
 	}
 
-	keyFn := func(t *jwt.Token) (any, error) {
-		secret := []byte(cfg.Channel.Secret)
-		return secret, nil
+	if !u.TOTPEnabled() {
+		return nil, user.ErrTOTPNotEnrolled
 	}
 
-	var claims LINEClaims
-	if _, err := jwt.ParseWithClaims(token, &claims, keyFn,
-		jwt.WithIssuer("https://access.line.me"),
-		jwt.WithAudience(audience),
-		jwt.WithLeeway(10*time.Second),
-	); err != nil {
+	if err := svc.verifySecondFactor(u, code); err != nil {
 		return nil, err
 	}
 
-	nonce, ok := ctx.Value(user.Nonce).(string)
-	if !ok || (nonce != claims.Nonce) {
-		return nil, errors.New("invalid nonce")
+	return u, nil
+}
+
+// checkSignIn tells whether the user may sign in at all: only activated
+// users not locked out for failing too often may.
+func (svc *service) checkSignIn(u *user.User) error {
+	if err := u.CheckActive(); err != nil {
+		return err
 	}
 
-	socialID := user.SocialID(claims.Subject)
+	return svc.lockouts.Users.Check(userLockoutKey(u))
+}
 
-	u, err := svc.users.FindBySocialID(socialID)
-	if err != nil {
-		if !errors.Is(err, user.ErrUserNotFound) {
-			return nil, err
+// verifySecondFactor is verifyTOTP counting failures against the user.
+func (svc *service) verifySecondFactor(u *user.User, code string) error {
+	key := userLockoutKey(u)
+
+	if err := svc.verifyTOTP(u, code); err != nil {
+		if errors.Is(err, ErrSecondFactorInvalid) {
+			svc.lockouts.Users.Fail(key)
 		}
 
-		username := strings.Split(claims.Email, "@")[0]
+		return err
+	}
 
-		// Ensure username is unique
-		_, err := svc.users.FindByUsername(username)
-		if err == nil {
-			username = username + "." + uuid.NewString()[:8]
-		} else if !errors.Is(err, user.ErrUserNotFound) {
-			return nil, err
-		}
+	return svc.lockouts.Users.Reset(key)
+}
 
-		u = user.NewUser(username, claims.Name, claims.Email)
-		u.Avatar = claims.Picture
+// linkCandidate returns the user a new social account with the given
+// email, normalized, may be linked to, if any. Emails are not unique; a
+// user who verified it has the better claim.
+func (svc *service) linkCandidate(email string) (*user.User, error) {
+	if svc.linking == user.LinkNever {
+		return nil, nil
+	}
 
-		u.Register()
-		u.Activate()
-		u.AddSocialAccount(user.LINE, socialID)
+	users, err := svc.users.FindByEmail(email)
+	if err != nil {
+		return nil, err
+	}
 
-		defer u.Notify()
+	var candidate *user.User
+	for _, u := range users {
+		// Nobody can prove they own an account never activated.
+		if u.Status != user.Activated && u.Status != user.Locked {
+			continue
+		}
+
+		if u.HasVerifiedEmail(email) {
+			return u, nil
+		}
+
+		if candidate == nil {
+			candidate = u
+		}
 	}
 
-	return u, nil
+	return candidate, nil
 }
 
-func (svc *service) signInWithPasskeys(signed string) (*user.User, error) {
-	token, err := svc.passkeys.VerifyToken(signed)
+func (svc *service) promptLink(u *user.User, provider user.SocialProvider, socialID user.SocialID) error {
+	t, err := ticket.Generate()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	subject, err := token.Claims.GetSubject()
+	subject, err := json.Marshal(&pendingLink{
+		UserID:   u.ID.String(),
+		Provider: provider,
+		SocialID: socialID,
+	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := svc.tickets.Save(t, linkTicketPrefix+string(subject), linkTicketTTL); err != nil {
+		return err
 	}
 
-	socialID := user.SocialID(subject)
-	return svc.users.FindBySocialID(socialID)
+	return &LinkRequiredError{
+		Ticket:    t,
+		ExpiredAt: time.Now().Add(linkTicketTTL),
+	}
 }
 
-func (svc *service) AddSocialAccount(credential string, provider user.SocialProvider, username string) (*user.User, error) {
-	u, err := svc.users.FindByUsername(username)
+// CompleteLink links the social account a link ticket stands for, once the
+// user signs in to the existing account with another of its providers, and
+// with a TOTP code if they enabled it. A missing code leaves the ticket
+// unused.
+func (svc *service) CompleteLink(ctx context.Context, t string, credential string, provider user.SocialProvider, code string) (*user.User, error) {
+	p, err := svc.providers.Provider(provider)
 	if err != nil {
 		return nil, err
 	}
 
-	var subject string
-	switch provider {
-	case user.GOOGLE:
-		audience := svc.cfg.Google.Client.ID
-		if audience == "" {
-			return nil, ErrAudienceNotFound
-		}
-
-		ctx := context.Background()
-		payload, err := idtoken.Validate(ctx, credential, audience)
-		if err != nil {
+	ip, _ := ctx.Value(user.ClientIP).(string)
+	if ip != "" {
+		if err := svc.lockouts.IPs.Check(ipLockoutKey(ip)); err != nil {
 			return nil, err
 		}
+	}
 
-		subject = payload.Subject
+	identity, err := p.Verify(ctx, credential)
+	if err != nil {
+		if ip != "" {
+			svc.lockouts.IPs.Fail(ipLockoutKey(ip))
+		}
 
-	case user.LINE:
-		cfg := svc.cfg.LINE
+		return nil, errors.Join(ErrCredentialInvalid, err)
+	}
 
-		audience := cfg.Channel.ID
-		if audience == "" {
-			return nil, ErrAudienceNotFound
+	u, err := svc.users.FindBySocialAccount(provider, user.SocialID(identity.Subject))
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, ErrLinkInvalid
 		}
 
-		keyFn := func(t *jwt.Token) (any, error) {
-			secret := []byte(cfg.Channel.Secret)
-			return secret, nil
-		}
+		return nil, err
+	}
 
-		var claims LINEClaims
-		if _, err := jwt.ParseWithClaims(credential, &claims, keyFn,
-			jwt.WithIssuer("https://access.line.me"),
-			jwt.WithAudience(audience),
-			jwt.WithLeeway(10*time.Second),
-		); err != nil {
-			return nil, err
-		}
+	if err := svc.checkSignIn(u); err != nil {
+		return nil, err
+	}
 
-		subject = claims.Subject
+	if u.TOTPEnabled() && code == "" {
+		return nil, ErrSecondFactorRequired
+	}
 
-	case user.PASSKEYS:
-		token, err := svc.passkeys.VerifyToken(credential)
-		if err != nil {
-			return nil, err
-		}
+	subject, err := svc.tickets.Consume(t)
+	if err != nil {
+		return nil, err
+	}
 
-		sub, err := token.Claims.GetSubject()
-		if err != nil {
-			return nil, err
-		}
+	subject, ok := strings.CutPrefix(subject, linkTicketPrefix)
+	if !ok {
+		return nil, ticket.ErrTicketInvalid
+	}
 
-		subject = sub
+	var link pendingLink
+	if err := json.Unmarshal([]byte(subject), &link); err != nil {
+		return nil, ticket.ErrTicketInvalid
+	}
 
-	default:
-		return nil, ErrProviderNotSupported
+	if link.UserID != u.ID.String() {
+		return nil, ErrLinkInvalid
 	}
 
-	socialID := user.SocialID(subject)
-	_, err = svc.users.FindBySocialID(socialID)
-	if err == nil {
-		return nil, errors.New("account exists")
+	if u.TOTPEnabled() {
+		if err := svc.verifySecondFactor(u, code); err != nil {
+			return nil, err
+		}
 	}
 
-	u.AddSocialAccount(provider, socialID)
+	// Somebody may have signed in with the account in the meantime.
+	if _, err := svc.users.FindBySocialAccount(link.Provider, link.SocialID); err == nil {
+		return nil, user.ErrSocialAccountExists
+	}
+
+	u.AddSocialAccount(link.Provider, link.SocialID)
 	defer u.Notify()
 
 	return u, nil
 }
 
-func (svc *service) RemoveSocialAccount(provider user.SocialProvider, socialID user.SocialID, username string) (*user.User, error) {
-	u, err := svc.users.FindByUsername(username)
+// verifyTOTP accepts either a current TOTP code or an unused recovery code,
+// burning the latter.
+func (svc *service) verifyTOTP(u *user.User, code string) error {
+	err := svc.totps.Validate(u.TOTP.Secret, code)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, totp.ErrCodeInvalid) {
+		return err
+	}
+
+	hash, err := svc.totps.HashRecoveryCode(code)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	u.RemoveSocialAccount(provider, socialID)
-	defer u.Notify()
+	if err := u.UseRecoveryCode(hash); err != nil {
+		return ErrSecondFactorInvalid
+	}
 
-	return u, nil
+	return u.Notify()
 }
 
-func (svc *service) RegisterPasskey(username string) (*protocol.CredentialCreation, error) {
+func (svc *service) EnrollTOTP(username string) (*totp.Key, error) {
 	u, err := svc.users.FindByUsername(username)
 	if err != nil {
 		return nil, err
 	}
 
-	userID := uuid.New()
+	if u.TOTPEnabled() {
+		return nil, user.ErrTOTPAlreadyEnabled
+	}
 
-	return svc.passkeys.InitializeRegistration(userID.String(), u.Username)
-}
+	key, err := svc.totps.Generate(u.Username)
+	if err != nil {
+		return nil, err
+	}
 
-func (svc *service) User(username string) (*user.User, error) {
-	return svc.users.FindByUsername(username)
-}
+	if err := u.EnrollTOTP(key.Sealed); err != nil {
+		return nil, err
+	}
+	defer u.Notify()
 
-func (svc *service) UserBySocialID(socialID user.SocialID) (*user.User, error) {
-	return svc.users.FindBySocialID(socialID)
+	return key, nil
 }
 
-func (svc *service) DeleteUser(username string) error {
+func (svc *service) ConfirmTOTP(username string, code string) ([]string, error) {
 	u, err := svc.users.FindByUsername(username)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	u.Delete()
-	defer u.Notify()
-
-	return nil
-}
+	if u.TOTP == nil {
+		return nil, user.ErrTOTPNotEnrolled
+	}
 
-func (svc *service) Handler() (EventHandler, error) {
-	return svc, nil
-}
+	if u.TOTP.Enabled {
+		return nil, user.ErrTOTPAlreadyEnabled
+	}
 
-func (svc *service) UserRegisteredHandler(e *user.UserRegisteredEvent) error {
-	return svc.users.Store(&e.User)
-}
+	if err := svc.totps.Validate(u.TOTP.Secret, code); err != nil {
+		return nil, err
+	}
 
-func (svc *service) UserActivatedHandler(e *user.UserActivatedEvent) error {
-	u, err := svc.users.Find(e.UserID)
+	codes, hashes, err := svc.totps.RecoveryCodes()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	u.Status = e.Status
-	u.UpdatedAt = e.OccuredAt
+	if err := u.ConfirmTOTP(hashes); err != nil {
+		return nil, err
+	}
+	defer u.Notify()
 
-	return svc.users.Store(u)
+	return codes, nil
 }
 
-func (svc *service) UserSocialAccountAddedHandler(e *user.UserSocialAccountAddedEvent) error {
-	u, err := svc.users.Find(e.UserID)
+func (svc *service) DisableTOTP(username string, code string) error {
+	u, err := svc.users.FindByUsername(username)
 	if err != nil {
 		return err
 	}
 
-	u.Accounts = append(u.Accounts, &e.Account)
-	u.UpdatedAt = e.OccuredAt
+	if u.TOTP == nil {
+		return user.ErrTOTPNotEnrolled
+	}
 
-	return svc.users.Store(u)
-}
+	// A pending enrollment can be dropped freely; an active one needs proof.
+	if u.TOTP.Enabled {
+		if err := svc.verifyTOTP(u, code); err != nil {
+			return err
+		}
+	}
 
-func (svc *service) UserSocialAccountRemovedHandler(e *user.UserSocialAccountRemovedEvent) error {
-	u, err := svc.users.Find(e.UserID)
-	if err != nil {
+	if err := u.DisableTOTP(); err != nil {
 		return err
 	}
 
-	var accounts []*user.SocialAccount
-	for _, a := range u.Accounts {
-		if a.Provider == e.Account.Provider && a.SocialID == e.Account.SocialID {
-			continue
+	return u.Notify()
+}
+
+func (svc *service) AddSocialAccount(ctx context.Context, credential string, provider user.SocialProvider, username string) (*user.User, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := svc.providers.Provider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := p.Verify(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	socialID := user.SocialID(identity.Subject)
+	_, err = svc.users.FindBySocialAccount(provider, socialID)
+	if err == nil {
+		return nil, user.ErrSocialAccountExists
+	}
+
+	u.AddSocialAccount(provider, socialID)
+	defer u.Notify()
+
+	return u, nil
+}
+
+func (svc *service) RemoveSocialAccount(provider user.SocialProvider, socialID user.SocialID, username string) (*user.User, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	u.RemoveSocialAccount(provider, socialID)
+	defer u.Notify()
+
+	return u, nil
+}
+
+func (svc *service) RegisterPasskey(username string) (*protocol.CredentialCreation, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := uuid.New()
+
+	return svc.passkeys.InitializeRegistration(userID.String(), u.Username)
+}
+
+// usernameFor derives a username from the local part of an email, held to
+// the same rules as one chosen at registration. One taken, reserved or
+// invalid gets a random suffix, or a generic stem when even that would
+// not be valid.
+func (svc *service) usernameFor(email string) (string, error) {
+	username := user.NormalizeUsername(strings.Split(email, "@")[0])
+
+	err := user.ValidateUsername(username)
+	if err == nil {
+		err = svc.usernameAvailable(username, nil)
+	}
+
+	switch {
+	case err == nil:
+		return username, nil
+
+	case errors.Is(err, user.ErrUserExists),
+		errors.Is(err, user.ErrUsernameReserved),
+		errors.Is(err, user.ErrUsernameInvalid):
+
+	default:
+		return "", err
+	}
+
+	suffix := uuid.NewString()[:8]
+
+	candidate := username + "." + suffix
+	if user.ValidateUsername(candidate) != nil {
+		candidate = "user." + suffix
+	}
+
+	return candidate, nil
+}
+
+// usernameAvailable tells whether a username is free to take, for the user
+// with the given ID if any: a user may take back their own former name.
+func (svc *service) usernameAvailable(username string, id *user.UserID) error {
+	_, err := svc.users.FindByUsername(username)
+	if err == nil {
+		return user.ErrUserExists
+	}
+
+	if !errors.Is(err, user.ErrUserNotFound) {
+		return err
+	}
+
+	r, err := svc.reservations.Find(username)
+	if err != nil {
+		if errors.Is(err, user.ErrReservationNotFound) {
+			return nil
 		}
 
-		accounts = append(accounts, a)
+		return err
 	}
 
-	u.Accounts = accounts
-	u.UpdatedAt = e.OccuredAt
+	if id == nil || r.UserID != *id {
+		return user.ErrUsernameReserved
+	}
 
-	return svc.users.Store(u)
+	return nil
 }
 
-func (svc *service) UserDeletedHandler(e *user.UserDeletedEvent) error {
-	u, err := svc.users.Find(e.UserID)
+func (svc *service) UpdateUser(username string, changes UserChanges) (*user.User, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := u.Profile()
+
+	if changes.Name != nil {
+		name := strings.TrimSpace(*changes.Name)
+		if name == "" {
+			return nil, user.ErrNameInvalid
+		}
+
+		profile.Name = name
+	}
+
+	if changes.Avatar != nil {
+		avatar := strings.TrimSpace(*changes.Avatar)
+		if err := user.ValidateAvatar(avatar); err != nil {
+			return nil, err
+		}
+
+		profile.Avatar = avatar
+	}
+
+	var newUsername string
+	if changes.Username != nil {
+		newUsername = user.NormalizeUsername(*changes.Username)
+		if newUsername == u.Username {
+			newUsername = ""
+		}
+	}
+
+	if newUsername != "" {
+		if err := user.ValidateUsername(newUsername); err != nil {
+			return nil, err
+		}
+
+		if err := svc.usernameAvailable(newUsername, &u.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	var newEmail string
+	if changes.Email != nil {
+		email, err := user.NormalizeEmail(*changes.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		if email != u.Email && email != u.PendingEmail {
+			newEmail = email
+		}
+	}
+
+	// All validated; only now does anything change.
+	if newEmail != "" {
+		if err := svc.otps.Issue(emailSubject(u), newEmail); err != nil {
+			return nil, err
+		}
+
+		u.RequestEmailChange(newEmail)
+	}
+
+	if newUsername != "" {
+		u.Rename(newUsername)
+	}
+
+	u.UpdateProfile(profile)
+	defer u.Notify()
+
+	return u, nil
+}
+
+// emailSubject keeps email change codes apart from the activation code.
+func emailSubject(u *user.User) string {
+	return u.ID.String() + ":email"
+}
+
+func (svc *service) VerifyEmail(username string, otp string) (*user.User, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.PendingEmail == "" {
+		return nil, user.ErrEmailChangeNotRequested
+	}
+
+	if err := svc.otps.Verify(emailSubject(u), otp); err != nil {
+		return nil, err
+	}
+
+	if err := u.ConfirmEmailChange(); err != nil {
+		return nil, err
+	}
+
+	defer u.Notify()
+
+	return u, nil
+}
+
+// SendEmailVerification mails the user a link that proves their current
+// email address.
+func (svc *service) SendEmailVerification(username string) error {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if u.Email == "" {
+		return ErrEmailNotFound
+	}
+
+	if u.EmailVerified {
+		return user.ErrEmailAlreadyVerified
+	}
+
+	return svc.verifications.Issue(u.ID.String(), u.Email)
+}
+
+func (svc *service) ConfirmEmailVerification(token string) (*user.User, error) {
+	subject, email, err := svc.verifications.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := user.ParseID(subject)
+	if err != nil {
+		return nil, verification.ErrTokenInvalid
+	}
+
+	u, err := svc.users.Find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// A link sent before the email changed proves nothing about the new one.
+	if u.Email != email {
+		return nil, verification.ErrTokenInvalid
+	}
+
+	if err := u.VerifyEmail(); err != nil {
+		return nil, err
+	}
+
+	defer u.Notify()
+
+	return u, nil
+}
+
+func (svc *service) User(username string) (*user.User, error) {
+	return svc.users.FindByUsername(username)
+}
+
+func (svc *service) Users(q *user.Query) (*user.Page, error) {
+	// Emails are stored normalized; the caller's query is left as it is.
+	normalized := *q
+	normalized.EmailPrefix = strings.ToLower(q.EmailPrefix)
+
+	return svc.users.Query(&normalized)
+}
+
+func (svc *service) SearchUsers(query string, limit int) ([]*user.User, error) {
+	q := &user.Query{Limit: limit}
+
+	ids, err := svc.search.Search(query, q.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*user.User, 0, len(ids))
+	for _, id := range ids {
+		u, err := svc.users.Find(id)
+		if err != nil {
+			// The index may lag behind a deletion.
+			if errors.Is(err, user.ErrUserNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
+func (svc *service) UserBySocialAccount(provider user.SocialProvider, socialID user.SocialID) (*user.User, error) {
+	return svc.users.FindBySocialAccount(provider, socialID)
+}
+
+func (svc *service) LockUser(username string, reason string) (*user.User, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.Lock(reason); err != nil {
+		return nil, err
+	}
+
+	defer u.Notify()
+
+	return u, nil
+}
+
+// UnlockUser lifts a lock by an admin and any lockout for failed attempts
+// alike.
+func (svc *service) UnlockUser(username string) (*user.User, error) {
+	u, err := svc.users.FindByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{userLockoutKey(u), otpLockoutKey(u)} {
+		if err := svc.lockouts.Users.Reset(key); err != nil {
+			return nil, err
+		}
+	}
+
+	// The codes count their attempts too, apart from the lockouts.
+	for _, subject := range []string{u.ID.String(), emailSubject(u)} {
+		if err := svc.otps.Reset(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	if u.Status != user.Locked {
+		return u, nil
+	}
+
+	u.Unlock()
+	defer u.Notify()
+
+	return u, nil
+}
+
+func (svc *service) DeleteUser(username string) error {
+	u, err := svc.users.FindByUsername(username)
 	if err != nil {
 		return err
 	}
 
-	u.Status = user.Revoked
-	u.UpdatedAt = e.OccuredAt
-	u.DeletedAt = e.OccuredAt
+	u.Delete()
+	defer u.Notify()
+
+	return nil
+}
+
+func (svc *service) Handler() (EventHandler, error) {
+	return svc, nil
+}
+
+// store saves the projection of a user and brings the search index in line.
+func (svc *service) store(u *user.User) error {
+	if err := svc.users.Store(u); err != nil {
+		return err
+	}
+
+	return svc.search.Index(u)
+}
+
+// retryOnConflict runs fn again while it loses races for a user, up to
+// projectionAttempts times; the event is then left for redelivery.
+func retryOnConflict(fn func() error) error {
+	var err error
+	for range projectionAttempts {
+		err = fn()
+		if !errors.Is(err, user.ErrConcurrentModification) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// errUnchanged tells project that an event leaves the user as it is.
+var errUnchanged = errors.New("unchanged")
+
+// project applies an event to the stored user. Should another instance, or
+// another event, store the user first, it starts over from their version.
+func (svc *service) project(id user.UserID, apply func(u *user.User) error) error {
+	return retryOnConflict(func() error {
+		u, err := svc.users.Find(id)
+		if err != nil {
+			return err
+		}
+
+		if err := apply(u); err != nil {
+			if errors.Is(err, errUnchanged) {
+				// Maybe redelivered because indexing failed the first time.
+				return svc.search.Index(u)
+			}
+
+			return err
+		}
+
+		return svc.store(u)
+	})
+}
+
+func (svc *service) UserRegisteredHandler(e *user.UserRegisteredEvent) error {
+	err := svc.store(&e.User)
+
+	// Only a redelivered event finds the user stored already, but maybe
+	// not indexed: that could be why it came again.
+	if errors.Is(err, user.ErrConcurrentModification) {
+		u, err := svc.users.Find(e.User.ID)
+		if err != nil {
+			if errors.Is(err, user.ErrUserNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		return svc.search.Index(u)
+	}
+
+	return err
+}
+
+func (svc *service) UserActivatedHandler(e *user.UserActivatedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		// A lock that overtook the activation stands.
+		if u.Status == user.Locked {
+			return errUnchanged
+		}
+
+		u.Status = e.Status
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserSocialAccountAddedHandler(e *user.UserSocialAccountAddedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		// Redelivered, or applied by whoever stored the user first.
+		if slices.ContainsFunc(u.Accounts, func(a *user.SocialAccount) bool {
+			return a.Provider == e.Account.Provider && a.SocialID == e.Account.SocialID
+		}) {
+			return errUnchanged
+		}
+
+		u.Accounts = append(u.Accounts, &e.Account)
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserSocialAccountRemovedHandler(e *user.UserSocialAccountRemovedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		var accounts []*user.SocialAccount
+		for _, a := range u.Accounts {
+			if a.Provider == e.Account.Provider && a.SocialID == e.Account.SocialID {
+				continue
+			}
+
+			accounts = append(accounts, a)
+		}
+
+		u.Accounts = accounts
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserDeletedHandler(e *user.UserDeletedEvent) error {
+	if err := retryOnConflict(func() error {
+		u, err := svc.users.Find(e.UserID)
+		if err != nil {
+			return err
+		}
+
+		u.Status = user.Revoked
+		u.UpdatedAt = e.OccuredAt
+		u.DeletedAt = e.OccuredAt
+
+		return svc.users.Delete(u)
+	}); err != nil {
+		return err
+	}
+
+	return svc.search.Remove(e.UserID)
+}
+
+func (svc *service) UserTOTPEnrolledHandler(e *user.UserTOTPEnrolledEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.TOTP = &user.TOTP{
+			Secret: e.Secret,
+		}
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserTOTPConfirmedHandler(e *user.UserTOTPConfirmedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		if u.TOTP == nil {
+			return user.ErrTOTPNotEnrolled
+		}
+
+		u.TOTP = &user.TOTP{
+			Secret:        u.TOTP.Secret,
+			Enabled:       true,
+			RecoveryCodes: e.RecoveryCodes,
+			ConfirmedAt:   e.OccuredAt,
+		}
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserTOTPDisabledHandler(e *user.UserTOTPDisabledEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.TOTP = nil
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserRecoveryCodeUsedHandler(e *user.UserRecoveryCodeUsedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		if u.TOTP == nil {
+			return user.ErrTOTPNotEnrolled
+		}
+
+		codes := make([]string, 0, len(u.TOTP.RecoveryCodes))
+		for _, c := range u.TOTP.RecoveryCodes {
+			if c == e.RecoveryCode {
+				continue
+			}
+
+			codes = append(codes, c)
+		}
+
+		t := *u.TOTP
+		t.RecoveryCodes = codes
+
+		u.TOTP = &t
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserProfileUpdatedHandler(e *user.UserProfileUpdatedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.Name = e.Profile.Name
+		if u.Email != e.Profile.Email {
+			u.EmailVerified = false
+		}
+
+		u.Email = e.Profile.Email
+		u.Avatar = e.Profile.Avatar
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserRenamedHandler(e *user.UserRenamedEvent) error {
+	// Taking a former name back ends its reservation.
+	if err := svc.reservations.Release(e.Username); err != nil {
+		return err
+	}
+
+	if err := svc.reservations.Reserve(&user.Reservation{
+		Username:  e.FormerUsername,
+		UserID:    e.UserID,
+		ExpiresAt: e.OccuredAt.Add(usernameGracePeriod),
+	}); err != nil {
+		return err
+	}
+
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.Username = e.Username
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserEmailChangeRequestedHandler(e *user.UserEmailChangeRequestedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.PendingEmail = e.Email
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserEmailChangedHandler(e *user.UserEmailChangedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.Email = e.Email
+		u.EmailVerified = true
+		u.PendingEmail = ""
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserEmailVerifiedHandler(e *user.UserEmailVerifiedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		// Proves only the address it was issued for.
+		if u.Email != e.Email {
+			return errUnchanged
+		}
+
+		u.EmailVerified = true
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserLockedHandler(e *user.UserLockedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.Status = user.Locked
+		u.UpdatedAt = e.OccuredAt
+
+		return nil
+	})
+}
+
+func (svc *service) UserUnlockedHandler(e *user.UserUnlockedEvent) error {
+	return svc.project(e.UserID, func(u *user.User) error {
+		u.Status = user.Activated
+		u.UpdatedAt = e.OccuredAt
 
-	return svc.users.Delete(u)
+		return nil
+	})
 }
@@ -0,0 +1,34 @@
+package ticket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrTicketInvalid collapses unknown/used/expired into one error.
+var ErrTicketInvalid = errors.New("ticket invalid")
+
+// Store persists short-lived one-time tickets that stand in for a
+// half-finished flow (e.g. a sign-in awaiting its second factor); Consume
+// must be atomic.
+type Store interface {
+	// Command
+
+	Save(ticket, subject string, ttl time.Duration) error
+	Consume(ticket string) (subject string, err error)
+
+	// Close the store
+	Close() error
+}
+
+// Generate returns a random 256-bit ticket.
+func Generate() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,29 @@
+package token
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flarexio/identity/client"
+)
+
+// Claims are the claims of the access tokens identity signs.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles     []string `json:"roles"`
+	ClientID  string   `json:"client_id,omitempty"` // the client the token was issued to, if any
+	Scope     string   `json:"scope,omitempty"`     // only on tokens issued through OIDC
+	GrantType string   `json:"gty,omitempty"`       // client_credentials on tokens issued to a client itself
+}
+
+// Machine reports whether the token was issued to a client rather than a
+// user; its subject is then a client ID.
+func (c *Claims) Machine() bool {
+	return c.GrantType == client.ClientCredentials
+}
+
+func (c *Claims) Map() map[string]any {
+	return map[string]any{
+		"sub":   c.Subject,
+		"roles": c.Roles,
+	}
+}
@@ -0,0 +1,31 @@
+package token
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+func IntrospectEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(Request)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		return svc.Introspect(req)
+	}
+}
+
+func RevokeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request any) (any, error) {
+		req, ok := request.(Request)
+		if !ok {
+			return nil, errors.New("invalid request")
+		}
+
+		err := svc.Revoke(req)
+		return nil, err
+	}
+}
@@ -0,0 +1,198 @@
+package token_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/core/events"
+	"github.com/flarexio/core/pubsub"
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/persistence/inmem"
+	"github.com/flarexio/identity/refresh"
+	"github.com/flarexio/identity/revocation"
+	"github.com/flarexio/identity/token"
+)
+
+var clients = []conf.OIDCClient{
+	{
+		ID:           "wallet",
+		Audience:     "wallet.flarex.io",
+		RedirectURIs: []string{"https://wallet.flarex.io/callback"},
+	},
+	{
+		ID:           "mdm",
+		Secret:       "secret",
+		Audience:     "mdm.flarex.io",
+		RedirectURIs: []string{"https://mdm.flarex.io/callback"},
+	},
+}
+
+type fixture struct {
+	svc     token.Service
+	refresh refresh.Service
+	privkey ed25519.PrivateKey
+}
+
+func newFixture(t *testing.T) *fixture {
+	events.ReplaceGlobals(pubsub.NewSimplePubSub())
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	revocationStore, _ := inmem.NewRevocationStore()
+	t.Cleanup(func() { revocationStore.Close() })
+
+	revocations := revocation.NewService(revocationStore, time.Hour)
+
+	// The same checks transport/http.VerifyToken makes, minus the key ring.
+	verify := func(tokenStr string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+		keyFn := func(*jwt.Token) (any, error) { return pub, nil }
+		if _, err := jwt.ParseWithClaims(tokenStr, claims, keyFn, opts...); err != nil {
+			return err
+		}
+
+		c := claims.(*token.Claims)
+		if revocations.Revoked(c.ID, c.Subject, c.IssuedAt.Time) {
+			return revocation.ErrTokenRevoked
+		}
+
+		return nil
+	}
+
+	repo, _ := inmem.NewClientRepository()
+	clientSvc := client.NewService(repo)
+	if err := clientSvc.Seed(clients); err != nil {
+		t.Fatal(err)
+	}
+
+	refreshStore, _ := inmem.NewRefreshTokenStore()
+	t.Cleanup(func() { refreshStore.Close() })
+
+	refreshSvc := refresh.NewService(refreshStore, time.Hour)
+
+	return &fixture{
+		svc:     token.NewService(verify, clientSvc, revocations, refreshSvc),
+		refresh: refreshSvc,
+		privkey: priv,
+	}
+}
+
+func (f *fixture) sign(t *testing.T, id string, aud string) string {
+	now := time.Now()
+	claims := token.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user01",
+			Audience:  jwt.ClaimStrings{aud},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        id,
+		},
+		Roles: []string{"user"},
+	}
+
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(f.privkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokenStr
+}
+
+func TestIntrospect(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFixture(t)
+
+	req := token.Request{
+		Token:        f.sign(t, "token01", "mdm.flarex.io"),
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	}
+
+	i, err := f.svc.Introspect(req)
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	assert.True(i.Active)
+	assert.Equal("user01", i.Subject)
+	assert.Equal([]string{"user"}, i.Roles)
+	assert.Equal([]string{"mdm.flarex.io"}, i.Audience)
+	assert.Equal("token01", i.ID)
+	assert.NotZero(i.ExpiresAt)
+
+	// Tokens meant for another audience are none of the client's business.
+	req.Token = f.sign(t, "token02", "wallet.flarex.io")
+	i, err = f.svc.Introspect(req)
+	assert.NoError(err)
+	assert.False(i.Active)
+
+	req.Token = "garbage"
+	i, err = f.svc.Introspect(req)
+	assert.NoError(err)
+	assert.False(i.Active)
+	assert.Empty(i.Subject)
+
+	req.ClientSecret = "wrong"
+	_, err = f.svc.Introspect(req)
+	assert.ErrorIs(err, oidc.ErrInvalidClient)
+
+	_, err = f.svc.Introspect(token.Request{Token: "garbage", ClientID: "wallet"})
+	assert.ErrorIs(err, oidc.ErrUnauthorizedClient)
+}
+
+func TestRevoke(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFixture(t)
+
+	req := token.Request{
+		Token:        f.sign(t, "token01", "mdm.flarex.io"),
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	}
+
+	err := f.svc.Revoke(req)
+	assert.NoError(err)
+
+	i, err := f.svc.Introspect(req)
+	assert.NoError(err)
+	assert.False(i.Active)
+
+	refreshToken, _ := f.refresh.Issue("user01", "mdm")
+
+	err = f.svc.Revoke(token.Request{
+		Token:         refreshToken,
+		TokenTypeHint: "refresh_token",
+		ClientID:      "mdm",
+		ClientSecret:  "secret",
+	})
+	assert.NoError(err)
+
+	_, _, err = f.refresh.Rotate(refreshToken, "mdm")
+	assert.ErrorIs(err, refresh.ErrTokenInvalid)
+
+	// Another client's refresh token is left alone, and unused.
+	walletToken, _ := f.refresh.Issue("user01", "wallet")
+
+	err = f.svc.Revoke(token.Request{
+		Token:        walletToken,
+		ClientID:     "mdm",
+		ClientSecret: "secret",
+	})
+	assert.NoError(err)
+
+	_, _, err = f.refresh.Rotate(walletToken, "wallet")
+	assert.NoError(err)
+
+	// Unknown tokens are not an error.
+	req.Token = "unknown"
+	assert.NoError(f.svc.Revoke(req))
+}
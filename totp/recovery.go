@@ -0,0 +1,82 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	recoveryAlphabet   = "abcdefghjkmnpqrstuvwxyz23456789" // no 0/o, 1/l/i
+)
+
+// GenerateRecoveryCodes returns plaintext codes for the user and their hashes
+// for the aggregate; the plaintext is never stored.
+func GenerateRecoveryCodes(key []byte) ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		buf, err := randomString(recoveryCodeLength)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		half := recoveryCodeLength / 2
+		codes[i] = buf[:half] + "-" + buf[half:]
+		hashes[i] = HashRecoveryCode(key, codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// randomString draws from recoveryAlphabet without modulo bias: bytes past
+// the last whole multiple of the alphabet are thrown away.
+func randomString(n int) (string, error) {
+	limit := 256 - 256%len(recoveryAlphabet)
+
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+
+			out = append(out, recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+			if len(out) == n {
+				break
+			}
+		}
+	}
+
+	return string(out), nil
+}
+
+// HashRecoveryCode ignores case, spaces and dashes so users can type codes
+// loosely. The codes are short enough to guess offline, so the hash is keyed
+// with a server secret that never reaches the store.
+func HashRecoveryCode(key []byte, code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recoveryKey derives the key of the recovery code hashes from the one
+// sealing secrets, so neither stands in for the other.
+func recoveryKey(encryptionKey []byte) []byte {
+	mac := hmac.New(sha256.New, encryptionKey)
+	mac.Write([]byte("identity totp recovery codes"))
+	return mac.Sum(nil)
+}
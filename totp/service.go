@@ -0,0 +1,116 @@
+package totp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/flarexio/identity/conf"
+)
+
+var (
+	ErrCodeInvalid   = errors.New("totp invalid")
+	ErrNotConfigured = errors.New("totp not configured")
+)
+
+const defaultIssuer = "identity"
+
+// Key is a freshly generated secret: Secret and URI go to the user once,
+// Sealed goes to the aggregate.
+type Key struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	Sealed string `json:"-"`
+}
+
+// Service generates and validates authenticator-app secrets, and the
+// recovery codes that stand in for them.
+type Service interface {
+	Generate(account string) (*Key, error)
+	Validate(sealed string, code string) error
+	RecoveryCodes() (codes []string, hashes []string, err error)
+	HashRecoveryCode(code string) (string, error)
+}
+
+func NewService(cfg conf.MFA) (Service, error) {
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = defaultIssuer
+	}
+
+	svc := &service{issuer: issuer}
+
+	// Without a key, TOTP stays unavailable instead of failing startup.
+	if len(cfg.EncryptionKey) == 0 {
+		return svc, nil
+	}
+
+	cipher, err := NewCipher(cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.cipher = cipher
+	svc.recoveryKey = recoveryKey(cfg.EncryptionKey)
+	return svc, nil
+}
+
+type service struct {
+	issuer      string
+	cipher      Cipher
+	recoveryKey []byte
+}
+
+func (svc *service) Generate(account string) (*Key, error) {
+	if svc.cipher == nil {
+		return nil, ErrNotConfigured
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := svc.cipher.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Secret: secret,
+		URI:    URI(svc.issuer, account, secret),
+		Sealed: sealed,
+	}, nil
+}
+
+func (svc *service) Validate(sealed string, code string) error {
+	if svc.cipher == nil {
+		return ErrNotConfigured
+	}
+
+	secret, err := svc.cipher.Decrypt(sealed)
+	if err != nil {
+		return err
+	}
+
+	if !Validate(secret, code, time.Now()) {
+		return ErrCodeInvalid
+	}
+
+	return nil
+}
+
+func (svc *service) RecoveryCodes() ([]string, []string, error) {
+	if svc.cipher == nil {
+		return nil, nil, ErrNotConfigured
+	}
+
+	return GenerateRecoveryCodes(svc.recoveryKey)
+}
+
+func (svc *service) HashRecoveryCode(code string) (string, error) {
+	if svc.cipher == nil {
+		return "", ErrNotConfigured
+	}
+
+	return HashRecoveryCode(svc.recoveryKey, code), nil
+}
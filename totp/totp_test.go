@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	assert := assert.New(t)
+
+	// RFC 6238 Appendix B (SHA1), truncated to 6 digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for ts, expected := range vectors {
+		code, err := Code(secret, time.Unix(ts, 0))
+		assert.NoError(err)
+		assert.Equal(expected, code, ts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	now := time.Now()
+	code, _ := Code(secret, now)
+
+	assert.True(Validate(secret, code, now))
+	assert.True(Validate(secret, code, now.Add(period)))
+	assert.False(Validate(secret, code, now.Add(3*period)))
+	assert.False(Validate(secret, "000000x", now))
+}
+
+func TestCipher(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewCipher(make([]byte, 32))
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	sealed, err := c.Encrypt("JBSWY3DPEHPK3PXP")
+	assert.NoError(err)
+	assert.NotContains(sealed, "JBSWY3DPEHPK3PXP")
+
+	plain, err := c.Decrypt(sealed)
+	assert.NoError(err)
+	assert.Equal("JBSWY3DPEHPK3PXP", plain)
+
+	_, err = c.Decrypt(sealed[:len(sealed)-2] + "AA")
+	assert.ErrorIs(err, ErrCiphertextInvalid)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	key := []byte("0123456789abcdef")
+
+	codes, hashes, err := GenerateRecoveryCodes(key)
+	assert.NoError(err)
+	assert.Len(codes, recoveryCodeCount)
+	assert.Len(hashes, recoveryCodeCount)
+
+	assert.Equal(hashes[0], HashRecoveryCode(key, codes[0]))
+	assert.Equal(hashes[0], HashRecoveryCode(key, " "+codes[0][:5]+codes[0][6:]))
+
+	// Without the server key, a stolen hash cannot be checked against guesses.
+	assert.NotEqual(hashes[0], HashRecoveryCode([]byte("fedcba9876543210"), codes[0]))
+
+	for _, code := range codes {
+		assert.Len(code, recoveryCodeLength+1)
+		for _, c := range strings.ReplaceAll(code, "-", "") {
+			assert.Contains(recoveryAlphabet, string(c))
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package facebook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/oauth2"
+
+	"github.com/flarexio/identity"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/user"
+)
+
+var (
+	config *oauth2.Config
+	store  *cache.Cache
+)
+
+func SetConfig(provider conf.FacebookProvider) {
+	config = &oauth2.Config{
+		ClientID:     provider.App.ID,
+		ClientSecret: provider.App.Secret,
+		RedirectURL:  provider.RedirectURI,
+		Scopes:       []string{"public_profile", "email"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  provider.Dialog(),
+			TokenURL: provider.Graph() + "/oauth/access_token",
+		},
+	}
+
+	store = cache.New(10*time.Minute, cache.NoExpiration)
+}
+
+func generateRandomString(length int) string {
+	bytes := make([]byte, length)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return base64.URLEncoding.EncodeToString(bytes)
+}
+
+type SessionOperation string
+
+const (
+	SignIn      SessionOperation = "signin"
+	LinkAccount SessionOperation = "link_account"
+)
+
+// Session needs no nonce: Facebook Login returns an access token rather
+// than an ID token, and the state alone binds the callback to the browser.
+type Session struct {
+	State    string
+	Op       SessionOperation
+	Username string
+}
+
+func NewSession(op SessionOperation) *Session {
+	return &Session{
+		State: generateRandomString(32),
+		Op:    op,
+	}
+}
+
+func LoginAuthURLHandler(op SessionOperation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := NewSession(op)
+
+		if op == LinkAccount {
+			username := c.Param("user")
+			if username == "" {
+				err := errors.New("user required")
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+
+			session.Username = username
+		}
+
+		store.Set(session.State, session, cache.DefaultExpiration)
+
+		authURL := config.AuthCodeURL(session.State,
+			oauth2.SetAuthURLParam("response_type", "code"),
+		)
+
+		switch op {
+		case SignIn:
+			c.Redirect(http.StatusFound, authURL)
+
+		case LinkAccount:
+			c.String(http.StatusOK, authURL)
+		}
+	}
+}
+
+func AuthCallback(signInEndpoint endpoint.Endpoint, addSocialAccountEndpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The user cancelled the dialog or declined the permissions.
+		if reason := c.Query("error_reason"); reason != "" {
+			err := errors.New(reason)
+			c.String(http.StatusUnauthorized, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		code := c.Query("code")
+		if code == "" {
+			err := errors.New("code is required")
+			c.String(http.StatusBadRequest, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		state := c.Query("state")
+		if state == "" {
+			err := errors.New("state is required")
+			c.String(http.StatusBadRequest, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		s, ok := store.Get(state)
+		if !ok {
+			err := errors.New("invalid state")
+			c.String(http.StatusBadRequest, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+		defer store.Delete(state)
+
+		session, ok := s.(*Session)
+		if !ok {
+			err := errors.New("invalid session data")
+			c.String(http.StatusBadRequest, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		ctx = context.WithValue(ctx, user.ClientIP, c.ClientIP())
+
+		token, err := config.Exchange(ctx, code)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		// The provider checks the access token through debug_token, so a
+		// token issued to another app is refused there.
+		accessToken := token.AccessToken
+
+		switch session.Op {
+		case SignIn:
+			req := identity.SignInRequest{
+				Provider:   user.FACEBOOK,
+				Credential: accessToken,
+			}
+
+			_, err := signInEndpoint(ctx, req)
+			if err != nil {
+				c.String(http.StatusExpectationFailed, err.Error())
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			c.String(http.StatusOK, "Login successful! You can close this window now.")
+
+		case LinkAccount:
+			req := identity.AddSocialAccountRequest{
+				Provider:   user.FACEBOOK,
+				Credential: accessToken,
+				Username:   session.Username,
+			}
+
+			_, err := addSocialAccountEndpoint(ctx, req)
+			if err != nil {
+				c.String(http.StatusExpectationFailed, err.Error())
+				c.Error(err)
+				c.Abort()
+				return
+			}
+
+			c.String(http.StatusOK, "Social account linked successfully! You can close this window now.")
+
+		default:
+			err := errors.New("invalid operation")
+			c.String(http.StatusBadRequest, err.Error())
+			c.Error(err)
+			c.Abort()
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/flarexio/identity/client"
+)
+
+type ClientRequest struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Audience     string   `json:"audience"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+func (req ClientRequest) toClientRequest() client.ClientRequest {
+	return client.ClientRequest{
+		ID:           req.ID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Audience:     req.Audience,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+	}
+}
+
+func clientError(c *gin.Context, err error) {
+	code := http.StatusExpectationFailed
+	switch {
+	case errors.Is(err, client.ErrClientNotFound):
+		code = http.StatusNotFound
+
+	case errors.Is(err, client.ErrClientExists):
+		code = http.StatusConflict
+
+	case errors.Is(err, client.ErrClientIDInvalid),
+		errors.Is(err, client.ErrRedirectURIInvalid),
+		errors.Is(err, client.ErrGrantTypeInvalid),
+		errors.Is(err, client.ErrAudienceRequired),
+		errors.Is(err, client.ErrScopeInvalid),
+		errors.Is(err, client.ErrSecretNotApplicable):
+		code = http.StatusBadRequest
+	}
+
+	c.Abort()
+	c.Error(err)
+	c.String(code, err.Error())
+}
+
+func RegisterClientHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ClientRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := endpoint(c, req.toClientRequest())
+		if err != nil {
+			clientError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, &resp)
+	}
+}
+
+func UpdateClientHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ClientRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		req.ID = c.Param("client")
+
+		resp, err := endpoint(c, req.toClientRequest())
+		if err != nil {
+			clientError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+// ClientHandler serves the single-ID endpoints: get, delete and secret
+// rotation all take the client ID from the path.
+func ClientHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("client")
+		if id == "" {
+			err := errors.New("client required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := endpoint(c, id)
+		if err != nil {
+			clientError(c, err)
+			return
+		}
+
+		if resp == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func ClientsHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp, err := endpoint(c, nil)
+		if err != nil {
+			clientError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
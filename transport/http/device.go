@@ -0,0 +1,170 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/device"
+	"github.com/flarexio/identity/oidc"
+)
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceAuthorizationHandler starts the device flow: the device shows the
+// user code and polls /oauth2/token while the user approves it elsewhere.
+func DeviceAuthorizationHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+
+		var req device.AuthorizeRequest
+		if err := c.ShouldBind(&req); err != nil {
+			tokenError(c, &oidc.Error{Code: oidc.ErrInvalidRequest.Code, Description: err.Error()})
+			return
+		}
+
+		if id, secret, ok := c.Request.BasicAuth(); ok {
+			req.ClientID = id
+			req.ClientSecret = secret
+		}
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+
+		a := resp.(*device.Authorization)
+		userCode := device.FormatUserCode(a.UserCode)
+		verificationURI := conf.G().OIDC.DeviceURL
+
+		c.JSON(http.StatusOK, &DeviceAuthorizationResponse{
+			DeviceCode:              a.DeviceCode,
+			UserCode:                userCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: withQuery(verificationURI, url.Values{"user_code": {userCode}}),
+			ExpiresIn:               int64(time.Until(a.ExpiresAt).Seconds()),
+			Interval:                int64(a.Interval.Seconds()),
+		})
+	}
+}
+
+type DeviceResponse struct {
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// DeviceHandler tells the verification page which client a user code
+// belongs to, for the signed-in user to approve.
+func DeviceHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var claims Claims
+		if err := ParseToken(c, &claims); err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		if claims.Machine() {
+			unauthorized(c, http.StatusForbidden, ErrMachineToken)
+			return
+		}
+
+		resp, err := endpoint(c, c.Param("code"))
+		if err != nil {
+			deviceError(c, err)
+			return
+		}
+
+		a := resp.(*device.Authorization)
+
+		var clientName string
+		if clients != nil {
+			if cl, err := clients.Client(a.ClientID); err == nil {
+				clientName = cl.Name
+			}
+		}
+
+		c.JSON(http.StatusOK, &DeviceResponse{
+			UserCode:   device.FormatUserCode(a.UserCode),
+			ClientID:   a.ClientID,
+			ClientName: clientName,
+			Scope:      strings.Join(a.Scope, " "),
+			ExpiresIn:  int64(time.Until(a.ExpiresAt).Seconds()),
+		})
+	}
+}
+
+type DeviceDecisionRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// DeviceDecisionHandler records the signed-in user's answer; the device
+// picks it up on its next poll.
+func DeviceDecisionHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var claims Claims
+		if err := ParseToken(c, &claims); err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		if claims.Machine() {
+			unauthorized(c, http.StatusForbidden, ErrMachineToken)
+			return
+		}
+
+		var req DeviceDecisionRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		_, err := endpoint(c, device.DecideRequest{
+			UserCode: req.UserCode,
+			Subject:  claims.Subject,
+			Approve:  req.Approve,
+		})
+
+		if err != nil {
+			deviceError(c, err)
+			return
+		}
+
+		if !req.Approve {
+			c.String(http.StatusOK, "device denied")
+			return
+		}
+
+		c.String(http.StatusOK, "device approved")
+	}
+}
+
+func deviceError(c *gin.Context, err error) {
+	code := http.StatusExpectationFailed
+	if errors.Is(err, device.ErrUserCodeInvalid) {
+		code = http.StatusNotFound
+	}
+
+	c.Abort()
+	c.Error(err)
+	c.String(code, err.Error())
+}
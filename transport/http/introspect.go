@@ -0,0 +1,69 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/token"
+)
+
+// bindTokenRequest reads an RFC 7662/7009 form, taking the client
+// credentials from Basic auth when given.
+func bindTokenRequest(c *gin.Context) (token.Request, bool) {
+	var req token.Request
+	if err := c.ShouldBind(&req); err != nil {
+		tokenError(c, &oidc.Error{Code: oidc.ErrInvalidRequest.Code, Description: err.Error()})
+		return req, false
+	}
+
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = id
+		req.ClientSecret = secret
+	}
+
+	if req.Token == "" {
+		tokenError(c, &oidc.Error{Code: oidc.ErrInvalidRequest.Code, Description: "token required"})
+		return req, false
+	}
+
+	return req, true
+}
+
+func IntrospectHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+
+		req, ok := bindTokenRequest(c)
+		if !ok {
+			return
+		}
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// RevokeHandler answers 200 whether or not the token was known.
+func RevokeHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindTokenRequest(c)
+		if !ok {
+			return
+		}
+
+		if _, err := endpoint(c, req); err != nil {
+			tokenError(c, err)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
@@ -9,19 +10,10 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/flarexio/core/policy"
+	"github.com/flarexio/identity/token"
 )
 
-type Claims struct {
-	jwt.RegisteredClaims
-	Roles []string `json:"roles"`
-}
-
-func (c *Claims) Map() map[string]any {
-	return map[string]any{
-		"sub":   c.Subject,
-		"roles": c.Roles,
-	}
-}
+type Claims = token.Claims
 
 type Who byte
 
@@ -37,14 +29,7 @@ type GinAuth func(rule string, who ...Who) gin.HandlerFunc
 
 func Authorizator(policy policy.Policy) GinAuth {
 	return func(rule string, who ...Who) gin.HandlerFunc {
-		rules := strings.Split(rule, ".")
-		domain := rules[0]
-		action := rules[1]
-
-		var flags byte
-		for _, w := range who {
-			flags = flags | byte(w)
-		}
+		check := newCheck(policy, rule, who...)
 
 		return func(c *gin.Context) {
 			var claims Claims
@@ -53,19 +38,7 @@ func Authorizator(policy policy.Policy) GinAuth {
 				return
 			}
 
-			input := map[string]any{
-				"domain":    domain,
-				"action":    action,
-				"who_flags": flags,
-				"claims":    claims.Map(),
-			}
-
-			if username := c.Param("user"); username != "" {
-				input["object"] = username
-			}
-
-			ctx := c.Request.Context()
-			allowed, err := policy.Eval(ctx, input)
+			allowed, err := check(c.Request.Context(), &claims, c.Param("user"))
 			if err != nil {
 				unauthorized(c, http.StatusExpectationFailed, err)
 				return
@@ -80,3 +53,62 @@ func Authorizator(policy policy.Policy) GinAuth {
 		}
 	}
 }
+
+// TokenAuth checks a bearer token against a rule as GinAuth does, for
+// requests that do not come over HTTP. The error is for a token that does
+// not verify.
+type TokenAuth func(rule string, who ...Who) func(ctx context.Context, token string) (bool, error)
+
+func TokenAuthorizator(policy policy.Policy) TokenAuth {
+	return func(rule string, who ...Who) func(ctx context.Context, token string) (bool, error) {
+		check := newCheck(policy, rule, who...)
+
+		return func(ctx context.Context, token string) (bool, error) {
+			if audience == "" {
+				return false, ErrTokenNotInit
+			}
+
+			var claims Claims
+			if err := VerifyToken(token, &claims, jwt.WithAudience(audience)); err != nil {
+				return false, err
+			}
+
+			return check(ctx, &claims, "")
+		}
+	}
+}
+
+type check func(ctx context.Context, claims *Claims, object string) (bool, error)
+
+func newCheck(policy policy.Policy, rule string, who ...Who) check {
+	rules := strings.Split(rule, ".")
+	domain := rules[0]
+	action := rules[1]
+
+	var flags byte
+	for _, w := range who {
+		flags = flags | byte(w)
+	}
+
+	return func(ctx context.Context, claims *Claims, object string) (bool, error) {
+		// A client is nobody's owner nor an admin: its scopes alone
+		// decide what it may do.
+		whoFlags := flags
+		if claims.Machine() {
+			whoFlags = 0
+		}
+
+		input := map[string]any{
+			"domain":    domain,
+			"action":    action,
+			"who_flags": whoFlags,
+			"claims":    claims.Map(),
+		}
+
+		if object != "" {
+			input["object"] = object
+		}
+
+		return policy.Eval(ctx, input)
+	}
+}
@@ -0,0 +1,506 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/flarexio/identity/client"
+	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/device"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/refresh"
+	"github.com/flarexio/identity/user"
+)
+
+// Profile holds the standard claims released about a user: name,
+// preferred_username and picture under the profile scope, email under email.
+type Profile struct {
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Email             string `json:"email,omitempty"`
+}
+
+func profileFor(u *user.User, scope []string) Profile {
+	var p Profile
+
+	if slices.Contains(scope, "profile") {
+		p.Name = u.Name
+		p.PreferredUsername = u.Username
+		p.Picture = u.Avatar
+	}
+
+	if slices.Contains(scope, "email") {
+		p.Email = u.Email
+	}
+
+	return p
+}
+
+type UserInfo struct {
+	Subject string `json:"sub"` // user ID, as in the ID token
+	Profile
+}
+
+type IDClaims struct {
+	jwt.RegisteredClaims
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	Nonce    string           `json:"nonce,omitempty"`
+	Profile
+}
+
+// signIDToken issues the ID token for a redeemed authorization code. Its
+// subject is the stable user ID rather than the username.
+func signIDToken(u *user.User, code *oidc.AuthorizationCode) (string, error) {
+	cfg := conf.G()
+	now := time.Now()
+
+	claims := IDClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.OIDC.Issuer,
+			Subject:   u.ID.String(),
+			Audience:  jwt.ClaimStrings{code.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.Timeout)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        ulid.Make().String(),
+		},
+		AuthTime: jwt.NewNumericDate(code.AuthTime),
+		Nonce:    code.Nonce,
+		Profile:  profileFor(u, code.Scope),
+	}
+
+	return sign(claims)
+}
+
+func DiscoveryHandler(c *gin.Context) {
+	issuer := conf.G().OIDC.Issuer
+
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"introspection_endpoint":                issuer + "/oauth2/introspect",
+		"revocation_endpoint":                   issuer + "/oauth2/revoke",
+		"device_authorization_endpoint":         issuer + "/oauth2/device_authorization",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials", client.DeviceCode},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"scopes_supported":                      oidc.ScopesSupported,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "preferred_username", "picture", "email",
+		},
+	})
+}
+
+// AuthorizeHandler checks the request, then sends the browser to the login
+// page with the query intact; once signed in, the page posts the same query
+// to AuthorizeCodeHandler.
+func AuthorizeHandler(validate endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req oidc.AuthorizeRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if _, err := validate(c, req); err != nil {
+			authorizeError(c, req, err)
+			return
+		}
+
+		login, err := url.Parse(conf.G().OIDC.LoginURL)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		login.RawQuery = c.Request.URL.RawQuery
+
+		c.Redirect(http.StatusFound, login.String())
+	}
+}
+
+// AuthorizeCodeHandler issues a code for the bearer of the access token and
+// answers with the client URL to continue at.
+func AuthorizeCodeHandler(authorize endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var claims Claims
+		if err := ParseToken(c, &claims); err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		if claims.Machine() {
+			unauthorized(c, http.StatusForbidden, ErrMachineToken)
+			return
+		}
+
+		var req oidc.AuthorizeRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := authorize(c, oidc.AuthorizeCodeRequest{
+			AuthorizeRequest: req,
+			Subject:          claims.Subject,
+			AuthTime:         claims.IssuedAt.Time,
+		})
+
+		if err != nil {
+			authorizeError(c, req, err)
+			return
+		}
+
+		code, ok := resp.(string)
+		if !ok {
+			err := errors.New("invalid response")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		params := url.Values{}
+		params.Set("code", code)
+		if req.State != "" {
+			params.Set("state", req.State)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"redirect_to": withQuery(req.RedirectURI, params),
+		})
+	}
+}
+
+// authorizeError reports back to the client when its redirect_uri is
+// trusted, and to the browser otherwise.
+func authorizeError(c *gin.Context, req oidc.AuthorizeRequest, err error) {
+	c.Abort()
+	c.Error(err)
+
+	var oerr *oidc.Error
+	if !errors.As(err, &oerr) {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := url.Values{}
+	params.Set("error", oerr.Code)
+	if oerr.Description != "" {
+		params.Set("error_description", oerr.Description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	redirectTo := withQuery(req.RedirectURI, params)
+
+	if c.Request.Method == http.MethodGet {
+		c.Redirect(http.StatusFound, redirectTo)
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":             oerr.Code,
+		"error_description": oerr.Description,
+		"redirect_to":       redirectTo,
+	})
+}
+
+func withQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// TokenHandler serves the authorization_code and refresh_token grants;
+// the refresh endpoints are nil when refreshing is disabled.
+func TokenHandler(exchange, authenticateClient, clientCredentials, pollDevice, userEndpoint, issueRefresh, rotateRefresh endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+
+		var req oidc.TokenRequest
+		if err := c.ShouldBind(&req); err != nil {
+			tokenError(c, &oidc.Error{Code: oidc.ErrInvalidRequest.Code, Description: err.Error()})
+			return
+		}
+
+		if id, secret, ok := c.Request.BasicAuth(); ok {
+			req.ClientID = id
+			req.ClientSecret = secret
+		}
+
+		switch req.GrantType {
+		case "authorization_code":
+			resp, err := exchange(c, req)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			code := resp.(*oidc.AuthorizationCode)
+
+			u, err := activeUser(c, userEndpoint, code.Subject)
+			if err != nil {
+				tokenError(c, &oidc.Error{Code: oidc.ErrInvalidGrant.Code, Description: err.Error()})
+				return
+			}
+
+			token, err := signToken(u.Username, code.ClientID, code.Scope...)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			idToken, err := signIDToken(u, code)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			var refreshToken string
+			if issueRefresh != nil {
+				resp, err := issueRefresh(c, refresh.IssueRequest{
+					Subject:  u.Username,
+					ClientID: code.ClientID,
+					Scope:    code.Scope,
+				})
+				if err != nil {
+					tokenError(c, err)
+					return
+				}
+
+				refreshToken = resp.(string)
+			}
+
+			c.JSON(http.StatusOK, &TokenResponse{
+				AccessToken:  token.Token,
+				TokenType:    "Bearer",
+				ExpiresIn:    int64(time.Until(token.ExpiredAt).Seconds()),
+				RefreshToken: refreshToken,
+				IDToken:      idToken,
+				Scope:        strings.Join(code.Scope, " "),
+			})
+
+		case "refresh_token":
+			if rotateRefresh == nil {
+				tokenError(c, oidc.ErrUnsupportedGrantType)
+				return
+			}
+
+			if _, err := authenticateClient(c, req); err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			resp, err := rotateRefresh(c, refresh.RotateRequest{
+				Token:    req.RefreshToken,
+				ClientID: req.ClientID,
+			})
+			if err != nil {
+				tokenError(c, &oidc.Error{Code: oidc.ErrInvalidGrant.Code, Description: err.Error()})
+				return
+			}
+
+			rotated := resp.(*refresh.RotateResponse)
+
+			if _, err := activeUser(c, userEndpoint, rotated.Subject); err != nil {
+				tokenError(c, &oidc.Error{Code: oidc.ErrInvalidGrant.Code, Description: err.Error()})
+				return
+			}
+
+			// The refreshed token gets exactly the scope of the sign-in.
+			token, err := signToken(rotated.Subject, rotated.ClientID, rotated.Scope...)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, &TokenResponse{
+				AccessToken:  token.Token,
+				TokenType:    "Bearer",
+				ExpiresIn:    int64(time.Until(token.ExpiredAt).Seconds()),
+				RefreshToken: rotated.Token,
+				Scope:        strings.Join(rotated.Scope, " "),
+			})
+
+		case "client_credentials":
+			resp, err := clientCredentials(c, req)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			grant := resp.(*oidc.ClientGrant)
+
+			// No user, no ID token and no refresh token: the client can
+			// always ask again with its secret.
+			token, err := signClientToken(grant)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, &TokenResponse{
+				AccessToken: token.Token,
+				TokenType:   "Bearer",
+				ExpiresIn:   int64(time.Until(token.ExpiredAt).Seconds()),
+				Scope:       strings.Join(grant.Scope, " "),
+			})
+
+		case client.DeviceCode:
+			resp, err := pollDevice(c, req)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			a := resp.(*device.Authorization)
+
+			// The user may have gone, or been locked, since approving.
+			if _, err := activeUser(c, userEndpoint, a.Subject); err != nil {
+				tokenError(c, &oidc.Error{Code: oidc.ErrInvalidGrant.Code, Description: err.Error()})
+				return
+			}
+
+			token, err := signToken(a.Subject, a.ClientID, a.Scope...)
+			if err != nil {
+				tokenError(c, err)
+				return
+			}
+
+			var refreshToken string
+			if issueRefresh != nil {
+				resp, err := issueRefresh(c, refresh.IssueRequest{
+					Subject:  a.Subject,
+					ClientID: a.ClientID,
+					Scope:    a.Scope,
+				})
+				if err != nil {
+					tokenError(c, err)
+					return
+				}
+
+				refreshToken = resp.(string)
+			}
+
+			c.JSON(http.StatusOK, &TokenResponse{
+				AccessToken:  token.Token,
+				TokenType:    "Bearer",
+				ExpiresIn:    int64(time.Until(token.ExpiredAt).Seconds()),
+				RefreshToken: refreshToken,
+				Scope:        strings.Join(a.Scope, " "),
+			})
+
+		default:
+			tokenError(c, oidc.ErrUnsupportedGrantType)
+		}
+	}
+}
+
+func tokenError(c *gin.Context, err error) {
+	c.Abort()
+	c.Error(err)
+
+	var oerr *oidc.Error
+	if !errors.As(err, &oerr) {
+		c.JSON(http.StatusInternalServerError, &oidc.Error{
+			Code:        "server_error",
+			Description: err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(oerr, oidc.ErrInvalidClient) {
+		c.Header("WWW-Authenticate", `Basic realm="`+issuer+`"`)
+		c.JSON(http.StatusUnauthorized, oerr)
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, oerr)
+}
+
+func UserInfoHandler(userEndpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Access tokens issued to clients are not meant for identity, but
+		// every one of them may read the userinfo of its subject.
+		var claims Claims
+		if err := parseToken(c, &claims); err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		if claims.Machine() {
+			unauthorized(c, http.StatusForbidden, ErrMachineToken)
+			return
+		}
+
+		resp, err := userEndpoint(c, claims.Subject)
+		if err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		u, ok := resp.(*user.User)
+		if !ok {
+			err := errors.New("invalid user")
+			unauthorized(c, http.StatusExpectationFailed, err)
+			return
+		}
+
+		// Tokens from the first-party sign-in carry no scope but belong to
+		// the user themself, so they see everything. A client sees only
+		// what it was granted.
+		scope := strings.Fields(claims.Scope)
+		if len(scope) == 0 && claims.ClientID == "" {
+			scope = []string{"profile", "email"}
+		}
+
+		c.JSON(http.StatusOK, &UserInfo{
+			Subject: u.ID.String(),
+			Profile: profileFor(u, scope),
+		})
+	}
+}
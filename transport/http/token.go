@@ -1,8 +1,6 @@
 package http
 
 import (
-	"crypto/ed25519"
-	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"net/http"
@@ -11,36 +9,80 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/oklog/ulid/v2"
 
+	"github.com/flarexio/identity"
+	"github.com/flarexio/identity/client"
 	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/keyring"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/revocation"
 )
 
 var (
 	ErrTokenNotInit = errors.New("token not initialized")
 	ErrInvalidToken = errors.New("invalid token")
+	ErrMachineToken = errors.New("token was issued to a client, not a user")
+
+	ErrConfidentialClient = errors.New("confidential clients sign in at the token endpoint")
 )
 
 var (
 	issuer   string
 	audience string
+	keys     *keyring.KeyRing
 	keyFn    jwt.Keyfunc
+	denylist revocation.Service
+	clients  client.Service
 )
 
-func Init(i, a string, privkey ed25519.PrivateKey) {
+func Init(i, a string, ring *keyring.KeyRing) {
 	issuer = i
 	audience = a
+	keys = ring
 
-	pubkey := privkey.Public().(ed25519.PublicKey)
 	keyFn = func(t *jwt.Token) (any, error) {
-		return pubkey, nil
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			// Tokens signed before the key ring existed carry no kid.
+			var set jwt.VerificationKeySet
+			for _, k := range ring.Keys() {
+				set.Keys = append(set.Keys, k.Public())
+			}
+
+			return set, nil
+		}
+
+		k, err := ring.Lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		return k.Public(), nil
 	}
 }
 
+// SetDenylist makes ParseToken reject revoked tokens.
+func SetDenylist(svc revocation.Service) {
+	denylist = svc
+}
+
+// SetClients lets token issuance scope aud to the requesting client.
+func SetClients(svc client.Service) {
+	clients = svc
+}
+
+// ParseToken accepts tokens meant for identity itself.
 func ParseToken(ctx *gin.Context, claims jwt.Claims) error {
-	if audience == "" || keyFn == nil {
+	if audience == "" {
 		return ErrTokenNotInit
 	}
 
+	return parseToken(ctx, claims, jwt.WithAudience(audience))
+}
+
+// parseToken accepts any token we signed, whatever its audience.
+func parseToken(ctx *gin.Context, claims jwt.Claims, opts ...jwt.ParserOption) error {
 	authHeader := ctx.GetHeader("Authorization")
 
 	tokenStr, ok := strings.CutPrefix(authHeader, "Bearer ")
@@ -48,12 +90,157 @@ func ParseToken(ctx *gin.Context, claims jwt.Claims) error {
 		return ErrInvalidToken
 	}
 
-	_, err := jwt.ParseWithClaims(tokenStr, claims, keyFn,
-		jwt.WithAudience(audience),
-		jwt.WithLeeway(10*time.Second),
-	)
+	return VerifyToken(tokenStr, claims, opts...)
+}
+
+// VerifyToken checks a raw token the way ParseToken checks bearer tokens,
+// for callers that do not get it from an Authorization header.
+func VerifyToken(tokenStr string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	if keyFn == nil {
+		return ErrTokenNotInit
+	}
+
+	opts = append(opts, jwt.WithLeeway(10*time.Second))
+
+	_, err := jwt.ParseWithClaims(tokenStr, claims, keyFn, opts...)
+
+	if err != nil {
+		return err
+	}
+
+	if c, ok := claims.(*Claims); ok && denylist != nil {
+		if denylist.Revoked(c.ID, c.Subject, c.IssuedAt.Time) {
+			return revocation.ErrTokenRevoked
+		}
+	}
+
+	return nil
+}
+
+// firstPartyClient lets the first-party routes, which take no client
+// secret, sign for identity itself or a public client only. A confidential
+// client authenticates at the token endpoint, or anyone could have tokens
+// for its audience.
+func firstPartyClient(clientID string) error {
+	if clientID == "" {
+		return nil
+	}
+
+	if clients == nil {
+		return client.ErrClientNotFound
+	}
+
+	c, err := clients.Client(clientID)
+	if err != nil {
+		return err
+	}
+
+	if !c.Public() {
+		return ErrConfidentialClient
+	}
+
+	return nil
+}
+
+// audienceFor scopes a token to the client it is issued to; tokens without
+// a client are meant for identity itself.
+func audienceFor(clientID string) (jwt.ClaimStrings, error) {
+	if clientID == "" {
+		return jwt.ClaimStrings{audience}, nil
+	}
+
+	if clients == nil {
+		return nil, client.ErrClientNotFound
+	}
+
+	c, err := clients.Client(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.ClaimStrings{c.Audience}, nil
+}
+
+// signToken issues the access token handed out after a successful sign-in
+// or refresh. Tokens issued through OIDC also carry the granted scope.
+func signToken(username string, clientID string, scope ...string) (*identity.Token, error) {
+	cfg := conf.G()
+	now := time.Now()
+
+	aud, err := audienceFor(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.BaseURL,
+			Subject:   username,
+			Audience:  aud,
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.Timeout)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        ulid.Make().String(),
+		},
+		Roles:    rolesFor(username),
+		ClientID: clientID,
+		Scope:    strings.Join(scope, " "),
+	}
+
+	tokenStr, err := sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity.Token{
+		Token:     tokenStr,
+		ExpiredAt: now.Add(cfg.JWT.Timeout),
+	}, nil
+}
+
+// signClientToken issues the access token of a client_credentials grant. Its
+// scopes double as the roles the policy checks.
+func signClientToken(grant *oidc.ClientGrant) (*identity.Token, error) {
+	cfg := conf.G()
+	now := time.Now()
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.BaseURL,
+			Subject:   grant.Client.ID,
+			Audience:  jwt.ClaimStrings{grant.Client.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.Timeout)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        ulid.Make().String(),
+		},
+		Roles:     grant.Scope,
+		ClientID:  grant.Client.ID,
+		Scope:     strings.Join(grant.Scope, " "),
+		GrantType: client.ClientCredentials,
+	}
+
+	tokenStr, err := sign(claims)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return &identity.Token{
+		Token:     tokenStr,
+		ExpiredAt: now.Add(cfg.JWT.Timeout),
+	}, nil
+}
+
+// sign signs claims with the active key and stamps its kid.
+func sign(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", ErrTokenNotInit
+	}
+
+	key := keys.Active()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Privkey)
 }
 
 type JWK struct {
@@ -69,26 +256,27 @@ type JWKSet struct {
 	Keys []JWK `json:"keys"`
 }
 
+// JWKHandler publishes the active key and every retired key still kept
+// for verification.
 func JWKHandler(c *gin.Context) {
-	cfg := conf.G()
-
-	pub := cfg.JWT.Privkey.Public().(ed25519.PublicKey)
-	x := base64.RawURLEncoding.EncodeToString(pub)
-
-	hash := sha256.Sum256(pub)
-	kid := base64.RawURLEncoding.EncodeToString(hash[:16])
-
-	jwk := JWK{
-		Kty: "OKP",
-		Crv: "Ed25519",
-		X:   x,
-		Alg: "EdDSA",
-		Use: "sig",
-		Kid: kid,
+	if keys == nil {
+		c.String(http.StatusServiceUnavailable, ErrTokenNotInit.Error())
+		return
 	}
 
 	jwkSet := JWKSet{
-		Keys: []JWK{jwk},
+		Keys: make([]JWK, 0),
+	}
+
+	for _, k := range keys.Keys() {
+		jwkSet.Keys = append(jwkSet.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k.Public()),
+			Alg: "EdDSA",
+			Use: "sig",
+			Kid: k.ID,
+		})
 	}
 
 	c.JSON(http.StatusOK, jwkSet)
@@ -1,18 +1,22 @@
 package http
 
 import (
+	"context"
 	"errors"
+	"math"
 	"net/http"
 	"slices"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-kit/kit/endpoint"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/oklog/ulid/v2"
 
 	"github.com/flarexio/identity"
 	"github.com/flarexio/identity/conf"
+	"github.com/flarexio/identity/lockout"
+	"github.com/flarexio/identity/refresh"
+	"github.com/flarexio/identity/revocation"
 	"github.com/flarexio/identity/user"
 )
 
@@ -38,9 +42,19 @@ func RegisterHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 
 		resp, err := endpoint(c, req)
 		if err != nil {
+			code := http.StatusExpectationFailed
+			switch {
+			case errors.Is(err, user.ErrUserExists):
+				code = http.StatusConflict
+			case errors.Is(err, user.ErrUsernameInvalid),
+				errors.Is(err, user.ErrUsernameReserved),
+				errors.Is(err, user.ErrEmailInvalid):
+				code = http.StatusBadRequest
+			}
+
 			c.Abort()
 			c.Error(err)
-			c.String(http.StatusExpectationFailed, err.Error())
+			c.String(code, err.Error())
 			return
 		}
 
@@ -48,6 +62,29 @@ func RegisterHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	}
 }
 
+func SendOTPHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		_, err := endpoint(c, username)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.String(http.StatusOK, "otp sent")
+	}
+}
+
 func OTPVerifyHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username := c.Param("user")
@@ -70,9 +107,10 @@ func OTPVerifyHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 
 		resp, err := endpoint(c, req)
 		if err != nil {
+			code := failedAttemptStatus(c, http.StatusExpectationFailed, err)
 			c.Abort()
 			c.Error(err)
-			c.String(http.StatusExpectationFailed, err.Error())
+			c.String(code, err.Error())
 			return
 		}
 
@@ -80,7 +118,7 @@ func OTPVerifyHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	}
 }
 
-func SignInHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+func SignInHandler(endpoint endpoint.Endpoint, issueRefresh endpoint.Endpoint) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req identity.SignInRequest
 		err := c.ShouldBind(&req)
@@ -91,50 +129,166 @@ func SignInHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 			return
 		}
 
-		resp, err := endpoint(c, req)
+		if err := firstPartyClient(req.ClientID); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(c, user.ClientIP, c.ClientIP())
+
+		resp, err := endpoint(ctx, req)
 		if err != nil {
+			code := failedAttemptStatus(c, http.StatusExpectationFailed, err)
 			c.Abort()
 			c.Error(err)
-			c.String(http.StatusExpectationFailed, err.Error())
+			c.String(code, err.Error())
 			return
 		}
 
-		response, ok := resp.(identity.SignInResponse)
-		if !ok {
+		signedIn(c, resp, req.ClientID, issueRefresh)
+	}
+}
+
+// failedAttemptStatus is the status for a failed sign-in attempt: code,
+// unless the user may not sign in at all or has to wait a while.
+func failedAttemptStatus(c *gin.Context, code int, err error) int {
+	var lockedOut *lockout.LockedOutError
+	switch {
+	case errors.As(err, &lockedOut):
+		retryAfter := math.Ceil(time.Until(lockedOut.Until).Seconds())
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter)))
+		return http.StatusTooManyRequests
+	case errors.Is(err, user.ErrUserLocked),
+		errors.Is(err, user.ErrUserNotActivated):
+		return http.StatusForbidden
+	default:
+		return code
+	}
+}
+
+// activeUser looks up the user a token is about to be signed for; only
+// activated users get one.
+func activeUser(c *gin.Context, userEndpoint endpoint.Endpoint, username string) (*user.User, error) {
+	resp, err := userEndpoint(c, username)
+	if err != nil {
+		return nil, err
+	}
+
+	u, ok := resp.(*user.User)
+	if !ok {
+		return nil, errors.New("invalid user response")
+	}
+
+	if err := u.CheckActive(); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// signedIn finishes a sign-in: a pending second factor or link is passed
+// through untouched, otherwise the user gets a freshly signed token, plus a
+// refresh token when issueRefresh is set.
+func signedIn(c *gin.Context, resp any, clientID string, issueRefresh endpoint.Endpoint) {
+	response, ok := resp.(identity.SignInResponse)
+	if !ok {
+		err := errors.New("invalid user")
+		unauthorized(c, http.StatusExpectationFailed, err)
+		return
+	}
+
+	if response.User == nil {
+		if response.SecondFactor == nil && response.LinkRequired == nil {
 			err := errors.New("invalid user")
 			unauthorized(c, http.StatusExpectationFailed, err)
 			return
 		}
 
-		u := response.User
+		c.JSON(http.StatusOK, &response)
+		return
+	}
 
-		cfg := conf.G()
-		now := time.Now()
-		claims := Claims{
-			RegisteredClaims: jwt.RegisteredClaims{
-				Issuer:    cfg.BaseURL,
-				Subject:   u.Username,
-				Audience:  cfg.JWT.Audiences,
-				ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.Timeout)),
-				IssuedAt:  jwt.NewNumericDate(now),
-				ID:        ulid.Make().String(),
-			},
-			Roles: rolesFor(u.Username),
-		}
+	token, err := signToken(response.User.Username, clientID)
+	if err != nil {
+		unauthorized(c, http.StatusExpectationFailed, err)
+		return
+	}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
-		tokenStr, err := token.SignedString(cfg.JWT.Privkey)
+	if issueRefresh != nil {
+		refreshToken, err := issueRefresh(c, refresh.IssueRequest{
+			Subject:  response.User.Username,
+			ClientID: clientID,
+		})
 		if err != nil {
 			unauthorized(c, http.StatusExpectationFailed, err)
 			return
 		}
 
-		response.Token = &identity.Token{
-			Token:     tokenStr,
-			ExpiredAt: now.Add(cfg.JWT.Timeout),
+		token.RefreshToken = refreshToken.(string)
+	}
+
+	response.Token = token
+
+	c.JSON(http.StatusOK, &response)
+}
+
+func VerifySecondFactorHandler(endpoint endpoint.Endpoint, issueRefresh endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req identity.VerifySecondFactorRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
 		}
 
-		c.JSON(http.StatusOK, &response)
+		if err := firstPartyClient(req.ClientID); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			unauthorized(c, failedAttemptStatus(c, http.StatusUnauthorized, err), err)
+			return
+		}
+
+		signedIn(c, resp, req.ClientID, issueRefresh)
+	}
+}
+
+// CompleteLinkHandler links the social account a sign-in was prompted for,
+// and signs the user in to the account it now belongs to.
+func CompleteLinkHandler(endpoint endpoint.Endpoint, issueRefresh endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req identity.CompleteLinkRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := firstPartyClient(req.ClientID); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx := context.WithValue(c, user.ClientIP, c.ClientIP())
+
+		resp, err := endpoint(ctx, req)
+		if err != nil {
+			unauthorized(c, failedAttemptStatus(c, http.StatusUnauthorized, err), err)
+			return
+		}
+
+		signedIn(c, resp, req.ClientID, issueRefresh)
 	}
 }
 
@@ -145,46 +299,62 @@ func unauthorized(c *gin.Context, code int, err error) {
 	c.String(code, err.Error())
 }
 
-func RefreshHandler(c *gin.Context) {
-	cfg := conf.G()
-	if !cfg.JWT.Refresh.Enabled {
-		err := errors.New("token refresh disabled")
-		c.Abort()
-		c.Error(err)
-		c.String(http.StatusForbidden, err.Error())
-		return
-	}
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	ClientID     string `json:"client_id"`
+}
 
-	var claims Claims
-	if err := ParseToken(c, &claims); err != nil {
-		unauthorized(c, http.StatusUnauthorized, err)
-		return
-	}
+// RefreshHandler trades a refresh token for a new access token and the next
+// refresh token of the same family, as long as the user is still active.
+// Without a secret to check, it rotates no token of a confidential client.
+func RefreshHandler(endpoint endpoint.Endpoint, userEndpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
 
-	if time.Since(claims.IssuedAt.Time) > cfg.JWT.Refresh.Maximum {
-		err := errors.New("token beyond refresh time")
-		unauthorized(c, http.StatusForbidden, err)
-		return
-	}
+		if err := firstPartyClient(req.ClientID); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
 
-	now := time.Now()
-	claims.ExpiresAt = jwt.NewNumericDate(now.Add(cfg.JWT.Timeout))
-	claims.IssuedAt = jwt.NewNumericDate(now)
-	claims.ID = ulid.Make().String()
+		resp, err := endpoint(c, refresh.RotateRequest{
+			Token:    req.RefreshToken,
+			ClientID: req.ClientID,
+		})
+		if err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
-	tokenStr, err := token.SignedString(cfg.JWT.Privkey)
-	if err != nil {
-		unauthorized(c, http.StatusExpectationFailed, err)
-		return
-	}
+		rotated, ok := resp.(*refresh.RotateResponse)
+		if !ok {
+			err := errors.New("invalid response")
+			unauthorized(c, http.StatusExpectationFailed, err)
+			return
+		}
 
-	t := identity.Token{
-		Token:     tokenStr,
-		ExpiredAt: now.Add(cfg.JWT.Timeout),
-	}
+		if _, err := activeUser(c, userEndpoint, rotated.Subject); err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
 
-	c.JSON(http.StatusOK, &t)
+		token, err := signToken(rotated.Subject, rotated.ClientID, rotated.Scope...)
+		if err != nil {
+			unauthorized(c, http.StatusExpectationFailed, err)
+			return
+		}
+
+		token.RefreshToken = rotated.Token
+
+		c.JSON(http.StatusOK, &token)
+	}
 }
 
 func AddSocialAccountHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
@@ -274,7 +444,209 @@ func UserHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	}
 }
 
-func DeleteUserHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+// UsersHandler pages through users. Filters: status (repeatable),
+// provider, created_after and created_before (RFC 3339), username_prefix
+// and email_prefix; sort is "created" or "-created".
+func UsersHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := parseUserQuery(c)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := endpoint(c, q)
+		if err != nil {
+			code := http.StatusExpectationFailed
+			if errors.Is(err, user.ErrCursorInvalid) {
+				code = http.StatusBadRequest
+			}
+
+			c.Abort()
+			c.Error(err)
+			c.String(code, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func parseUserQuery(c *gin.Context) (*user.Query, error) {
+	q := &user.Query{
+		Provider:       user.SocialProvider(c.Query("provider")),
+		UsernamePrefix: c.Query("username_prefix"),
+		EmailPrefix:    c.Query("email_prefix"),
+		Cursor:         c.Query("cursor"),
+	}
+
+	for _, raw := range c.QueryArray("status") {
+		status, err := user.ParseStatus(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		q.Status = append(q.Status, status)
+	}
+
+	for _, t := range []struct {
+		param string
+		dst   *time.Time
+	}{
+		{"created_after", &q.CreatedAfter},
+		{"created_before", &q.CreatedBefore},
+	} {
+		raw := c.Query(t.param)
+		if raw == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, errors.New("invalid " + t.param)
+		}
+
+		*t.dst = parsed
+	}
+
+	sort, err := user.ParseSort(c.Query("sort"))
+	if err != nil {
+		return nil, err
+	}
+
+	q.Sort = sort
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, errors.New("invalid limit")
+		}
+
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+// SearchUsersHandler finds users by part of a name, username, email or
+// social ID, given as q.
+func SearchUsersHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := identity.SearchUsersRequest{
+			Query: c.Query("q"),
+		}
+
+		if raw := c.Query("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 {
+				err := errors.New("invalid limit")
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+
+			req.Limit = limit
+		}
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			code := http.StatusExpectationFailed
+			if errors.Is(err, user.ErrSearchQueryEmpty) {
+				code = http.StatusBadRequest
+			}
+
+			c.Abort()
+			c.Error(err)
+			c.String(code, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+// UpdateUserHandler updates the user. A renaming ends the sessions issued
+// under the former username through revokeSessions, which are called with
+// it: once released, the name may be taken by someone else.
+func UpdateUserHandler(endpoint endpoint.Endpoint, revokeSessions ...endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req identity.UpdateUserRequest
+		if err := c.ShouldBindJSON(&req.Changes); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Username = username
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		if u, ok := resp.(*user.User); ok && req.Changes.Username != nil && u.Username != username {
+			for _, revoke := range revokeSessions {
+				if _, err := revoke(c, username); err != nil {
+					c.Abort()
+					c.Error(err)
+					c.String(http.StatusExpectationFailed, err.Error())
+					return
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func VerifyEmailHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req identity.VerifyEmailRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Username = username
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func SendEmailVerificationHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username := c.Param("user")
 		if username == "" {
@@ -293,10 +665,215 @@ func DeleteUserHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 			return
 		}
 
+		c.String(http.StatusOK, "verification sent")
+	}
+}
+
+// ConfirmEmailVerificationHandler is where the mailed link lands, so it
+// answers in plain text for a browser rather than in JSON.
+func ConfirmEmailVerificationHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			err := errors.New("token required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		_, err := endpoint(c, token)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.String(http.StatusOK, "Email verified! You can close this window now.")
+	}
+}
+
+// DeleteUserHandler deletes the user, then ends their sessions through
+// revokeSessions, which are called with the username.
+func DeleteUserHandler(endpoint endpoint.Endpoint, revokeSessions ...endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		_, err := endpoint(c, username)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		for _, revoke := range revokeSessions {
+			if _, err := revoke(c, username); err != nil {
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusExpectationFailed, err.Error())
+				return
+			}
+		}
+
 		c.String(http.StatusOK, "user deleted")
 	}
 }
 
+// LockUserHandler locks the user, then ends their sessions through
+// revokeSessions, which are called with the username.
+func LockUserHandler(endpoint endpoint.Endpoint, revokeSessions ...endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req identity.LockUserRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBind(&req); err != nil {
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		req.Username = username
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		for _, revoke := range revokeSessions {
+			if _, err := revoke(c, username); err != nil {
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusExpectationFailed, err.Error())
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func UnlockUserHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := endpoint(c, username)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+// SignOutHandler revokes the bearer token and, when the body carries one,
+// the refresh token of the same session; a refresh token of another user
+// or client is left alone.
+func SignOutHandler(revoke endpoint.Endpoint, revokeRefresh endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Whatever client the token was issued to, it may sign itself out.
+		var claims Claims
+		if err := parseToken(c, &claims); err != nil {
+			unauthorized(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		var req RefreshRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBind(&req); err != nil {
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		_, err := revoke(c, revocation.RevokeRequest{
+			ID:        claims.ID,
+			Subject:   claims.Subject,
+			ExpiresAt: claims.ExpiresAt.Time,
+		})
+
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		if req.RefreshToken != "" && revokeRefresh != nil {
+			if _, err := revokeRefresh(c, refresh.RevokeRequest{
+				Token:    req.RefreshToken,
+				Subject:  claims.Subject,
+				ClientID: claims.ClientID,
+			}); err != nil {
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusExpectationFailed, err.Error())
+				return
+			}
+		}
+
+		c.String(http.StatusOK, "signed out")
+	}
+}
+
+// RevokeSessionsHandler ends every session of a user: each endpoint is
+// called with the username.
+func RevokeSessionsHandler(revokeSessions ...endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		for _, revoke := range revokeSessions {
+			if _, err := revoke(c, username); err != nil {
+				c.Abort()
+				c.Error(err)
+				c.String(http.StatusExpectationFailed, err.Error())
+				return
+			}
+		}
+
+		c.String(http.StatusOK, "sessions revoked")
+	}
+}
+
 func RegisterPasskeyHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		username := c.Param("user")
@@ -320,20 +897,24 @@ func RegisterPasskeyHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	}
 }
 
-func DirectUserBySocialIDHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+func DirectUserBySocialAccountHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		provider := c.Param("provider")
 		subject := c.Param("subject")
-		if subject == "" {
-			err := errors.New("subject required")
+		if provider == "" || subject == "" {
+			err := errors.New("provider and subject required")
 			c.Abort()
 			c.Error(err)
 			c.String(http.StatusBadRequest, err.Error())
 			return
 		}
 
-		socialID := user.SocialID(subject)
+		req := identity.UserBySocialAccountRequest{
+			Provider: user.SocialProvider(provider),
+			SocialID: user.SocialID(subject),
+		}
 
-		resp, err := endpoint(c, socialID)
+		resp, err := endpoint(c, req)
 		if err != nil {
 			c.Abort()
 			c.Error(err)
@@ -350,23 +931,14 @@ func DirectUserBySocialIDHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 			return
 		}
 
-		cfg := conf.G()
-		now := time.Now()
-
-		claims := Claims{
-			RegisteredClaims: jwt.RegisteredClaims{
-				Issuer:    cfg.BaseURL,
-				Subject:   u.Username,
-				Audience:  cfg.JWT.Audiences,
-				ExpiresAt: jwt.NewNumericDate(now.Add(cfg.JWT.Timeout)),
-				IssuedAt:  jwt.NewNumericDate(now),
-				ID:        ulid.Make().String(),
-			},
-			Roles: rolesFor(u.Username),
+		if err := u.CheckActive(); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusForbidden, err.Error())
+			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
-		tokenStr, err := token.SignedString(cfg.JWT.Privkey)
+		token, err := signToken(u.Username, "")
 		if err != nil {
 			c.Abort()
 			c.Error(err)
@@ -375,13 +947,97 @@ func DirectUserBySocialIDHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
 		}
 
 		response := &identity.SignInResponse{
-			User: u,
-			Token: &identity.Token{
-				Token:     tokenStr,
-				ExpiredAt: now.Add(cfg.JWT.Timeout),
-			},
+			User:  u,
+			Token: token,
 		}
 
 		c.JSON(http.StatusOK, &response)
 	}
 }
+
+func EnrollTOTPHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := endpoint(c, username)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func ConfirmTOTPHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req identity.TOTPRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Username = username
+
+		resp, err := endpoint(c, req)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, &resp)
+	}
+}
+
+func DisableTOTPHandler(endpoint endpoint.Endpoint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.Param("user")
+		if username == "" {
+			err := errors.New("user required")
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req identity.TOTPRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Username = username
+
+		_, err := endpoint(c, req)
+		if err != nil {
+			c.Abort()
+			c.Error(err)
+			c.String(http.StatusExpectationFailed, err.Error())
+			return
+		}
+
+		c.String(http.StatusOK, "totp disabled")
+	}
+}
@@ -145,6 +145,7 @@ func AuthCallback(signInEndpoint endpoint.Endpoint, addSocialAccountEndpoint end
 
 		ctx := c.Request.Context()
 		ctx = context.WithValue(ctx, user.Nonce, session.Nonce)
+		ctx = context.WithValue(ctx, user.ClientIP, c.ClientIP())
 
 		token, err := config.Exchange(ctx, code)
 		if err != nil {
@@ -11,6 +11,9 @@ import (
 
 	"github.com/flarexio/core/pubsub"
 	"github.com/flarexio/identity"
+	"github.com/flarexio/identity/oidc"
+	"github.com/flarexio/identity/revocation"
+	"github.com/flarexio/identity/token"
 	"github.com/flarexio/identity/user"
 )
 
@@ -60,6 +63,83 @@ func EventHandler(endpoint endpoint.Endpoint) pubsub.MessageHandler {
 			}
 			event = e
 
+		case user.UserTOTPEnrolled:
+			var e *user.UserTOTPEnrolledEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserTOTPConfirmed:
+			var e *user.UserTOTPConfirmedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserTOTPDisabled:
+			var e *user.UserTOTPDisabledEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserRecoveryCodeUsed:
+			var e *user.UserRecoveryCodeUsedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserProfileUpdated:
+			var e *user.UserProfileUpdatedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserRenamed:
+			var e *user.UserRenamedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserEmailChangeRequested:
+			var e *user.UserEmailChangeRequestedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserEmailChanged:
+			var e *user.UserEmailChangedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserEmailVerified:
+			var e *user.UserEmailVerifiedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserLocked:
+			var e *user.UserLockedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
+		case user.UserUnlocked:
+			var e *user.UserUnlockedEvent
+			if err := json.Unmarshal(msg.Data, &e); err != nil {
+				return err
+			}
+			event = e
+
 		default:
 			return errors.New("unknown event")
 		}
@@ -69,6 +149,19 @@ func EventHandler(endpoint endpoint.Endpoint) pubsub.MessageHandler {
 	}
 }
 
+// RevocationHandler applies revocations broadcast by other instances.
+func RevocationHandler(endpoint endpoint.Endpoint) pubsub.MessageHandler {
+	return func(ctx context.Context, msg *pubsub.Message) error {
+		var r *revocation.Revocation
+		if err := json.Unmarshal(msg.Data, &r); err != nil {
+			return err
+		}
+
+		_, err := endpoint(ctx, r)
+		return err
+	}
+}
+
 func SignInHandler(endpoint endpoint.Endpoint) micro.HandlerFunc {
 	return func(r micro.Request) {
 		var req identity.SignInRequest
@@ -87,3 +180,101 @@ func SignInHandler(endpoint endpoint.Endpoint) micro.HandlerFunc {
 		r.RespondJSON(&resp)
 	}
 }
+
+// Authorize tells whether a bearer token may call an endpoint; the error
+// is for a token that does not verify.
+type Authorize func(ctx context.Context, token string) (bool, error)
+
+// SearchUsersHandler serves admin tooling on the bus. Like its HTTP
+// counterpart it takes an admin token, in the Authorization header.
+func SearchUsersHandler(endpoint endpoint.Endpoint, authorize Authorize) micro.HandlerFunc {
+	return func(r micro.Request) {
+		ctx := context.Background()
+
+		token, ok := strings.CutPrefix(r.Headers().Get("Authorization"), "Bearer ")
+		if !ok {
+			r.Error("401", "invalid token", nil)
+			return
+		}
+
+		allowed, err := authorize(ctx, token)
+		if err != nil {
+			r.Error("401", err.Error(), nil)
+			return
+		}
+
+		if !allowed {
+			r.Error("403", "forbidden", nil)
+			return
+		}
+
+		var req identity.SearchUsersRequest
+		if err := json.Unmarshal(r.Data(), &req); err != nil {
+			r.Error("400", err.Error(), nil)
+			return
+		}
+
+		resp, err := endpoint(ctx, req)
+		if err != nil {
+			if errors.Is(err, user.ErrSearchQueryEmpty) {
+				r.Error("400", err.Error(), nil)
+				return
+			}
+
+			r.Error("417", err.Error(), nil)
+			return
+		}
+
+		r.RespondJSON(&resp)
+	}
+}
+
+// IntrospectHandler serves consumers on the bus that cannot verify tokens
+// themselves; like its HTTP counterpart, it needs client credentials.
+func IntrospectHandler(endpoint endpoint.Endpoint) micro.HandlerFunc {
+	return func(r micro.Request) {
+		var req token.Request
+		if err := json.Unmarshal(r.Data(), &req); err != nil {
+			r.Error("400", err.Error(), nil)
+			return
+		}
+
+		ctx := context.Background()
+		resp, err := endpoint(ctx, req)
+		if err != nil {
+			r.Error(tokenErrorCode(err), err.Error(), nil)
+			return
+		}
+
+		r.RespondJSON(&resp)
+	}
+}
+
+func RevokeHandler(endpoint endpoint.Endpoint) micro.HandlerFunc {
+	return func(r micro.Request) {
+		var req token.Request
+		if err := json.Unmarshal(r.Data(), &req); err != nil {
+			r.Error("400", err.Error(), nil)
+			return
+		}
+
+		ctx := context.Background()
+		if _, err := endpoint(ctx, req); err != nil {
+			r.Error(tokenErrorCode(err), err.Error(), nil)
+			return
+		}
+
+		r.Respond(nil)
+	}
+}
+
+func tokenErrorCode(err error) string {
+	switch {
+	case errors.Is(err, oidc.ErrInvalidClient):
+		return "401"
+	case errors.Is(err, oidc.ErrUnauthorizedClient):
+		return "403"
+	default:
+		return "417"
+	}
+}
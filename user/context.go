@@ -3,5 +3,6 @@ package user
 type ContextKey string
 
 const (
-	Nonce ContextKey = "nonce"
+	Nonce    ContextKey = "nonce"
+	ClientIP ContextKey = "client_ip" // set by transports, for lockouts per client
 )
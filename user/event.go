@@ -17,6 +17,17 @@ const (
 	UserSocialAccountAdded
 	UserSocialAccountRemoved
 	UserDeleted
+	UserTOTPEnrolled
+	UserTOTPConfirmed
+	UserTOTPDisabled
+	UserRecoveryCodeUsed
+	UserProfileUpdated
+	UserRenamed
+	UserEmailChangeRequested
+	UserEmailChanged
+	UserEmailVerified
+	UserLocked
+	UserUnlocked
 )
 
 func ParseEventName(s string) EventName {
@@ -31,6 +42,28 @@ func ParseEventName(s string) EventName {
 		return UserSocialAccountRemoved
 	case "user_deleted":
 		return UserDeleted
+	case "user_totp_enrolled":
+		return UserTOTPEnrolled
+	case "user_totp_confirmed":
+		return UserTOTPConfirmed
+	case "user_totp_disabled":
+		return UserTOTPDisabled
+	case "user_recovery_code_used":
+		return UserRecoveryCodeUsed
+	case "user_profile_updated":
+		return UserProfileUpdated
+	case "user_renamed":
+		return UserRenamed
+	case "user_email_change_requested":
+		return UserEmailChangeRequested
+	case "user_email_changed":
+		return UserEmailChanged
+	case "user_email_verified":
+		return UserEmailVerified
+	case "user_locked":
+		return UserLocked
+	case "user_unlocked":
+		return UserUnlocked
 	default:
 		return Unknown
 	}
@@ -48,6 +81,28 @@ func (name EventName) String() string {
 		return "user_social_account_removed"
 	case UserDeleted:
 		return "user_deleted"
+	case UserTOTPEnrolled:
+		return "user_totp_enrolled"
+	case UserTOTPConfirmed:
+		return "user_totp_confirmed"
+	case UserTOTPDisabled:
+		return "user_totp_disabled"
+	case UserRecoveryCodeUsed:
+		return "user_recovery_code_used"
+	case UserProfileUpdated:
+		return "user_profile_updated"
+	case UserRenamed:
+		return "user_renamed"
+	case UserEmailChangeRequested:
+		return "user_email_change_requested"
+	case UserEmailChanged:
+		return "user_email_changed"
+	case UserEmailVerified:
+		return "user_email_verified"
+	case UserLocked:
+		return "user_locked"
+	case UserUnlocked:
+		return "user_unlocked"
 	default:
 		return ""
 	}
@@ -150,3 +205,133 @@ func NewUserDeletedEvent(u *User) events.DomainEvent {
 		Event: NewEvent(UserDeleted, u),
 	}
 }
+
+type UserTOTPEnrolledEvent struct {
+	*Event
+	Secret string `json:"secret"` // sealed
+}
+
+func NewUserTOTPEnrolledEvent(u *User, secret string) events.DomainEvent {
+	return &UserTOTPEnrolledEvent{
+		Event:  NewEvent(UserTOTPEnrolled, u),
+		Secret: secret,
+	}
+}
+
+type UserTOTPConfirmedEvent struct {
+	*Event
+	RecoveryCodes []string `json:"recovery_codes"` // hashed
+}
+
+func NewUserTOTPConfirmedEvent(u *User, recoveryCodes []string) events.DomainEvent {
+	return &UserTOTPConfirmedEvent{
+		Event:         NewEvent(UserTOTPConfirmed, u),
+		RecoveryCodes: recoveryCodes,
+	}
+}
+
+type UserTOTPDisabledEvent struct {
+	*Event
+}
+
+func NewUserTOTPDisabledEvent(u *User) events.DomainEvent {
+	return &UserTOTPDisabledEvent{
+		Event: NewEvent(UserTOTPDisabled, u),
+	}
+}
+
+type UserRecoveryCodeUsedEvent struct {
+	*Event
+	RecoveryCode string `json:"recovery_code"` // hashed
+}
+
+func NewUserRecoveryCodeUsedEvent(u *User, hash string) events.DomainEvent {
+	return &UserRecoveryCodeUsedEvent{
+		Event:        NewEvent(UserRecoveryCodeUsed, u),
+		RecoveryCode: hash,
+	}
+}
+
+type UserProfileUpdatedEvent struct {
+	*Event
+	Profile Profile `json:"profile"`
+}
+
+func NewUserProfileUpdatedEvent(u *User, profile Profile) events.DomainEvent {
+	return &UserProfileUpdatedEvent{
+		Event:   NewEvent(UserProfileUpdated, u),
+		Profile: profile,
+	}
+}
+
+type UserRenamedEvent struct {
+	*Event
+	Username       string `json:"username"`
+	FormerUsername string `json:"former_username"`
+}
+
+func NewUserRenamedEvent(u *User, former string) events.DomainEvent {
+	return &UserRenamedEvent{
+		Event:          NewEvent(UserRenamed, u),
+		Username:       u.Username,
+		FormerUsername: former,
+	}
+}
+
+type UserEmailChangeRequestedEvent struct {
+	*Event
+	Email string `json:"email"`
+}
+
+func NewUserEmailChangeRequestedEvent(u *User, email string) events.DomainEvent {
+	return &UserEmailChangeRequestedEvent{
+		Event: NewEvent(UserEmailChangeRequested, u),
+		Email: email,
+	}
+}
+
+type UserEmailChangedEvent struct {
+	*Event
+	Email string `json:"email"`
+}
+
+func NewUserEmailChangedEvent(u *User, email string) events.DomainEvent {
+	return &UserEmailChangedEvent{
+		Event: NewEvent(UserEmailChanged, u),
+		Email: email,
+	}
+}
+
+type UserEmailVerifiedEvent struct {
+	*Event
+	Email string `json:"email"`
+}
+
+func NewUserEmailVerifiedEvent(u *User, email string) events.DomainEvent {
+	return &UserEmailVerifiedEvent{
+		Event: NewEvent(UserEmailVerified, u),
+		Email: email,
+	}
+}
+
+type UserLockedEvent struct {
+	*Event
+	Reason string `json:"reason,omitempty"`
+}
+
+func NewUserLockedEvent(u *User, reason string) events.DomainEvent {
+	return &UserLockedEvent{
+		Event:  NewEvent(UserLocked, u),
+		Reason: reason,
+	}
+}
+
+type UserUnlockedEvent struct {
+	*Event
+}
+
+func NewUserUnlockedEvent(u *User) events.DomainEvent {
+	return &UserUnlockedEvent{
+		Event: NewEvent(UserUnlocked, u),
+	}
+}
@@ -0,0 +1,42 @@
+package user
+
+import "errors"
+
+var ErrLinkPolicyInvalid = errors.New("invalid link policy")
+
+// LinkPolicy decides what a sign-in with an unknown social account does
+// when its email already belongs to a user. The zero value never links,
+// leaving the sign-in to create a user of its own.
+type LinkPolicy int
+
+const (
+	LinkNever    LinkPolicy = iota
+	LinkVerified            // link when both the provider and the user vouch for the email
+	LinkPrompt              // link once the user proves they own the existing account
+)
+
+func ParseLinkPolicy(policy string) (LinkPolicy, error) {
+	switch policy {
+	case "", "never":
+		return LinkNever, nil
+	case "verified":
+		return LinkVerified, nil
+	case "prompt":
+		return LinkPrompt, nil
+	default:
+		return -1, ErrLinkPolicyInvalid
+	}
+}
+
+func (p LinkPolicy) String() string {
+	switch p {
+	case LinkNever:
+		return "never"
+	case LinkVerified:
+		return "verified"
+	case LinkPrompt:
+		return "prompt"
+	default:
+		return "unknown"
+	}
+}
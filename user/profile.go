@@ -0,0 +1,137 @@
+package user
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrMergePolicyInvalid = errors.New("invalid merge policy")
+
+// Profile is the part of a user a social provider may also know about.
+type Profile struct {
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Avatar string `json:"avatar"`
+}
+
+// MergePolicy decides whether a provider's value replaces the stored one.
+// The zero value only fills in what is missing.
+type MergePolicy int
+
+const (
+	MergeIfEmpty MergePolicy = iota
+	MergeAlways
+	MergeNever
+)
+
+func ParseMergePolicy(policy string) (MergePolicy, error) {
+	switch policy {
+	case "", "ifEmpty":
+		return MergeIfEmpty, nil
+	case "always":
+		return MergeAlways, nil
+	case "never":
+		return MergeNever, nil
+	default:
+		return -1, ErrMergePolicyInvalid
+	}
+}
+
+func (p MergePolicy) String() string {
+	switch p {
+	case MergeIfEmpty:
+		return "ifEmpty"
+	case MergeAlways:
+		return "always"
+	case MergeNever:
+		return "never"
+	default:
+		return "unknown"
+	}
+}
+
+// Merge returns the value to keep. A provider that sends nothing never
+// blanks out a stored value, whatever the policy.
+func (p MergePolicy) Merge(current string, incoming string) string {
+	if incoming == "" {
+		return current
+	}
+
+	switch p {
+	case MergeAlways:
+		return incoming
+	case MergeIfEmpty:
+		if current == "" {
+			return incoming
+		}
+	}
+
+	return current
+}
+
+// ProfilePolicy holds a MergePolicy per profile field.
+type ProfilePolicy struct {
+	Name   MergePolicy
+	Email  MergePolicy
+	Avatar MergePolicy
+}
+
+func NewProfilePolicy(name string, email string, avatar string) (ProfilePolicy, error) {
+	var (
+		p   ProfilePolicy
+		err error
+	)
+
+	if p.Name, err = ParseMergePolicy(name); err != nil {
+		return p, err
+	}
+
+	if p.Email, err = ParseMergePolicy(email); err != nil {
+		return p, err
+	}
+
+	if p.Avatar, err = ParseMergePolicy(avatar); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (p ProfilePolicy) Merge(current Profile, incoming Profile) Profile {
+	return Profile{
+		Name:   p.Name.Merge(current.Name, incoming.Name),
+		Email:  p.Email.Merge(current.Email, incoming.Email),
+		Avatar: p.Avatar.Merge(current.Avatar, incoming.Avatar),
+	}
+}
+
+func (u *User) Profile() Profile {
+	return Profile{
+		Name:   u.Name,
+		Email:  u.Email,
+		Avatar: u.Avatar,
+	}
+}
+
+// UpdateProfile reports whether anything changed; an unchanged profile
+// raises no event.
+func (u *User) UpdateProfile(profile Profile) bool {
+	if u.Profile() == profile {
+		return false
+	}
+
+	// Nothing vouches for an address that came from elsewhere.
+	if profile.Email != u.Email {
+		u.EmailVerified = false
+	}
+
+	u.Name = profile.Name
+	u.Email = profile.Email
+	u.Avatar = profile.Avatar
+	u.UpdatedAt = time.Now()
+
+	e := NewUserProfileUpdatedEvent(u, profile)
+	u.AddEvent(e)
+
+	return true
+}
@@ -0,0 +1,151 @@
+package user
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCursorInvalid = errors.New("invalid cursor")
+	ErrSortInvalid   = errors.New("invalid sort")
+)
+
+const (
+	DefaultQueryLimit = 50
+	MaxQueryLimit     = 200
+)
+
+// Sort orders users by ID. IDs are ULIDs, so this is creation order too,
+// and a cursor stays valid however many users are added meanwhile.
+type Sort int
+
+const (
+	SortOldest Sort = iota
+	SortNewest
+)
+
+func ParseSort(sort string) (Sort, error) {
+	switch sort {
+	case "", "created":
+		return SortOldest, nil
+	case "-created":
+		return SortNewest, nil
+	default:
+		return -1, ErrSortInvalid
+	}
+}
+
+func (s Sort) String() string {
+	switch s {
+	case SortOldest:
+		return "created"
+	case SortNewest:
+		return "-created"
+	default:
+		return "unknown"
+	}
+}
+
+// Query selects a page of users. Zero fields do not filter.
+type Query struct {
+	Status         []Status // any of
+	Provider       SocialProvider
+	CreatedAfter   time.Time // inclusive
+	CreatedBefore  time.Time // exclusive
+	UsernamePrefix string
+	EmailPrefix    string
+
+	Sort   Sort
+	Cursor string // NextCursor of the previous page
+	Limit  int
+}
+
+// Page holds the users of a query. NextCursor is empty on the last page.
+type Page struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Size is the limit within bounds.
+func (q *Query) Size() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultQueryLimit
+	case q.Limit > MaxQueryLimit:
+		return MaxQueryLimit
+	default:
+		return q.Limit
+	}
+}
+
+// CursorID decodes the cursor: the ID of the last user seen.
+func (q *Query) CursorID() (*UserID, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	id, err := ParseID(q.Cursor)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	return &id, nil
+}
+
+// Follows tells whether id comes after the cursor in the sort order.
+func (q *Query) Follows(id UserID, cursor *UserID) bool {
+	if cursor == nil {
+		return true
+	}
+
+	if q.Sort == SortNewest {
+		return id.Compare(*cursor) < 0
+	}
+
+	return id.Compare(*cursor) > 0
+}
+
+// Match tells whether the user passes the filters; for stores without
+// indexes of their own to filter by.
+func (q *Query) Match(u *User) bool {
+	if len(q.Status) > 0 && !slices.Contains(q.Status, u.Status) {
+		return false
+	}
+
+	if q.Provider != "" && !slices.ContainsFunc(u.Accounts, func(a *SocialAccount) bool {
+		return a.Provider == q.Provider
+	}) {
+		return false
+	}
+
+	if !q.CreatedAfter.IsZero() && u.CreatedAt.Before(q.CreatedAfter) {
+		return false
+	}
+
+	if !q.CreatedBefore.IsZero() && !u.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+
+	if !strings.HasPrefix(u.Username, q.UsernamePrefix) {
+		return false
+	}
+
+	return strings.HasPrefix(u.Email, q.EmailPrefix)
+}
+
+// NewPage cuts a page from users fetched one past the limit, so the extra
+// one tells whether another page follows.
+func NewPage(users []*User, limit int) *Page {
+	if len(users) <= limit {
+		return &Page{Users: users}
+	}
+
+	users = users[:limit]
+
+	return &Page{
+		Users:      users,
+		NextCursor: users[limit-1].ID.String(),
+	}
+}
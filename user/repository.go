@@ -3,15 +3,19 @@ package user
 type Repository interface {
 	// Command
 
+	// Store and Delete fail with ErrConcurrentModification unless the
+	// stored user is still at u.Version; Store then bumps u.Version.
 	Store(u *User) error
 	Delete(u *User) error
 
 	// Query
 
 	ListAll() ([]*User, error)
+	Query(q *Query) (*Page, error)
 	Find(id UserID) (*User, error)
 	FindByUsername(username string) (*User, error)
-	FindBySocialID(socialID SocialID) (*User, error)
+	FindBySocialAccount(provider SocialProvider, socialID SocialID) (*User, error)
+	FindByEmail(email string) ([]*User, error) // emails are not unique, so all holders
 
 	// Close the repository
 	Close() error
@@ -0,0 +1,32 @@
+package user
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrReservationNotFound = errors.New("reservation not found")
+
+// Reservation holds back the username a user gave up, so that nobody else
+// can take it, and with it whatever still refers to it, until it expires.
+type Reservation struct {
+	Username  string    `json:"username"`
+	UserID    UserID    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ReservationStore keeps reservations until they expire; expired ones are
+// never returned.
+type ReservationStore interface {
+	// Command
+
+	Reserve(r *Reservation) error
+	Release(username string) error
+
+	// Query
+
+	Find(username string) (*Reservation, error)
+
+	// Close the store
+	Close() error
+}
@@ -0,0 +1,67 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrSearchQueryEmpty = errors.New("search query empty")
+
+// SearchIndex finds users from what support staff know of them: part of a
+// name, username, email or social ID. It is derived from the users and
+// kept current by the event handlers, so it can always be rebuilt.
+type SearchIndex interface {
+	// Command
+
+	Index(u *User) error
+	Remove(id UserID) error
+
+	// Query
+
+	// Search returns the IDs of the users matching every term of the query,
+	// best match first. A term matches any word it is a prefix of.
+	Search(query string, limit int) ([]UserID, error)
+
+	// Close the index
+	Close() error
+}
+
+// Tokenize splits text into lower-case words at anything not a letter or
+// digit.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchTerms are the words a user is found by, each once.
+func SearchTerms(u *User) []string {
+	seen := make(map[string]struct{})
+	terms := make([]string, 0)
+
+	add := func(words ...string) {
+		for _, word := range words {
+			if word == "" {
+				continue
+			}
+
+			if _, ok := seen[word]; ok {
+				continue
+			}
+
+			seen[word] = struct{}{}
+			terms = append(terms, word)
+		}
+	}
+
+	add(Tokenize(u.Name)...)
+	add(Tokenize(u.Username)...)
+	add(Tokenize(u.Email)...)
+
+	for _, account := range u.Accounts {
+		add(Tokenize(string(account.SocialID))...)
+	}
+
+	return terms
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"encoding/json"
 	"errors"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,7 +14,30 @@ import (
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserExists       = errors.New("user exists")
+	ErrUsernameInvalid  = errors.New("invalid username")
+	ErrUsernameReserved = errors.New("username reserved")
+	ErrEmailInvalid     = errors.New("invalid email")
+	ErrNameInvalid      = errors.New("invalid name")
+	ErrAvatarInvalid    = errors.New("invalid avatar")
+
+	ErrUserNotActivated = errors.New("user not activated")
+	ErrUserLocked       = errors.New("user locked")
+	ErrUserNotLocked    = errors.New("user not locked")
+
+	ErrEmailChangeNotRequested = errors.New("email change not requested")
+	ErrEmailAlreadyVerified    = errors.New("email already verified")
+
+	ErrSocialAccountExists = errors.New("social account exists")
+
+	// ErrConcurrentModification is returned by a repository when the user
+	// has been stored or deleted since it was read.
+	ErrConcurrentModification = errors.New("concurrent modification")
+
+	ErrTOTPNotEnrolled     = errors.New("totp not enrolled")
+	ErrTOTPAlreadyEnabled  = errors.New("totp already enabled")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid")
 )
 
 type Status int
@@ -103,6 +127,11 @@ func (id UserID) String() string {
 	return ulid.ULID(id).String()
 }
 
+// Compare orders IDs by creation time first.
+func (id UserID) Compare(other UserID) int {
+	return ulid.ULID(id).Compare(ulid.ULID(other))
+}
+
 func (id UserID) Time() time.Time {
 	ms := ulid.ULID(id).Time()
 	return ulid.Time(ms)
@@ -136,8 +165,16 @@ type User struct {
 	Status   Status           `json:"status"`
 	Accounts []*SocialAccount `json:"accounts"`
 	Avatar   string           `json:"avatar"`
+	TOTP     *TOTP            `json:"totp,omitempty"`
+
+	EmailVerified bool   `json:"email_verified"`
+	PendingEmail  string `json:"pending_email,omitempty"` // awaiting verification
 	model.Model
 
+	// Version counts the stores of the user; 0 until it is first stored. A
+	// repository stores a user only over the version it was read at.
+	Version int `json:"version"`
+
 	events.EventStore `json:"-"`
 }
 
@@ -177,6 +214,108 @@ func (u *User) Activate() {
 	u.AddEvent(e)
 }
 
+// Rename keeps the former username in the event, so it can be held back
+// from everybody else for a while.
+func (u *User) Rename(username string) {
+	former := u.Username
+
+	u.Username = username
+	u.UpdatedAt = time.Now()
+
+	e := NewUserRenamedEvent(u, former)
+	u.AddEvent(e)
+}
+
+// RequestEmailChange parks the address until its owner proves to receive
+// mail there; the current email stays in use meanwhile.
+func (u *User) RequestEmailChange(email string) {
+	u.PendingEmail = email
+	u.UpdatedAt = time.Now()
+
+	e := NewUserEmailChangeRequestedEvent(u, email)
+	u.AddEvent(e)
+}
+
+func (u *User) ConfirmEmailChange() error {
+	if u.PendingEmail == "" {
+		return ErrEmailChangeNotRequested
+	}
+
+	// The code reached the new address, which proves it as well.
+	u.Email = u.PendingEmail
+	u.EmailVerified = true
+	u.PendingEmail = ""
+	u.UpdatedAt = time.Now()
+
+	e := NewUserEmailChangedEvent(u, u.Email)
+	u.AddEvent(e)
+
+	return nil
+}
+
+// VerifyEmail records that the current email is proven to reach the user.
+func (u *User) VerifyEmail() error {
+	if u.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	u.EmailVerified = true
+	u.UpdatedAt = time.Now()
+
+	e := NewUserEmailVerifiedEvent(u, u.Email)
+	u.AddEvent(e)
+
+	return nil
+}
+
+// HasVerifiedEmail tells whether an account may be linked to the user on
+// the strength of the email address alone.
+func (u *User) HasVerifiedEmail(email string) bool {
+	return u.EmailVerified && email != "" && u.Email == email
+}
+
+// CheckActive tells whether the user may be given tokens: only activated
+// users are.
+func (u *User) CheckActive() error {
+	switch u.Status {
+	case Activated:
+		return nil
+	case Locked:
+		return ErrUserLocked
+	default:
+		return ErrUserNotActivated
+	}
+}
+
+// Lock keeps an activated user from signing in until Unlock.
+func (u *User) Lock(reason string) error {
+	if u.Status != Activated {
+		return u.CheckActive()
+	}
+
+	u.Status = Locked
+	u.UpdatedAt = time.Now()
+
+	e := NewUserLockedEvent(u, reason)
+	u.AddEvent(e)
+
+	return nil
+}
+
+func (u *User) Unlock() error {
+	if u.Status != Locked {
+		return ErrUserNotLocked
+	}
+
+	u.Status = Activated
+	u.UpdatedAt = time.Now()
+
+	e := NewUserUnlockedEvent(u)
+	u.AddEvent(e)
+
+	return nil
+}
+
 func (u *User) Delete() {
 	now := time.Now()
 	u.Status = Revoked
@@ -187,6 +326,83 @@ func (u *User) Delete() {
 	u.AddEvent(e)
 }
 
+// EnrollTOTP starts (or restarts) enrollment with a sealed secret; the
+// second factor is not enforced until ConfirmTOTP.
+func (u *User) EnrollTOTP(secret string) error {
+	if u.TOTPEnabled() {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	u.TOTP = &TOTP{
+		Secret: secret,
+	}
+	u.UpdatedAt = time.Now()
+
+	e := NewUserTOTPEnrolledEvent(u, secret)
+	u.AddEvent(e)
+
+	return nil
+}
+
+func (u *User) ConfirmTOTP(recoveryCodes []string) error {
+	if u.TOTP == nil {
+		return ErrTOTPNotEnrolled
+	}
+
+	if u.TOTP.Enabled {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	now := time.Now()
+	u.TOTP.Enabled = true
+	u.TOTP.RecoveryCodes = recoveryCodes
+	u.TOTP.ConfirmedAt = now
+	u.UpdatedAt = now
+
+	e := NewUserTOTPConfirmedEvent(u, recoveryCodes)
+	u.AddEvent(e)
+
+	return nil
+}
+
+func (u *User) DisableTOTP() error {
+	if u.TOTP == nil {
+		return ErrTOTPNotEnrolled
+	}
+
+	u.TOTP = nil
+	u.UpdatedAt = time.Now()
+
+	e := NewUserTOTPDisabledEvent(u)
+	u.AddEvent(e)
+
+	return nil
+}
+
+// UseRecoveryCode burns a recovery code, identified by its hash.
+func (u *User) UseRecoveryCode(hash string) error {
+	if !u.TOTPEnabled() {
+		return ErrTOTPNotEnrolled
+	}
+
+	idx := slices.Index(u.TOTP.RecoveryCodes, hash)
+	if idx < 0 {
+		return ErrRecoveryCodeInvalid
+	}
+
+	u.TOTP.RecoveryCodes = slices.Delete(slices.Clone(u.TOTP.RecoveryCodes), idx, idx+1)
+	u.UpdatedAt = time.Now()
+
+	e := NewUserRecoveryCodeUsedEvent(u, hash)
+	u.AddEvent(e)
+
+	return nil
+}
+
+func (u *User) TOTPEnabled() bool {
+	return u.TOTP != nil && u.TOTP.Enabled
+}
+
 func (u *User) AddSocialAccount(provider SocialProvider, socialID SocialID) error {
 	if u.HasSocialAccount(provider, socialID) {
 		return errors.New("social account already exists")
@@ -234,6 +450,17 @@ func (u *User) HasSocialAccount(provider SocialProvider, socialID SocialID) bool
 	return false
 }
 
+// TOTP is the authenticator-app second factor. Secret is sealed by the
+// service before it reaches the aggregate, so events and every repository
+// backend only ever see ciphertext; recovery codes are stored as hashes.
+// Neither is part of the user's JSON, which goes out over the API.
+type TOTP struct {
+	Secret        string    `json:"-"`
+	Enabled       bool      `json:"enabled"`
+	RecoveryCodes []string  `json:"-"`
+	ConfirmedAt   time.Time `json:"confirmed_at"`
+}
+
 type SocialProvider string
 
 const (
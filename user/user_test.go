@@ -26,3 +26,224 @@ func TestRegister(t *testing.T) {
 
 	fmt.Println(string(jsonStr))
 }
+
+func TestValidateUsername(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateUsername("user01"))
+	assert.NoError(ValidateUsername("lin.ying-chin_01"))
+
+	assert.ErrorIs(ValidateUsername("ab"), ErrUsernameInvalid)
+	assert.ErrorIs(ValidateUsername(".user01"), ErrUsernameInvalid)
+	assert.ErrorIs(ValidateUsername("user..01"), ErrUsernameInvalid)
+	assert.ErrorIs(ValidateUsername("User01"), ErrUsernameInvalid)
+	assert.ErrorIs(ValidateUsername("admin"), ErrUsernameReserved)
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert := assert.New(t)
+
+	email, err := NormalizeEmail(" User01@Example.COM ")
+	assert.NoError(err)
+	assert.Equal("user01@example.com", email)
+
+	for _, invalid := range []string{"", "user01", "user01@localhost", "User <user01@example.com>"} {
+		_, err := NormalizeEmail(invalid)
+		assert.ErrorIs(err, ErrEmailInvalid, invalid)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUser("user01", "User01", "user01@example.com")
+
+	assert.ErrorIs(u.ConfirmTOTP(nil), ErrTOTPNotEnrolled)
+
+	assert.NoError(u.EnrollTOTP("sealed-secret"))
+	assert.False(u.TOTPEnabled())
+
+	assert.NoError(u.ConfirmTOTP([]string{"hash1", "hash2"}))
+	assert.True(u.TOTPEnabled())
+	assert.ErrorIs(u.EnrollTOTP("another-secret"), ErrTOTPAlreadyEnabled)
+
+	assert.NoError(u.UseRecoveryCode("hash1"))
+	assert.ErrorIs(u.UseRecoveryCode("hash1"), ErrRecoveryCodeInvalid)
+	assert.Equal([]string{"hash2"}, u.TOTP.RecoveryCodes)
+
+	// The user's JSON goes out over the API.
+	bs, err := json.Marshal(u)
+	assert.NoError(err)
+	assert.NotContains(string(bs), "sealed-secret")
+	assert.NotContains(string(bs), "hash2")
+
+	assert.NoError(u.DisableTOTP())
+	assert.Nil(u.TOTP)
+
+	names := make([]string, 0)
+	for _, e := range u.Events() {
+		names = append(names, e.EventName())
+	}
+
+	assert.Equal([]string{
+		"user_totp_enrolled",
+		"user_totp_confirmed",
+		"user_recovery_code_used",
+		"user_totp_disabled",
+	}, names)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUser("user01", "User01", "user01@example.com")
+
+	policy, err := NewProfilePolicy("ifEmpty", "never", "always")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	incoming := Profile{
+		Name:   "User One",
+		Email:  "user01@another.com",
+		Avatar: "https://example.com/user01.png",
+	}
+
+	assert.True(u.UpdateProfile(policy.Merge(u.Profile(), incoming)))
+	assert.Equal("User01", u.Name)
+	assert.Equal("user01@example.com", u.Email)
+	assert.Equal("https://example.com/user01.png", u.Avatar)
+	assert.Len(u.Events(), 1)
+
+	// Nothing new, no event; a missing value keeps the stored one.
+	assert.False(u.UpdateProfile(policy.Merge(u.Profile(), Profile{Name: "User One"})))
+	assert.Len(u.Events(), 1)
+
+	_, err = NewProfilePolicy("sometimes", "", "")
+	assert.ErrorIs(err, ErrMergePolicyInvalid)
+}
+
+func TestEmailChange(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUser("user01", "User01", "user01@example.com")
+
+	assert.ErrorIs(u.ConfirmEmailChange(), ErrEmailChangeNotRequested)
+
+	u.RequestEmailChange("user01@another.com")
+	assert.Equal("user01@example.com", u.Email)
+	assert.Equal("user01@another.com", u.PendingEmail)
+
+	assert.NoError(u.ConfirmEmailChange())
+	assert.Equal("user01@another.com", u.Email)
+	assert.Empty(u.PendingEmail)
+	assert.Len(u.Events(), 2)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUser("user01", "User01", "user01@example.com")
+	assert.False(u.HasVerifiedEmail("user01@example.com"))
+
+	assert.NoError(u.VerifyEmail())
+	assert.True(u.HasVerifiedEmail("user01@example.com"))
+	assert.False(u.HasVerifiedEmail("user01@another.com"))
+	assert.Len(u.Events(), 1)
+
+	assert.ErrorIs(u.VerifyEmail(), ErrEmailAlreadyVerified)
+	assert.Len(u.Events(), 1)
+
+	// An address taken from a provider is not vouched for.
+	u.UpdateProfile(Profile{Name: "User01", Email: "user01@another.com"})
+	assert.False(u.EmailVerified)
+
+	// A confirmed change is.
+	u.RequestEmailChange("user01@third.com")
+	assert.NoError(u.ConfirmEmailChange())
+	assert.True(u.HasVerifiedEmail("user01@third.com"))
+}
+
+func TestParseLinkPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, policy := range []LinkPolicy{LinkNever, LinkVerified, LinkPrompt} {
+		parsed, err := ParseLinkPolicy(policy.String())
+		assert.NoError(err)
+		assert.Equal(policy, parsed)
+	}
+
+	policy, err := ParseLinkPolicy("")
+	assert.NoError(err)
+	assert.Equal(LinkNever, policy)
+
+	_, err = ParseLinkPolicy("always")
+	assert.ErrorIs(err, ErrLinkPolicyInvalid)
+}
+
+func TestLock(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUser("user01", "User01", "user01@example.com")
+	u.Register()
+	assert.ErrorIs(u.CheckActive(), ErrUserNotActivated)
+	assert.ErrorIs(u.Lock("abuse"), ErrUserNotActivated)
+
+	u.Activate()
+	assert.NoError(u.CheckActive())
+	assert.ErrorIs(u.Unlock(), ErrUserNotLocked)
+
+	events := len(u.Events())
+
+	assert.NoError(u.Lock("abuse"))
+	assert.Equal(Locked, u.Status)
+	assert.ErrorIs(u.CheckActive(), ErrUserLocked)
+	assert.ErrorIs(u.Lock("abuse"), ErrUserLocked)
+
+	assert.NoError(u.Unlock())
+	assert.Equal(Activated, u.Status)
+	assert.Len(u.Events(), events+2)
+}
+
+func TestQueryMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUser("user01", "User01", "user01@example.com")
+	u.AddSocialAccount(GOOGLE, "100")
+
+	assert.True((&Query{}).Match(u))
+	assert.True((&Query{Status: []Status{Pending, Activated}}).Match(u))
+	assert.False((&Query{Status: []Status{Activated}}).Match(u))
+	assert.True((&Query{Provider: GOOGLE}).Match(u))
+	assert.False((&Query{Provider: LINE}).Match(u))
+	assert.True((&Query{UsernamePrefix: "user", EmailPrefix: "user01@"}).Match(u))
+	assert.False((&Query{EmailPrefix: "user02"}).Match(u))
+
+	// The range includes its start and excludes its end.
+	assert.True((&Query{CreatedAfter: u.CreatedAt}).Match(u))
+	assert.False((&Query{CreatedBefore: u.CreatedAt}).Match(u))
+
+	sort, err := ParseSort("-created")
+	assert.NoError(err)
+	assert.Equal(SortNewest, sort)
+
+	_, err = ParseSort("username")
+	assert.ErrorIs(err, ErrSortInvalid)
+
+	assert.Equal(DefaultQueryLimit, (&Query{}).Size())
+	assert.Equal(MaxQueryLimit, (&Query{Limit: 1000}).Size())
+}
+
+func TestSearchTerms(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"lin", "ying", "chin"}, Tokenize("Lin, Ying-Chin"))
+	assert.Empty(Tokenize(" @. "))
+
+	u := NewUser("user01", "User01", "user01@example.com")
+	u.AddSocialAccount(GOOGLE, "100")
+
+	// Each word once, whichever field it comes from.
+	assert.Equal([]string{"user01", "example", "com", "100"}, SearchTerms(u))
+}
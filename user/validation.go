@@ -0,0 +1,67 @@
+package user
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9._-]{1,30}[a-z0-9])$`)
+
+// reservedUsernames can never be claimed through self-service registration.
+// "admin" matters most: the default jwt.admins entry grants the admin role by name.
+var reservedUsernames = []string{
+	"admin", "administrator", "root", "system", "support",
+	"identity", "api", "auth", "oauth", "signin", "signup",
+	"me", "self", "search", "null", "undefined",
+}
+
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// ValidateUsername expects an already normalized username.
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) || strings.Contains(username, "..") {
+		return ErrUsernameInvalid
+	}
+
+	if slices.Contains(reservedUsernames, username) {
+		return ErrUsernameReserved
+	}
+
+	return nil
+}
+
+// ValidateAvatar accepts an absolute https URL, or nothing.
+func ValidateAvatar(avatar string) error {
+	if avatar == "" {
+		return nil
+	}
+
+	u, err := url.Parse(avatar)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return ErrAvatarInvalid
+	}
+
+	return nil
+}
+
+// NormalizeEmail validates a bare address (no display name) and lowercases it.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", ErrEmailInvalid
+	}
+
+	local, domain, ok := strings.Cut(addr.Address, "@")
+	if !ok || local == "" || !strings.Contains(domain, ".") {
+		return "", ErrEmailInvalid
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
@@ -0,0 +1,121 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flarexio/identity/keyring"
+	"github.com/flarexio/identity/mail"
+)
+
+// ErrTokenInvalid collapses unknown/expired/tampered into one error.
+var ErrTokenInvalid = errors.New("verification token invalid")
+
+// Service mails signed links that prove an address reaches its owner.
+type Service interface {
+	Issue(subject string, email string) error
+	Verify(token string) (subject string, email string, err error)
+}
+
+const (
+	defaultTTL = 24 * time.Hour
+	audience   = "email-verification"
+)
+
+type claims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// NewService signs links with the key ring, like every other token, so
+// rotations apply to them too. Their own audience keeps a link from passing
+// for an access token, and the other way round.
+func NewService(keys *keyring.KeyRing, sender mail.Sender, verifyURL string, ttl time.Duration) Service {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	return &service{
+		keys:      keys,
+		sender:    sender,
+		verifyURL: verifyURL,
+		ttl:       ttl,
+	}
+}
+
+type service struct {
+	keys      *keyring.KeyRing
+	sender    mail.Sender
+	verifyURL string
+	ttl       time.Duration
+}
+
+func (svc *service) Issue(subject string, email string) error {
+	now := time.Now()
+	key := svc.keys.Active()
+
+	t := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(svc.ttl)),
+		},
+		Email: email,
+	})
+	t.Header["kid"] = key.ID
+
+	token, err := t.SignedString(key.Privkey)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(svc.verifyURL)
+	if err != nil {
+		return err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return svc.sender.Send(&mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open the link below to verify your email address:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for it, ignore this email.\n",
+			link.String(), svc.ttl),
+	})
+}
+
+// Verify returns whom the link was issued to, and for which address; it is
+// up to the caller to check that address is still the user's.
+func (svc *service) Verify(token string) (string, string, error) {
+	var c claims
+	if _, err := jwt.ParseWithClaims(token, &c, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		k, err := svc.keys.Lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		return k.Public(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	); err != nil {
+		return "", "", ErrTokenInvalid
+	}
+
+	if c.Subject == "" || c.Email == "" {
+		return "", "", ErrTokenInvalid
+	}
+
+	return c.Subject, c.Email, nil
+}
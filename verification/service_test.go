@@ -0,0 +1,85 @@
+package verification_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flarexio/identity/keyring"
+	"github.com/flarexio/identity/mail"
+	"github.com/flarexio/identity/verification"
+)
+
+func linkToken(t *testing.T, body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "https://") {
+			continue
+		}
+
+		link, err := url.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return link.Query().Get("token")
+	}
+
+	t.Fatal("link not found")
+	return ""
+}
+
+func TestVerification(t *testing.T) {
+	assert := assert.New(t)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	keys := keyring.New(keyring.NewKey(key))
+	sender := mail.NewInMemSender()
+
+	svc := verification.NewService(keys, sender, "https://identity.flarex.io/identity/v1/email/verification", 0)
+
+	err := svc.Issue("user01", "user01@example.com")
+	if err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	messages := sender.Messages("user01@example.com")
+	if !assert.Len(messages, 1) {
+		return
+	}
+
+	token := linkToken(t, messages[0].Body)
+
+	subject, email, err := svc.Verify(token)
+	assert.NoError(err)
+	assert.Equal("user01", subject)
+	assert.Equal("user01@example.com", email)
+
+	_, _, err = svc.Verify(token + "x")
+	assert.ErrorIs(err, verification.ErrTokenInvalid)
+
+	// Links of another key are worthless.
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	otherKeys := keyring.New(keyring.NewKey(other))
+	_, _, err = verification.NewService(otherKeys, sender, "", 0).Verify(token)
+	assert.ErrorIs(err, verification.ErrTokenInvalid)
+
+	// Links signed before a rotation hold while the retired key is kept.
+	if _, err := keys.Rotate(); err != nil {
+		assert.Fail(err.Error())
+		return
+	}
+
+	_, _, err = svc.Verify(token)
+	assert.NoError(err)
+
+	keys.Prune(time.Now().Add(time.Second))
+
+	_, _, err = svc.Verify(token)
+	assert.ErrorIs(err, verification.ErrTokenInvalid)
+}